@@ -0,0 +1,36 @@
+package backbone
+
+import (
+	"context"
+	"io"
+)
+
+// ContextReader bricht das Lesen ab, sobald der ctx beendet wurde (Read gibt dann den Fehler des ctx zurück).
+// Ein bereits blockierendes Read wird dabei nicht unterbrochen.
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r // kann nie beendet werden (zB context.Background())
+	}
+	return &contextReader{ctx: ctx, r: r}
+}
+
+// ContextReadCloser ist wie ContextReader, Close wird an den ReadCloser weitergegeben.
+func ContextReadCloser(ctx context.Context, r io.ReadCloser) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{ContextReader(ctx, r), r}
+}
+
+// contextReader prüft vor jedem Read den ctx.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
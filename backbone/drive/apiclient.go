@@ -1,14 +1,18 @@
 package drive
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"splitfuseX/backbone"
+	"splitfuseX/backbone/middleware"
+	"splitfuseX/logging"
 
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
@@ -25,6 +29,25 @@ type ApiClient struct {
 	apiQuerySize         int // default 1000
 	fileList             map[string]*backbone.FileObject
 	changeStartPageToken string
+
+	mutex       *sync.RWMutex // schützt fileList und changeStartPageToken
+	updateMutex *sync.Mutex   // InitFileList() und UpdateFileList() laufen nie gleichzeitig
+
+	retry *retryTransport // wiederholt Requests bei vorübergehenden Fehlern (nil deaktiviert die Wiederholung in Save)
+}
+
+// SetRetry ändert, wie oft ein Request wiederholt wird (0 bedeutet MaxRetries) und wie viele Requests pro Sekunde
+// geschickt werden (0 bedeutet DefaultQPS). Muss vor dem ersten Zugriff aufgerufen werden.
+func (client *ApiClient) SetRetry(maxRetries int, qps float64) {
+	if client.retry == nil {
+		return
+	}
+	if maxRetries > 0 {
+		client.retry.maxRetries = maxRetries
+	}
+	if qps > 0 {
+		client.retry.limiter = middleware.NewRateLimiter(qps)
+	}
 }
 
 // Read gibt einen *http.Response auf die angeforderte Drive Datei zurück.
@@ -34,25 +57,72 @@ type ApiClient struct {
 // und es wird beim Byte 0 der Datei mit dem zählen begonnen.  (Es ist auch egal, wenn hier zu viel angegeben wird!)
 // ACHTUNG: Am Ende .Close() nicht vergessen!
 func (client *ApiClient) Read(fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
-	fileGetCall := client.api.Files.Get(fileId)
+	return client.ReadContext(context.Background(), fileId, offset, fileSize)
+}
+
+// ReadContext ist wie Read. Wird der ctx beendet, dann bricht auch das Lesen des Streams ab.
+func (client *ApiClient) ReadContext(ctx context.Context, fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	fileGetCall := client.api.Files.Get(fileId).Context(ctx)
 	fileGetCall.Header().Set("Range", fmt.Sprintf("bytes=%d-%d", offset, fileSize))
 
 	resp, err := fileGetCall.Download()
 	if err != nil {
 		return nil, err
 	}
-	return resp.Body, nil
+	return backbone.CountReads("drive", resp.Body), nil
 }
 
 // Trash verschiebt eine Datei in den Papierkorb.
 func (client *ApiClient) Trash(fileId string) error {
-	_, err := client.api.Files.Update(fileId, &drive.File{Trashed: true}).Do()
+	return client.TrashContext(context.Background(), fileId)
+}
+
+// TrashContext ist wie Trash.
+func (client *ApiClient) TrashContext(ctx context.Context, fileId string) error {
+	_, err := client.api.Files.Update(fileId, &drive.File{Trashed: true}).Context(ctx).Do()
 	return err
 }
 
 // Save lädt Daten in die Cloud hoch.
 // Im Erfolgsfall wird die fileID der erstellten Datei zurück gegeben,
 func (client *ApiClient) Save(fileName string, file io.Reader, maxRead int64) (string, error) {
+	return client.SaveContext(context.Background(), fileName, file, maxRead)
+}
+
+// SaveContext ist wie Save. Wird der ctx beendet, dann wird der Upload abgebrochen.
+// Kann der Stream zurückgespult werden (io.Seeker), dann wird der Upload bei vorübergehenden Fehlern
+// (429, 5xx oder Rate-Limit) mit exponential backoff wiederholt. Andere Streams können nicht wiederholt werden.
+func (client *ApiClient) SaveContext(ctx context.Context, fileName string, file io.Reader, maxRead int64) (string, error) {
+	seeker, _ := file.(io.Seeker)
+	var start int64
+	if seeker != nil {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seeker = nil
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		fileId, err := client.save(withoutRetry(ctx), fileName, file, maxRead)
+		if err == nil || seeker == nil || client.retry == nil || attempt >= client.retry.maxRetries || ctx.Err() != nil || !Retryable(err) {
+			return fileId, err
+		}
+
+		// warten und den Stream zurückspulen
+		wait := client.retry.backoff(attempt)
+		retries.Inc("upload")
+		logging.Warn("drive: retry upload", logging.Backbone("drive"), logging.F("name", fileName), logging.F("retry", attempt+1), logging.Duration(wait), logging.Err(err))
+		if err := middleware.Sleep(ctx, wait); err != nil {
+			return "", err
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+}
+
+// save lädt die Daten einmal hoch (siehe SaveContext).
+func (client *ApiClient) save(ctx context.Context, fileName string, file io.Reader, maxRead int64) (string, error) {
 
 	// root fix:  "You can use the alias root to refer to the root folder anywhere a file ID is provided"
 	parentId := client.folderId
@@ -71,17 +141,20 @@ func (client *ApiClient) Save(fileName string, file io.Reader, maxRead int64) (s
 	if maxRead > 0 {
 		file = io.LimitReader(file, maxRead)
 	}
-	driveFile, err := client.api.Files.Create(driveFile).Media(file).Do()
+	driveFile, err := client.api.Files.Create(driveFile).Context(ctx).Media(file).Do()
 
 	// request error
 	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
 		errMsg := fmt.Sprintf("%v", err)
 		if strings.Contains(errMsg, "insufficientPermissions") {
 			// wrong permissions
-			return "", fmt.Errorf("upload error: wrong permissions: create a new oauth token with --upload flag: %v", err)
+			return "", fmt.Errorf("upload error: wrong permissions: create a new oauth token with --upload flag: %w", err)
 		} else {
 			// other error
-			return "", fmt.Errorf("upload error: %v", err)
+			return "", fmt.Errorf("upload error: %w", err)
 		}
 	}
 
@@ -92,11 +165,20 @@ func (client *ApiClient) Save(fileName string, file io.Reader, maxRead int64) (s
 // InitFileList aktualisiert den internen Speicher mit allen DATEIEN im angegebenen Ordner.
 // Ordner (folderMimeType) sowie Unterordner und deren Inhalt werden komplett ignoriert!
 func (client *ApiClient) InitFileList() error {
+	return client.InitFileListContext(context.Background())
+}
+
+// InitFileListContext ist wie InitFileList.
+func (client *ApiClient) InitFileListContext(ctx context.Context) error {
+
+	// LOCK / UNLOCK
+	client.updateMutex.Lock()
+	defer client.updateMutex.Unlock()
 
 	// root fix:  "You can use the alias root to refer to the root folder anywhere a file ID is provided"
 	if client.folderId == "root" || client.folderId == "" {
 		// root is not the correct fileId! its only a symlink!
-		rootId, err := client.api.Files.Get("root").Do()
+		rootId, err := client.api.Files.Get("root").Context(ctx).Do()
 		if err != nil {
 			return err
 		}
@@ -105,13 +187,13 @@ func (client *ApiClient) InitFileList() error {
 
 	// CACHE ????
 	if client.cachePath != "" {
-		err := client.loadStatus()
+		err := client.loadStatus(ctx)
 		if err == nil {
 			// juhu! -> fin
 			return nil
 		} else {
 			// :*(
-			fmt.Printf("%v\n", err)
+			logging.Warn("can't load status cache", logging.Backbone("drive"), logging.Path(client.cachePath), logging.Err(err))
 		}
 	}
 
@@ -127,11 +209,10 @@ func (client *ApiClient) InitFileList() error {
 	}
 
 	// get a new StartPageToken to watch changes
-	startPageTokenObj, err := client.api.Changes.GetStartPageToken().Do()
+	startPageTokenObj, err := client.api.Changes.GetStartPageToken().Context(ctx).Do()
 	if err != nil {
 		return err
 	}
-	client.changeStartPageToken = startPageTokenObj.StartPageToken
 
 	// get all relevant files
 	newList := make(map[string]*backbone.FileObject)
@@ -140,7 +221,7 @@ func (client *ApiClient) InitFileList() error {
 		// read a result page
 		fileList, err := client.api.Files.List().Q(query).PageToken(pageToken).
 			Spaces(spaces).Corpora(corpora).PageSize(int64(pageSize)).
-			Fields(googleapi.Field(fields)).Do()
+			Fields(googleapi.Field(fields)).Context(ctx).Do()
 
 		// error handling
 		if err != nil {
@@ -165,7 +246,10 @@ func (client *ApiClient) InitFileList() error {
 	}
 
 	// FIN: set new list
+	client.mutex.Lock()
 	client.fileList = newList
+	client.changeStartPageToken = startPageTokenObj.StartPageToken
+	client.mutex.Unlock()
 	return nil
 }
 
@@ -173,9 +257,21 @@ func (client *ApiClient) InitFileList() error {
 // Das kann sehr viel effizienter sein als alle Dateien neu einzulesen.
 // Zuerst muss jedoch InitFileList() mindestens einmal aufgeführt worden sein!
 func (client *ApiClient) UpdateFileList() error {
+	return client.UpdateFileListContext(context.Background())
+}
+
+// UpdateFileListContext ist wie UpdateFileList.
+func (client *ApiClient) UpdateFileListContext(ctx context.Context) error {
+
+	// LOCK / UNLOCK
+	client.updateMutex.Lock()
+	defer client.updateMutex.Unlock()
 
 	// first init the file list
-	if client.changeStartPageToken == "" {
+	client.mutex.RLock()
+	pageToken := client.changeStartPageToken
+	client.mutex.RUnlock()
+	if pageToken == "" {
 		return fmt.Errorf("can't get changes without StartPageToken: call InitFileList() first")
 	}
 
@@ -188,18 +284,16 @@ func (client *ApiClient) UpdateFileList() error {
 		pageSize = 1000
 	}
 
-	// the first page is the changeStartPageToken
-	pageToken := client.changeStartPageToken
-
 	// loop to get all changes
 	for {
 		// read a result pages
-		changeList, err := client.api.Changes.List(pageToken).Spaces(spaces).PageSize(int64(pageSize)).Fields(googleapi.Field(fields)).Do()
+		changeList, err := client.api.Changes.List(pageToken).Spaces(spaces).PageSize(int64(pageSize)).Fields(googleapi.Field(fields)).Context(ctx).Do()
 		if err != nil {
 			return err
 		}
 
 		// update fileList
+		client.mutex.Lock()
 		for _, change := range changeList.Changes {
 			// is a file
 			if change.File.MimeType != folderMimeType {
@@ -230,15 +324,17 @@ func (client *ApiClient) UpdateFileList() error {
 			// no more pages
 			// set the new NewStartPageToken for the next UpdateFileList() call
 			client.changeStartPageToken = changeList.NewStartPageToken
+			client.mutex.Unlock()
 			break
 		}
+		client.mutex.Unlock()
 	}
 
 	// write cache file
-	err := client.saveStatus()
+	err := client.saveStatus(ctx)
 	if err != nil {
 		// :*(
-		fmt.Printf("%v\n", err)
+		logging.Warn("can't save status cache", logging.Backbone("drive"), logging.Path(client.cachePath), logging.Err(err))
 	}
 
 	return nil
@@ -250,6 +346,9 @@ func (client *ApiClient) UpdateFileList() error {
 // Für aktuelle Date muss InitFileList() bzw. UpdateFileList() aufgerufen werden.
 // Min. enthalten sind: id, name, size, modifiedTime
 func (client *ApiClient) FileList() map[string]*backbone.FileObject {
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
+
 	ret := make(map[string]*backbone.FileObject)
 
 	for k, v := range client.fileList {
@@ -273,7 +372,7 @@ type cacheClient struct {
 }
 
 // saveStatus speichert die FileList in einer Datei um später mit loadStatus() die InitFileList() Funktion zu beschleunigen.
-func (client *ApiClient) saveStatus() error {
+func (client *ApiClient) saveStatus(ctx context.Context) error {
 
 	// leerer String deaktivert diese Funktion
 	if client.cachePath == "" {
@@ -288,12 +387,14 @@ func (client *ApiClient) saveStatus() error {
 	defer fh.Close()
 
 	// calc cache signature
-	sig, err := client.calcCacheSig()
+	sig, err := client.calcCacheSig(ctx)
 	if err != nil {
 		return fmt.Errorf("can't calc cache signature: %v", err)
 	}
 
 	// Objekt zum Serialisieren vorbereiten
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
 	obj := &cacheClient{FileList: client.fileList, ChangeStartPageToken: client.changeStartPageToken, CacheSig: sig}
 
 	// Daten schreiben
@@ -306,7 +407,7 @@ func (client *ApiClient) saveStatus() error {
 
 // loadStatus lädt eine FileList aus einer Datei und stellt damit den Zustand zu einem Zeitpunkt wiederher.
 // Der Status muss jedoch mit einem erfolgreichen UpdateFileList() validiert werden!
-func (client *ApiClient) loadStatus() error {
+func (client *ApiClient) loadStatus(ctx context.Context) error {
 
 	// leerer String deaktivert diese Funktion
 	if client.cachePath == "" {
@@ -332,7 +433,7 @@ func (client *ApiClient) loadStatus() error {
 	}
 
 	// check cache signature
-	sig, err := client.calcCacheSig()
+	sig, err := client.calcCacheSig(ctx)
 	if err != nil {
 		return fmt.Errorf("can't calc cache signature: %v", err)
 	}
@@ -349,26 +450,31 @@ func (client *ApiClient) loadStatus() error {
 
 		changeStartPageToken: cacheClient.ChangeStartPageToken,
 		fileList:             cacheClient.FileList,
+
+		mutex:       &sync.RWMutex{},
+		updateMutex: &sync.Mutex{},
 	}
 
-	err = newClient.UpdateFileList()
+	err = newClient.UpdateFileListContext(ctx)
 	if err != nil {
 		return fmt.Errorf("cacheClient UpdateFileList call fail: %v", err)
 	}
 
 	// die aktuelle FileList in den aktiven client übertragen
+	client.mutex.Lock()
 	client.fileList = newClient.fileList
 	client.changeStartPageToken = newClient.changeStartPageToken
+	client.mutex.Unlock()
 
 	return nil
 }
 
 // calcCacheSig berechnet einen String um Caches fix einem oauth file und der rootFolderId zuzuordnen.
-func (client *ApiClient) calcCacheSig() (string, error) {
+func (client *ApiClient) calcCacheSig(ctx context.Context) (string, error) {
 	badSig := fmt.Sprintf("%d", time.Now().Unix())
 
 	// get user id
-	about, err := client.api.About.Get().Fields("user(permissionId)").Do()
+	about, err := client.api.About.Get().Fields("user(permissionId)").Context(ctx).Do()
 	if err != nil {
 		return badSig, err
 	}
@@ -394,7 +500,7 @@ func parseTime(t string) int64 {
 
 	// error ??  Das ist blöd! Dürfte nicht passieren!
 	if err != nil {
-		fmt.Printf("WARNING: can't parse time '%s': %v", t, err)
+		logging.Warn("can't parse time", logging.Backbone("drive"), logging.F("time", t), logging.Err(err))
 		return time.Now().Unix() - 4730000000 // -150 Jahre
 	}
 
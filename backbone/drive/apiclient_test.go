@@ -23,9 +23,9 @@ func TestApiClient(t *testing.T) {
 
 	// --- TEST NewApiClient()
 	// Wenn ein ApiClient bezogen werden kann, dann hat bereits alles funktioniert.
-	tmp := NewApiClient("/home/user/client_secret.json", "/home/user/token.json", "/home/user/cache.dat", testFolder)
-	if tmp == nil {
-		t.Error("can't create an ApiClient")
+	tmp, err := NewApiClient("/home/user/client_secret.json", "/home/user/token.json", "/home/user/cache.dat", testFolder)
+	if err != nil {
+		t.Fatalf("can't create an ApiClient: %v", err)
 	}
 
 	// cast back
@@ -36,7 +36,7 @@ func TestApiClient(t *testing.T) {
 	client.apiQuerySize = 2
 
 	// --- TEST InitFileList()
-	err := client.InitFileList()
+	err = client.InitFileList()
 	if err != nil {
 		t.Error(err)
 	}
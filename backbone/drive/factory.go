@@ -2,9 +2,10 @@ package drive
 
 import (
 	"fmt"
-	"os"
+	"sync"
 
 	"splitfuseX/backbone"
+	"splitfuseX/core"
 
 	"golang.org/x/net/context"
 	"google.golang.org/api/drive/v3"
@@ -12,28 +13,35 @@ import (
 
 // NewApiClient gibt einen drive api client zurück.
 // Die folderId gibt den Ordner mit den Chunks an (default ist root).
-// Im Fehlerfall terminiert das Programm mit os.Exit (siehe loadApiConfig() und loadToken())
+// Im Fehlerfall wird ein core.ExitError zurück gegeben (siehe loadApiConfig() und loadToken(), 41 ... Drive client)
 // HINWEIS: Bleibt der cachePath leer, dann ist diese Funktionalität deaktiviert!
-func NewApiClient(clientSecretPath, tokenFilePath, cachePath, folderId string) backbone.Client {
+func NewApiClient(clientSecretPath, tokenFilePath, cachePath, folderId string) (backbone.Client, error) {
 
 	// load client_secret file
-	config := loadApiConfig(clientSecretPath, false)
+	config, err := loadApiConfig(clientSecretPath, false)
+	if err != nil {
+		return nil, err
+	}
 
 	// load token file
-	token := loadToken(tokenFilePath)
+	token, err := loadToken(tokenFilePath)
+	if err != nil {
+		return nil, err
+	}
 
-	// create client
+	// create client (mit Wiederholungen bei vorübergehenden Fehlern und max. DefaultQPS Requests pro Sekunde)
 	client := config.Client(context.Background(), token)
+	retry := newRetryTransport(client.Transport, DefaultQPS)
+	client.Transport = retry
 
 	// create drive service (API)
 	api, err := drive.New(client)
 	if err != nil {
-		fmt.Printf("unable to retrieve Drive client: %v", err)
-		os.Exit(41)
+		return nil, &core.ExitError{Code: 41, Err: fmt.Errorf("unable to retrieve Drive client: %v", err)}
 	}
 
 	// return
 	var ret *ApiClient
-	ret = &ApiClient{api: api, folderId: folderId, cachePath: cachePath}
-	return ret
+	ret = &ApiClient{api: api, folderId: folderId, cachePath: cachePath, mutex: &sync.RWMutex{}, updateMutex: &sync.Mutex{}, retry: retry}
+	return ret, nil
 }
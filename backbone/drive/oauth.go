@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"os"
 
+	"splitfuseX/core"
+
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -13,13 +15,12 @@ import (
 )
 
 // loadApiConfig lädt das angegebene client_secret.json und erstellt daraus das config Objekt.
-// Bei einem Fehler wird eine Anleitung zum Erstellen einer client secret Datei auf der Konsole ausgegeben.
-// ACHTUNG: Die Methode terminiert (os.exit) im Fehlerfall mit 11 ... file not found, oder 12 ... parsing error!
-func loadApiConfig(clientSecretPath string, withWriteAccess bool) *oauth2.Config {
+// Bei einem Fehler enthält die Meldung eine Anleitung zum Erstellen einer client secret Datei.
+// Fehlercode (siehe core.ExitError): 11 ... file not found, oder 12 ... parsing error
+func loadApiConfig(clientSecretPath string, withWriteAccess bool) (*oauth2.Config, error) {
 
 	// error info text
-	const createClientSecretMsg = `
-ERROR: %v
+	const createClientSecretMsg = `%v
 
 Please create a new Drive API!
 (Tutorial: https://developers.google.com/drive/api/v3/quickstart/go)
@@ -52,31 +53,28 @@ Please create a new Drive API!
 	// read client_secret json file
 	bytes, err := ioutil.ReadFile(clientSecretPath)
 	if err != nil {
-		fmt.Printf(createClientSecretMsg, err, clientSecretPath)
-		os.Exit(11)
+		return nil, &core.ExitError{Code: 11, Err: fmt.Errorf(createClientSecretMsg, err, clientSecretPath)}
 	}
 
 	// parse config object
 	config, err := google.ConfigFromJSON(bytes, scope)
 	if err != nil {
-		fmt.Printf(createClientSecretMsg, err, clientSecretPath)
-		os.Exit(12)
+		return nil, &core.ExitError{Code: 12, Err: fmt.Errorf(createClientSecretMsg, err, clientSecretPath)}
 	}
 
 	// ok -> return config
-	return config
+	return config, nil
 }
 
 // loadToken lädt den Token für den Zugriff auf Google Drive aus der Datei.
-// Bei einem Fehler wird eine Aufforderung zum Erstellen eines Tokens auf der Konsole ausgegeben.
-// ACHTUNG: Die Methode terminiert (os.exit) im Fehlerfall mit 21 ... file not found, oder 22 ... parsing error!
-func loadToken(tokenFilePath string) *oauth2.Token {
+// Bei einem Fehler enthält die Meldung eine Aufforderung zum Erstellen eines Tokens.
+// Fehlercode (siehe core.ExitError): 21 ... file not found, oder 22 ... parsing error
+func loadToken(tokenFilePath string) (*oauth2.Token, error) {
 
 	// read token file
 	fh, err := os.Open(tokenFilePath)
 	if err != nil {
-		fmt.Printf("ERROR: %v\n\nCreate a new token file!\n", err)
-		os.Exit(21)
+		return nil, &core.ExitError{Code: 21, Err: fmt.Errorf("%v\n\nCreate a new token file!", err)}
 	}
 	defer fh.Close()
 
@@ -84,18 +82,17 @@ func loadToken(tokenFilePath string) *oauth2.Token {
 	tok := &oauth2.Token{}
 	err = json.NewDecoder(fh).Decode(tok)
 	if err != nil {
-		fmt.Printf("ERROR: %v\n\nCreate a new token file!\n", err)
-		os.Exit(22)
+		return nil, &core.ExitError{Code: 22, Err: fmt.Errorf("%v\n\nCreate a new token file!", err)}
 	}
 
 	// ok -> return access token
-	return tok
+	return tok, nil
 }
 
 // CreateTokenFile interagiert auf der Konsole mit dem Benutzer und erstellt einen neues oauth token file.
-// Bei einem Fehler terminiert das Programm mit os.exit und leitet den Benutzer mit einer Fehlermeldung an (siehe: loadApiConfig()).
-// Fehlercode: 11, 12, 21, 22, 31, 32 und 33
-func CreateTokenFile(clientSecretPath string, tokenFilePath string, withWriteAccess bool) {
+// Bei einem Fehler wird ein core.ExitError zurück gegeben, dessen Meldung den Benutzer anleitet (siehe: loadApiConfig()).
+// Fehlercode: 11, 12, 31, 32 und 33
+func CreateTokenFile(clientSecretPath string, tokenFilePath string, withWriteAccess bool) error {
 
 	// error info text
 	const createTokenMsg = `
@@ -106,8 +103,11 @@ Go to the following link in your browser then type the authorization code:
 %v
 --------------------------------------------------------------------------
 `
-	// load config  (exit on error)
-	config := loadApiConfig(clientSecretPath, withWriteAccess)
+	// load config
+	config, err := loadApiConfig(clientSecretPath, withWriteAccess)
+	if err != nil {
+		return err
+	}
 
 	// print auth url
 	accessType := "READONLY"
@@ -120,23 +120,23 @@ Go to the following link in your browser then type the authorization code:
 	// read authCode (user input)
 	var authCode string
 	if _, err := fmt.Scan(&authCode); err != nil {
-		fmt.Printf("unable to read authorization code: %v", err)
-		os.Exit(31)
+		return &core.ExitError{Code: 31, Err: fmt.Errorf("unable to read authorization code: %v", err)}
 	}
 
 	// generate token
 	tok, err := config.Exchange(context.Background(), authCode)
 	if err != nil {
-		fmt.Printf("unable to retrieve token from web: %v", err)
-		os.Exit(32)
+		return &core.ExitError{Code: 32, Err: fmt.Errorf("unable to retrieve token from web: %v", err)}
 	}
 
 	// save token to file
 	f, err := os.OpenFile(tokenFilePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
-		fmt.Printf("unable to write oauth token file: %v", err)
-		os.Exit(33)
+		return &core.ExitError{Code: 33, Err: fmt.Errorf("unable to write oauth token file: %v", err)}
 	}
 	defer f.Close()
-	json.NewEncoder(f).Encode(tok)
+	if err := json.NewEncoder(f).Encode(tok); err != nil {
+		return &core.ExitError{Code: 33, Err: fmt.Errorf("unable to write oauth token file: %v", err)}
+	}
+	return nil
 }
@@ -0,0 +1,204 @@
+package drive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"splitfuseX/backbone/middleware"
+	"splitfuseX/logging"
+	"splitfuseX/metrics"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Wie viele Requests dürfen pro Sekunde an die Drive API geschickt werden (client-seitig, 0 bedeutet unbegrenzt)
+// Das Standard-Kontingent von Google Drive liegt bei etwa 12.000 Requests pro Minute und Benutzer.
+const DefaultQPS = 10
+
+// Wie oft wird ein Request nach einem vorübergehenden Fehler (429, 5xx oder Rate-Limit) wiederholt
+const MaxRetries = 6
+
+// Wartezeit vor der ersten Wiederholung. Sie verdoppelt sich mit jedem Versuch (exponential backoff).
+const MinBackoff = 1 * time.Second
+
+// Maximale Wartezeit zwischen zwei Versuchen (gilt auch für den Retry-After Header)
+const MaxBackoff = 64 * time.Second
+
+// maxErrorBody begrenzt, wie viel vom Body einer 403 Antwort nach dem Grund durchsucht wird.
+const maxErrorBody = 64 * 1024
+
+// retries zählt die wiederholten Requests je Grund (Status Code oder "network").
+var retries = metrics.Default.NewCounter("splitfusex_drive_retries_total", "Wiederholte Requests an die Drive API je Grund", "reason")
+
+// retryTransport wiederholt Requests an die Drive API bei vorübergehenden Fehlern mit exponential backoff und jitter.
+// Wiederholt werden 429, 5xx, 403 mit dem Grund (user)RateLimitExceeded und Verbindungsfehler.
+// Ein Retry-After Header wird dabei beachtet. Vor jedem Versuch wird auf den RateLimiter gewartet.
+// Wiederholt wird jeder Request einzeln, bei InitFileList also nur die fehlgeschlagene Seite.
+// HINWEIS: Requests mit einem Body, der nicht erneut gelesen werden kann (zB ein Upload aus einem Stream), werden nicht
+// wiederholt. Ebenso Requests in einem ctx von withoutRetry (SaveContext wiederholt den ganzen Upload selbst).
+type retryTransport struct {
+	next       http.RoundTripper
+	limiter    *middleware.RateLimiter
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// newRetryTransport umhüllt next (nil ist http.DefaultTransport) mit Wiederholungen und einem Limit von qps Requests pro Sekunde.
+func newRetryTransport(next http.RoundTripper, qps float64) *retryTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &retryTransport{
+		next:       next,
+		limiter:    middleware.NewRateLimiter(qps),
+		maxRetries: MaxRetries,
+		minBackoff: MinBackoff,
+		maxBackoff: MaxBackoff,
+	}
+}
+
+// RoundTrip führt den Request aus (siehe http.RoundTripper).
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	if ctx.Value(noRetryKey{}) != nil {
+		replayable = false
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		// Body für eine Wiederholung neu erzeugen
+		try := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			try = req.Clone(ctx)
+			try.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(try)
+		reason, wait := t.retryReason(resp, err)
+		if reason == "" || !replayable || attempt >= t.maxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		// Antwort verwerfen und warten
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxErrorBody))
+			resp.Body.Close()
+		}
+		if wait <= 0 {
+			wait = t.backoff(attempt)
+		}
+		retries.Inc(reason)
+		logging.Warn("drive: retry request", logging.Backbone("drive"), logging.F("method", req.Method), logging.F("reason", reason),
+			logging.F("retry", attempt+1), logging.Duration(wait), logging.Err(err))
+		if err := middleware.Sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryReason prüft, ob ein Request wiederholt werden soll ("" bedeutet nein).
+// wait ist die vom Server gewünschte Wartezeit (Retry-After) oder 0.
+// Bei 403 wird der Body gelesen und für den Aufrufer wiederhergestellt.
+func (t *retryTransport) retryReason(resp *http.Response, err error) (reason string, wait time.Duration) {
+	if err != nil {
+		return "network", 0
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		// passt
+	case resp.StatusCode == http.StatusForbidden:
+		// 403 ist nur bei einem Rate-Limit vorübergehend (sonst zB fehlende Berechtigungen)
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), resp.Body), resp.Body}
+		if !isRateLimit(string(b)) {
+			return "", 0
+		}
+	default:
+		return "", 0
+	}
+	return strconv.Itoa(resp.StatusCode), t.retryAfter(resp)
+}
+
+// isRateLimit prüft, ob der Grund eines Fehlers (zB aus dem Body einer 403 Antwort) ein Rate-Limit ist.
+// Drive verwendet dafür userRateLimitExceeded und rateLimitExceeded.
+func isRateLimit(reason string) bool {
+	return strings.Contains(reason, "RateLimitExceeded") || strings.Contains(reason, "rateLimitExceeded")
+}
+
+// Retryable prüft, ob ein Fehler der Drive API vorübergehend ist (429, 5xx, Rate-Limit oder ein Verbindungsfehler).
+// Andere Fehler der API (zB 400, 401, 404 oder fehlende Berechtigungen) ändern sich durch eine Wiederholung nicht.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		if apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= 500 {
+			return true
+		}
+		if apiErr.Code == http.StatusForbidden {
+			for _, item := range apiErr.Errors {
+				if isRateLimit(item.Reason) {
+					return true
+				}
+			}
+			return isRateLimit(apiErr.Body)
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryAfter wertet den Retry-After Header aus (Sekunden oder ein HTTP Datum), max. maxBackoff.
+func (t *retryTransport) retryAfter(resp *http.Response) time.Duration {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		wait = time.Until(at)
+	}
+	if wait > t.maxBackoff {
+		wait = t.maxBackoff
+	}
+	return wait
+}
+
+// backoff berechnet die Wartezeit vor dem nächsten Versuch (siehe middleware.Backoff).
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	return middleware.Backoff(attempt, t.minBackoff, t.maxBackoff)
+}
+
+// noRetryKey markiert einen ctx, in dem retryTransport nicht wiederholt (siehe withoutRetry).
+type noRetryKey struct{}
+
+// withoutRetry gibt einen ctx zurück, in dem die Requests nicht einzeln wiederholt werden.
+// So werden Wiederholungen nicht vervielfacht, wenn der Aufrufer selbst wiederholt.
+func withoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
@@ -0,0 +1,212 @@
+package drive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// testTransport erzeugt einen retryTransport mit kurzen Wartezeiten für die Tests.
+func testTransport(qps float64) *retryTransport {
+	t := newRetryTransport(nil, qps)
+	t.minBackoff = time.Millisecond
+	t.maxBackoff = 10 * time.Millisecond
+	return t
+}
+
+// failingServer antwortet auf die ersten fails Requests mit status und body, danach mit 200.
+// Die Anzahl der Requests und die empfangenen Bodies werden gezählt bzw. gesammelt.
+func failingServer(t *testing.T, fails int32, status int, body string) (*httptest.Server, *int32, *[]string) {
+	var count int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if atomic.AddInt32(&count, 1) <= fails {
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &count, &bodies
+}
+
+func TestRetryTransport(t *testing.T) {
+	srv, count, bodies := failingServer(t, 2, http.StatusServiceUnavailable, "")
+	client := &http.Client{Transport: testTransport(0)}
+
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(b) != "ok" || *count != 3 {
+		t.Fatalf("got %d %q after %d requests", resp.StatusCode, b, *count)
+	}
+	for _, body := range *bodies {
+		if body != "payload" {
+			t.Fatalf("body not replayed: %q", *bodies)
+		}
+	}
+}
+
+func TestRetryTransport_MaxRetries(t *testing.T) {
+	srv, count, _ := failingServer(t, 100, http.StatusTooManyRequests, "slow down")
+	transport := testTransport(0)
+	transport.maxRetries = 2
+
+	resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if b, _ := ioutil.ReadAll(resp.Body); resp.StatusCode != 429 || string(b) != "slow down" || *count != 3 {
+		t.Fatalf("got %d %q after %d requests", resp.StatusCode, b, *count)
+	}
+}
+
+func TestRetryTransport_Forbidden(t *testing.T) {
+	// Rate-Limit wird wiederholt
+	srv, count, _ := failingServer(t, 1, http.StatusForbidden, `{"error":{"errors":[{"reason":"userRateLimitExceeded"}]}}`)
+	resp, err := (&http.Client{Transport: testTransport(0)}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || *count != 2 {
+		t.Fatalf("rate limit: got %d after %d requests", resp.StatusCode, *count)
+	}
+
+	// fehlende Berechtigungen nicht, der Body bleibt für den Aufrufer erhalten
+	body := `{"error":{"errors":[{"reason":"insufficientPermissions"}]}}`
+	srv, count, _ = failingServer(t, 1, http.StatusForbidden, body)
+	resp, err = (&http.Client{Transport: testTransport(0)}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if b, _ := ioutil.ReadAll(resp.Body); resp.StatusCode != 403 || string(b) != body || *count != 1 {
+		t.Fatalf("permissions: got %d %q after %d requests", resp.StatusCode, b, *count)
+	}
+}
+
+func TestRetryTransport_NotReplayable(t *testing.T) {
+	srv, count, _ := failingServer(t, 1, http.StatusInternalServerError, "")
+
+	// ohne GetBody kann der Body nicht erneut gesendet werden
+	req, _ := http.NewRequest("POST", srv.URL, ioutil.NopCloser(bytes.NewReader([]byte("stream"))))
+	resp, err := (&http.Client{Transport: testTransport(0)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 500 || *count != 1 {
+		t.Fatalf("got %d after %d requests", resp.StatusCode, *count)
+	}
+}
+
+func TestRetryTransport_Context(t *testing.T) {
+	srv, count, _ := failingServer(t, 100, http.StatusServiceUnavailable, "")
+	transport := testTransport(0)
+	transport.minBackoff = time.Hour
+	transport.maxBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	start := time.Now()
+	if _, err := (&http.Client{Transport: transport}).Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second || *count != 1 {
+		t.Fatalf("backoff not interrupted: %v, %d requests", time.Since(start), *count)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	transport := newRetryTransport(nil, 0)
+	tests := []struct {
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"", 0, 0},
+		{"3", 3 * time.Second, 3 * time.Second},
+		{"100000", MaxBackoff, MaxBackoff},
+		{time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+		{"garbage", 0, 0},
+	}
+	for _, test := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if test.header != "" {
+			resp.Header.Set("Retry-After", test.header)
+		}
+		if wait := transport.retryAfter(resp); wait < test.min || wait > test.max {
+			t.Errorf("retryAfter(%q) = %v, want %v-%v", test.header, wait, test.min, test.max)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	transport := newRetryTransport(nil, 0)
+	for attempt := 0; attempt < 100; attempt++ {
+		max := MaxBackoff
+		if attempt < 6 {
+			max = MinBackoff << uint(attempt)
+		}
+		if wait := transport.backoff(attempt); wait < max/2 || wait > max {
+			t.Errorf("backoff(%d) = %v, want %v-%v", attempt, wait, max/2, max)
+		}
+	}
+}
+
+func TestRetryTransport_WithoutRetry(t *testing.T) {
+	srv, count, _ := failingServer(t, 1, http.StatusServiceUnavailable, "")
+	req, err := http.NewRequestWithContext(withoutRetry(context.Background()), http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: testTransport(0)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || *count != 1 {
+		t.Fatalf("got %d after %d requests", resp.StatusCode, *count)
+	}
+}
+
+func TestRetryableError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&googleapi.Error{Code: 500}, true},
+		{&googleapi.Error{Code: 429}, true},
+		{fmt.Errorf("upload error: %w", &googleapi.Error{Code: 503}), true},
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, true},
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "insufficientPermissions"}}}, false},
+		{&googleapi.Error{Code: 404}, false},
+		{errors.New("disk error"), false},
+		{context.Canceled, false},
+	}
+	for _, test := range tests {
+		if got := Retryable(test.err); got != test.want {
+			t.Errorf("Retryable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
@@ -1,10 +1,16 @@
 package backbone
 
 import (
+	"context"
 	"io"
 )
 
 // Client ist ein Interface um auf Speicher wie Google Drive oder der lokalen Festplatte zuzugreifen.
+// Alle Methoden müssen gleichzeitig (aus mehreren goroutines) aufgerufen werden können, da das FUSE multi-threaded läuft.
+//
+// Zu jeder Methode mit Zugriff auf den Speicher gibt es eine Variante mit context.Context (zB ReadContext).
+// Wird der ctx beendet, dann muss die Methode (bzw. der zurückgegebene Stream) mit dem Fehler des ctx abbrechen.
+// Die Methoden ohne ctx entsprechen einem Aufruf mit context.Background().
 type Client interface {
 	// Read erlaubt den lesenden Zugriff auf eine Datei (identifiziert über die fileId).
 	// Der offset erlaubt es, das Lesen an einer beliebigen Stelle zu beginnen (default 0)
@@ -12,10 +18,12 @@ type Client interface {
 	// Dabei kann der Stream bereits früher mit EOF enden! (default 20.000.000.000)
 	// ACHTUNG: Am Ende .Close() nicht vergessen!
 	Read(fileId string, offset int64, fileSize int64) (io.ReadCloser, error)
+	ReadContext(ctx context.Context, fileId string, offset int64, fileSize int64) (io.ReadCloser, error)
 
 	// Trash verschiebt das angegebene Objekt in den Papierkorb und ist dann über den Client nicht mehr erreichbar.
 	// ACHTUNG: Es ist implementationsabhängig, ob das Objekt wiederhergestellt werden kann! (Für Google Drive gilt: JA)
 	Trash(fileId string) error
+	TrashContext(ctx context.Context, fileId string) error
 
 	// Save speichert die als Stream übergebenen Bytes als Datei ab.
 	// Der fileName darf, je nach Implementation, mehrfach existieren.
@@ -24,15 +32,18 @@ type Client interface {
 	// Stream gelesen werden dürfen. 0 bedeutet dabei, lesen bis zu EOF.
 	// Bei Erfolg wird die fileId der geschriebenen Datei zurück gegeben!
 	Save(fileName string, file io.Reader, maxRead int64) (string, error)
+	SaveContext(ctx context.Context, fileName string, file io.Reader, maxRead int64) (string, error)
 
 	// InitFileList liest alle Dateien des "Speichers" ein und schreibt sie in eine interne Liste.
 	// Diese Methode kann SEHR LANGSAM sein und muss MINDESTENS EINMAL aufgerufen werden!
 	InitFileList() error
+	InitFileListContext(ctx context.Context) error
 
 	// UpdateFileList aktualisiert die interne Liste, die durch InitFileList() erstellt wurde.
 	// Diese Methode ist wesentlich performanter und lädt lediglich ein Delta (bei Google Drive).
 	// Achtung: Es muss jedoch mindestens einmal InitFileList() aufgerufen worden sein!
 	UpdateFileList() error
+	UpdateFileListContext(ctx context.Context) error
 
 	// FileList gibt die interne Liste mit Dateien zurück.
 	// Diese Methode ist offline und greift lediglich auf zwischengespeicherte Informationen zurück.
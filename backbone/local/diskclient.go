@@ -1,21 +1,32 @@
 package local
 
 import (
+	"context"
 	"encoding/base64"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"sync"
 
 	"splitfuseX/backbone"
 )
 
 type DiskClient struct {
 	localFolder string
+	mutex       *sync.RWMutex // schützt fileList (die map selbst wird nach dem Setzen nicht mehr verändert)
 	fileList    map[string]*backbone.FileObject
 }
 
 func (client *DiskClient) Read(fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	return client.ReadContext(context.Background(), fileId, offset, fileSize)
+}
+
+func (client *DiskClient) ReadContext(ctx context.Context, fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// get path
 	name, err := base64.StdEncoding.DecodeString(fileId)
 	if err != nil {
@@ -32,14 +43,22 @@ func (client *DiskClient) Read(fileId string, offset int64, fileSize int64) (io.
 	// offset
 	_, err = f.Seek(offset, 0)
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
 
-	// return
-	return f, nil
+	// return (gelesene Bytes zählen, beim Ende des ctx abbrechen)
+	return backbone.CountReads("local", backbone.ContextReadCloser(ctx, f)), nil
 }
 
 func (client *DiskClient) Trash(fileId string) error {
+	return client.TrashContext(context.Background(), fileId)
+}
+
+func (client *DiskClient) TrashContext(ctx context.Context, fileId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	name, err := base64.StdEncoding.DecodeString(fileId)
 	if err != nil {
 		return err
@@ -50,6 +69,14 @@ func (client *DiskClient) Trash(fileId string) error {
 }
 
 func (client *DiskClient) Save(fileName string, file io.Reader, maxRead int64) (string, error) {
+	return client.SaveContext(context.Background(), fileName, file, maxRead)
+}
+
+func (client *DiskClient) SaveContext(ctx context.Context, fileName string, file io.Reader, maxRead int64) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
 	// get path
 	p := path.Join(client.localFolder, string(fileName))
 
@@ -64,8 +91,11 @@ func (client *DiskClient) Save(fileName string, file io.Reader, maxRead int64) (
 	if maxRead > 0 {
 		file = io.LimitReader(file, maxRead)
 	}
-	_, err = io.Copy(writer, file)
+	_, err = io.Copy(writer, backbone.ContextReader(ctx, file))
 	if err != nil {
+		// unvollständige Datei entfernen (zB nach dem Ende des ctx)
+		writer.Close()
+		os.Remove(p)
 		return "", err
 	}
 
@@ -75,6 +105,13 @@ func (client *DiskClient) Save(fileName string, file io.Reader, maxRead int64) (
 }
 
 func (client *DiskClient) InitFileList() error {
+	return client.InitFileListContext(context.Background())
+}
+
+func (client *DiskClient) InitFileListContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	files, err := ioutil.ReadDir(client.localFolder)
 	if err != nil {
 		return err
@@ -92,16 +129,24 @@ func (client *DiskClient) InitFileList() error {
 			}
 		}
 	}
+	client.mutex.Lock()
 	client.fileList = list
+	client.mutex.Unlock()
 
 	return nil
 }
 
 func (client *DiskClient) UpdateFileList() error {
+	return client.UpdateFileListContext(context.Background())
+}
+
+func (client *DiskClient) UpdateFileListContext(ctx context.Context) error {
 	// InitFileList
-	return client.InitFileList()
+	return client.InitFileListContext(ctx)
 }
 
 func (client *DiskClient) FileList() map[string]*backbone.FileObject {
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
 	return client.fileList
 }
@@ -1,6 +1,7 @@
 package local
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
 	"io/ioutil"
@@ -122,3 +123,44 @@ func TestNewDiskClient(t *testing.T) {
 		t.Errorf("file lists not correct: l1=%d, l2=%d, l3=%d", list1, list2, list3)
 	}
 }
+
+// TESTS:
+// - ReadContext()
+// - SaveContext()
+// - InitFileListContext()
+func TestDiskClientContext(t *testing.T) {
+	client := NewDiskClient(t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	fileId, err := client.SaveContext(ctx, "test.txt", strings.NewReader("0123456789"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.ReadContext(ctx, fileId, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Close()
+	b := make([]byte, 4)
+	if n, err := resp.Read(b); err != nil || string(b[:n]) != "0123" {
+		t.Fatalf("read: %q, %v", b[:n], err)
+	}
+
+	// nach dem Ende des ctx bricht alles ab
+	cancel()
+	if _, err := resp.Read(b); err != context.Canceled {
+		t.Errorf("read after cancel: %v", err)
+	}
+	if _, err := client.ReadContext(ctx, fileId, 0, 10); err != context.Canceled {
+		t.Errorf("ReadContext: %v", err)
+	}
+	if _, err := client.SaveContext(ctx, "other.txt", strings.NewReader("x"), 0); err != context.Canceled {
+		t.Errorf("SaveContext: %v", err)
+	}
+	if err := client.InitFileListContext(ctx); err != context.Canceled {
+		t.Errorf("InitFileListContext: %v", err)
+	}
+	if err := client.TrashContext(ctx, fileId); err != context.Canceled {
+		t.Errorf("TrashContext: %v", err)
+	}
+}
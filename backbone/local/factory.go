@@ -1,12 +1,14 @@
 package local
 
 import (
+	"sync"
+
 	"splitfuseX/backbone"
 )
 
 // NewDiskClient speichert die Daten in dem übergebenen Ordner
 func NewDiskClient(path string) backbone.Client {
 	var ret *DiskClient
-	ret = &DiskClient{localFolder: path}
+	ret = &DiskClient{localFolder: path, mutex: &sync.RWMutex{}}
 	return ret
 }
@@ -0,0 +1,30 @@
+package backbone
+
+import (
+	"io"
+
+	"splitfuseX/metrics"
+)
+
+// readBytes zählt die aus dem Speicher gelesenen Bytes je Backbone (siehe CountReads).
+var readBytes = metrics.Default.NewCounter("splitfusex_backbone_read_bytes_total", "Aus dem Speicher gelesene Bytes", "backbone")
+
+// CountReads zählt alle Bytes, die vom ReadCloser gelesen werden (Metrik splitfusex_backbone_read_bytes_total).
+// Jede Implementierung von Client.Read() sollte den zurückgegebenen ReadCloser damit umhüllen.
+func CountReads(backboneName string, r io.ReadCloser) io.ReadCloser {
+	return &countingReader{ReadCloser: r, backbone: backboneName}
+}
+
+// countingReader zählt die gelesenen Bytes.
+type countingReader struct {
+	io.ReadCloser
+	backbone string
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		readBytes.Add(float64(n), r.backbone)
+	}
+	return n, err
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"splitfuseX/backbone"
+)
+
+// FileListCache speichert das Ergebnis von FileList zwischen (read-through): Erst der nächste Aufruf
+// nach InitFileList, UpdateFileList, Save oder Trash liest die FileList erneut aus dem Client.
+// Mit maxAge > 0 wird UpdateFileList übersprungen, solange die letzte Aktualisierung jünger ist
+// und seitdem nichts gespeichert oder gelöscht wurde.
+// ACHTUNG: Die zurückgegebene map wird von allen Aufrufern geteilt und darf nicht verändert werden!
+func FileListCache(maxAge time.Duration) Middleware {
+	return func(client backbone.Client) backbone.Client {
+		return &cachedClient{Client: client, maxAge: maxAge, mutex: &sync.Mutex{}}
+	}
+}
+
+// cachedClient ist ein backbone.Client mit zwischengespeicherter FileList (siehe FileListCache).
+type cachedClient struct {
+	backbone.Client
+	maxAge time.Duration
+
+	mutex   *sync.Mutex                     // schützt list, updated und stale
+	list    map[string]*backbone.FileObject // nil bedeutet, dass die FileList neu gelesen werden muss
+	updated time.Time                       // letzte erfolgreiche Aktualisierung (InitFileList oder UpdateFileList)
+	stale   bool                            // wurde seit der letzten Aktualisierung gespeichert oder gelöscht?
+}
+
+func (c *cachedClient) FileList() map[string]*backbone.FileObject {
+	// LOCK
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.list == nil {
+		c.list = c.Client.FileList()
+	}
+	return c.list
+}
+
+func (c *cachedClient) InitFileList() error {
+	return c.InitFileListContext(context.Background())
+}
+
+func (c *cachedClient) InitFileListContext(ctx context.Context) error {
+	if err := c.Client.InitFileListContext(ctx); err != nil {
+		return err
+	}
+	c.refreshed()
+	return nil
+}
+
+func (c *cachedClient) UpdateFileList() error {
+	return c.UpdateFileListContext(context.Background())
+}
+
+func (c *cachedClient) UpdateFileListContext(ctx context.Context) error {
+	// LOCK / UNLOCK
+	c.mutex.Lock()
+	fresh := c.maxAge > 0 && !c.stale && !c.updated.IsZero() && time.Since(c.updated) < c.maxAge
+	c.mutex.Unlock()
+	if fresh {
+		return ctx.Err()
+	}
+
+	if err := c.Client.UpdateFileListContext(ctx); err != nil {
+		return err
+	}
+	c.refreshed()
+	return nil
+}
+
+func (c *cachedClient) Save(fileName string, file io.Reader, maxRead int64) (string, error) {
+	return c.SaveContext(context.Background(), fileName, file, maxRead)
+}
+
+func (c *cachedClient) SaveContext(ctx context.Context, fileName string, file io.Reader, maxRead int64) (string, error) {
+	defer c.invalidate()
+	return c.Client.SaveContext(ctx, fileName, file, maxRead)
+}
+
+func (c *cachedClient) Trash(fileId string) error {
+	return c.TrashContext(context.Background(), fileId)
+}
+
+func (c *cachedClient) TrashContext(ctx context.Context, fileId string) error {
+	defer c.invalidate()
+	return c.Client.TrashContext(ctx, fileId)
+}
+
+// refreshed verwirft die zwischengespeicherte FileList nach einer erfolgreichen Aktualisierung.
+func (c *cachedClient) refreshed() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.list = nil
+	c.updated = time.Now()
+	c.stale = false
+}
+
+// invalidate verwirft die zwischengespeicherte FileList nach Save oder Trash.
+// Das nächste UpdateFileList wird dann auf jeden Fall ausgeführt.
+func (c *cachedClient) invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.list = nil
+	c.stale = true
+}
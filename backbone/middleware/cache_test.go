@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"splitfuseX/backbone"
+	"splitfuseX/backbone/local"
+)
+
+// countingClient zählt die Aufrufe von FileList und UpdateFileList.
+type countingClient struct {
+	backbone.Client
+	fileLists int
+	updates   int
+}
+
+func (c *countingClient) FileList() map[string]*backbone.FileObject {
+	c.fileLists++
+	return c.Client.FileList()
+}
+
+func (c *countingClient) UpdateFileListContext(ctx context.Context) error {
+	c.updates++
+	return c.Client.UpdateFileListContext(ctx)
+}
+
+func TestFileListCache(t *testing.T) {
+	inner := &countingClient{Client: local.NewDiskClient(t.TempDir())}
+	client := Chain(inner, FileListCache(time.Hour))
+	if err := client.InitFileList(); err != nil {
+		t.Fatal(err)
+	}
+
+	// read-through
+	for i := 0; i < 10; i++ {
+		if len(client.FileList()) != 0 {
+			t.Fatal("expected an empty file list")
+		}
+	}
+	if inner.fileLists != 1 {
+		t.Fatalf("FileList read %d times", inner.fileLists)
+	}
+
+	// UpdateFileList wird übersprungen, solange die Liste frisch ist
+	client.UpdateFileList()
+	if inner.updates != 0 {
+		t.Fatalf("fresh update should be skipped: %d", inner.updates)
+	}
+
+	// nach Save nicht mehr
+	if _, err := client.Save("a", strings.NewReader("hello"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UpdateFileList(); err != nil {
+		t.Fatal(err)
+	}
+	if list := client.FileList(); len(list) != 1 || inner.updates != 1 || inner.fileLists != 2 {
+		t.Fatalf("after save: %d files, %d updates, %d reads", len(list), inner.updates, inner.fileLists)
+	}
+
+	// ohne maxAge wird immer aktualisiert
+	inner = &countingClient{Client: local.NewDiskClient(t.TempDir())}
+	client = Chain(inner, FileListCache(0))
+	client.InitFileList()
+	client.UpdateFileList()
+	client.UpdateFileList()
+	if inner.updates != 2 {
+		t.Fatalf("updates without maxAge: %d", inner.updates)
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"splitfuseX/backbone"
+	"splitfuseX/logging"
+)
+
+// ErrInjected ist der Fehler, den Faults erzeugt (eingebettet, prüfbar mit errors.Is).
+var ErrInjected = errors.New("injected fault")
+
+// Faults erzeugt Fehler und Verzögerungen beim Zugriff auf den Speicher, um zB Retry oder das FUSE zu testen.
+// Ein erzeugter Fehler wird zurückgegeben, ohne den Client aufzurufen.
+type Faults struct {
+	mutex    *sync.Mutex // schützt rand, failNext und injected
+	rand     *rand.Rand
+	rate     float64
+	latency  time.Duration
+	failNext map[string]int // so viele der nächsten Aufrufe je Methode schlagen fehl
+	injected int
+}
+
+// NewFaults erzeugt Faults: Jeder Zugriff schlägt mit der Wahrscheinlichkeit rate (0 bis 1) fehl
+// und wird vorher um latency verzögert.
+func NewFaults(rate float64, latency time.Duration) *Faults {
+	return &Faults{
+		mutex:    &sync.Mutex{},
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		rate:     rate,
+		latency:  latency,
+		failNext: make(map[string]int),
+	}
+}
+
+// FailNext lässt die nächsten n Aufrufe der Methode (zB MethodSave) fehlschlagen.
+func (f *Faults) FailNext(method string, n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.failNext[method] += n
+}
+
+// Injected gibt die Anzahl der bisher erzeugten Fehler zurück.
+func (f *Faults) Injected() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.injected
+}
+
+// Middleware gibt die Middleware zurück. Alle damit umhüllten Clients teilen sich die Einstellungen.
+func (f *Faults) Middleware() Middleware {
+	return func(client backbone.Client) backbone.Client {
+		return &decorator{Client: client, around: func(ctx context.Context, method string, replayable bool, call func() error) error {
+			if err := Sleep(ctx, f.latency); err != nil {
+				return err
+			}
+			if f.fail(method) {
+				logging.Debug("backbone: injected fault", logging.F("method", method))
+				return fmt.Errorf("%s: %w", method, ErrInjected)
+			}
+			return call()
+		}}
+	}
+}
+
+// fail entscheidet, ob der Aufruf fehlschlagen soll.
+func (f *Faults) fail(method string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	fail := false
+	if f.failNext[method] > 0 {
+		f.failNext[method]--
+		fail = true
+	} else if f.rate > 0 && f.rand.Float64() < f.rate {
+		fail = true
+	}
+	if fail {
+		f.injected++
+	}
+	return fail
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"splitfuseX/backbone/local"
+)
+
+func TestFaults(t *testing.T) {
+	// immer
+	always := NewFaults(1, 0)
+	client := Chain(local.NewDiskClient(t.TempDir()), always.Middleware())
+	for i := 0; i < 10; i++ {
+		if _, err := client.Save("a", strings.NewReader("x"), 0); !errors.Is(err, ErrInjected) {
+			t.Fatalf("expected injected fault, got %v", err)
+		}
+	}
+	if always.Injected() != 10 {
+		t.Fatalf("injected %d faults", always.Injected())
+	}
+
+	// nie, nur FailNext
+	never := NewFaults(0, 0)
+	client = Chain(local.NewDiskClient(t.TempDir()), never.Middleware())
+	never.FailNext(MethodTrash, 1)
+	if err := client.Trash("x"); !errors.Is(err, ErrInjected) {
+		t.Fatalf("expected injected fault, got %v", err)
+	}
+	if err := client.InitFileList(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verzögerung (abbrechbar)
+	slow := NewFaults(0, time.Hour)
+	client = Chain(local.NewDiskClient(t.TempDir()), slow.Middleware())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.InitFileListContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
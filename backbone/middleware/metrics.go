@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"splitfuseX/backbone"
+	"splitfuseX/metrics"
+)
+
+var (
+	requests        = metrics.Default.NewCounter("splitfusex_backbone_requests_total", "Zugriffe auf den Speicher je Backbone, Methode und Ergebnis (ok, error oder canceled)", "backbone", "method", "result")
+	requestDuration = metrics.Default.NewHistogram("splitfusex_backbone_request_duration_seconds", "Dauer der Zugriffe auf den Speicher je Backbone und Methode", metrics.DefBuckets, "backbone", "method")
+)
+
+// Metrics zählt alle Zugriffe auf den Speicher und misst ihre Dauer (Metriken splitfusex_backbone_requests_total
+// und splitfusex_backbone_request_duration_seconds). Bei Read wird nur das Öffnen des Streams gemessen.
+func Metrics(backboneName string) Middleware {
+	return func(client backbone.Client) backbone.Client {
+		return &decorator{Client: client, around: func(ctx context.Context, method string, replayable bool, f func() error) error {
+			start := time.Now()
+			err := f()
+			requestDuration.Observe(time.Since(start).Seconds(), backboneName, method)
+			requests.Inc(backboneName, method, result(err))
+			return err
+		}}
+	}
+}
+
+// result gibt das Label für das Ergebnis eines Zugriffs zurück.
+func result(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"splitfuseX/backbone/local"
+	"splitfuseX/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	faults := NewFaults(0, 0)
+	client := Chain(local.NewDiskClient(t.TempDir()), Metrics("test"), faults.Middleware())
+
+	client.Save("a", strings.NewReader("hello"), 0)
+	faults.FailNext(MethodSave, 1)
+	client.Save("b", strings.NewReader("hello"), 0)
+
+	var buf bytes.Buffer
+	metrics.Default.WriteTo(&buf)
+	for _, want := range []string{
+		`splitfusex_backbone_requests_total{backbone="test",method="Save",result="ok"} 1`,
+		`splitfusex_backbone_requests_total{backbone="test",method="Save",result="error"} 1`,
+		`splitfusex_backbone_request_duration_seconds_count{backbone="test",method="Save"} 2`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("%q missing in metrics", want)
+		}
+	}
+}
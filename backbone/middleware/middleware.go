@@ -0,0 +1,146 @@
+// Package middleware enthält Decorators für backbone.Client, die beliebig kombiniert werden können:
+// Wiederholungen mit backoff (Retry), Metriken (Metrics), ein Limit für Requests pro Sekunde (RateLimit),
+// eine zwischengespeicherte FileList (FileListCache) und Fehler für Tests (Faults).
+// Damit muss nicht jede Implementierung von backbone.Client diese Funktionen selbst mitbringen.
+package middleware
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"splitfuseX/backbone"
+)
+
+// Die Namen der Methoden mit Zugriff auf den Speicher (zB für Labels der Metriken und Faults.FailNext).
+const (
+	MethodRead           = "Read"
+	MethodTrash          = "Trash"
+	MethodSave           = "Save"
+	MethodInitFileList   = "InitFileList"
+	MethodUpdateFileList = "UpdateFileList"
+)
+
+// Middleware umhüllt einen backbone.Client mit zusätzlicher Funktionalität.
+type Middleware func(backbone.Client) backbone.Client
+
+// Chain umhüllt den Client mit allen Middlewares. Die erste Middleware ist dabei die äußerste,
+// sieht also jeden Aufruf zuerst. nil wird ignoriert.
+func Chain(client backbone.Client, middlewares ...Middleware) backbone.Client {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] != nil {
+			client = middlewares[i](client)
+		}
+	}
+	return client
+}
+
+// aroundFunc wird um jeden Zugriff auf den Speicher gelegt und muss f (ggf. mehrfach) aufrufen.
+// replayable ist false, wenn f nicht wiederholt werden kann (Save mit einem Stream, der kein io.Seeker ist).
+type aroundFunc func(ctx context.Context, method string, replayable bool, f func() error) error
+
+// decorator ist ein backbone.Client, der jeden Zugriff auf den Speicher durch around leitet.
+// FileList wird unverändert weitergegeben. Die Methoden ohne ctx verwenden context.Background().
+type decorator struct {
+	backbone.Client
+	around aroundFunc
+}
+
+func (d *decorator) Read(fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	return d.ReadContext(context.Background(), fileId, offset, fileSize)
+}
+
+func (d *decorator) ReadContext(ctx context.Context, fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	var r io.ReadCloser
+	err := d.around(ctx, MethodRead, true, func() error {
+		var err error
+		r, err = d.Client.ReadContext(ctx, fileId, offset, fileSize)
+		return err
+	})
+	if err != nil {
+		if r != nil {
+			r.Close()
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+func (d *decorator) Trash(fileId string) error {
+	return d.TrashContext(context.Background(), fileId)
+}
+
+func (d *decorator) TrashContext(ctx context.Context, fileId string) error {
+	return d.around(ctx, MethodTrash, true, func() error {
+		return d.Client.TrashContext(ctx, fileId)
+	})
+}
+
+func (d *decorator) Save(fileName string, file io.Reader, maxRead int64) (string, error) {
+	return d.SaveContext(context.Background(), fileName, file, maxRead)
+}
+
+// SaveContext kann nur wiederholt werden, wenn der Stream ein io.Seeker ist. Vor jeder Wiederholung wird er zurückgespult.
+func (d *decorator) SaveContext(ctx context.Context, fileName string, file io.Reader, maxRead int64) (string, error) {
+	seeker, _ := file.(io.Seeker)
+	var start int64
+	if seeker != nil {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seeker = nil
+		}
+	}
+
+	var fileId string
+	attempt := 0
+	err := d.around(ctx, MethodSave, seeker != nil, func() error {
+		if attempt > 0 && seeker != nil {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		attempt++
+		var err error
+		fileId, err = d.Client.SaveContext(ctx, fileName, file, maxRead)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return fileId, nil
+}
+
+func (d *decorator) InitFileList() error {
+	return d.InitFileListContext(context.Background())
+}
+
+func (d *decorator) InitFileListContext(ctx context.Context) error {
+	return d.around(ctx, MethodInitFileList, true, func() error {
+		return d.Client.InitFileListContext(ctx)
+	})
+}
+
+func (d *decorator) UpdateFileList() error {
+	return d.UpdateFileListContext(context.Background())
+}
+
+func (d *decorator) UpdateFileListContext(ctx context.Context) error {
+	return d.around(ctx, MethodUpdateFileList, true, func() error {
+		return d.Client.UpdateFileListContext(ctx)
+	})
+}
+
+// Sleep wartet die Dauer d ab, bricht aber ab, sobald der ctx beendet wird.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"splitfuseX/backbone"
+	"splitfuseX/backbone/local"
+)
+
+// recorder merkt sich die Reihenfolge, in der die Middlewares aufgerufen werden.
+func recorder(name string, calls *[]string) Middleware {
+	return func(client backbone.Client) backbone.Client {
+		return &decorator{Client: client, around: func(ctx context.Context, method string, replayable bool, f func() error) error {
+			*calls = append(*calls, name+":"+method)
+			return f()
+		}}
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	disk := local.NewDiskClient(t.TempDir())
+	client := Chain(disk, recorder("outer", &calls), nil, recorder("inner", &calls))
+
+	fileId, err := client.Save("a", strings.NewReader("hello"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, ",") != "outer:Save,inner:Save" {
+		t.Fatalf("unexpected order: %v", calls)
+	}
+
+	// alle Methoden (auch ohne ctx) laufen durch die Middlewares
+	calls = nil
+	if err := client.InitFileList(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UpdateFileList(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := client.Read(fileId, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(b) != "hello" {
+		t.Fatalf("read %q", b)
+	}
+	if len(client.FileList()) != 1 {
+		t.Fatalf("unexpected file list: %v", client.FileList())
+	}
+	if err := client.Trash(fileId); err != nil {
+		t.Fatal(err)
+	}
+	want := "outer:InitFileList,inner:InitFileList,outer:UpdateFileList,inner:UpdateFileList,outer:Read,inner:Read,outer:Trash,inner:Trash"
+	if strings.Join(calls, ",") != want {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+
+	// ohne Middlewares bleibt der Client unverändert
+	if Chain(disk) != disk {
+		t.Fatal("empty chain should return the client")
+	}
+}
+
+func TestDecoratorSaveReplayable(t *testing.T) {
+	var replayable []bool
+	client := Chain(local.NewDiskClient(t.TempDir()), func(client backbone.Client) backbone.Client {
+		return &decorator{Client: client, around: func(ctx context.Context, method string, r bool, f func() error) error {
+			replayable = append(replayable, r)
+			return f()
+		}}
+	})
+	client.Save("seeker", strings.NewReader("data"), 0)
+	client.Save("stream", io.MultiReader(strings.NewReader("data")), 0)
+	if len(replayable) != 2 || !replayable[0] || replayable[1] {
+		t.Fatalf("unexpected replayable: %v", replayable)
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"splitfuseX/backbone"
+)
+
+// RateLimit verteilt die Zugriffe auf den Speicher gleichmäßig, sodass max. qps Zugriffe pro Sekunde gestartet werden.
+// Das Limit gilt für alle Methoden zusammen (außer FileList). qps <= 0 deaktiviert RateLimit.
+// Bei einer Kombination mit Retry sollte RateLimit innen liegen, damit auch jede Wiederholung zählt.
+func RateLimit(qps float64) Middleware {
+	if qps <= 0 {
+		return nil
+	}
+	return func(client backbone.Client) backbone.Client {
+		limiter := NewRateLimiter(qps)
+		return &decorator{Client: client, around: func(ctx context.Context, method string, replayable bool, f func() error) error {
+			if err := limiter.Wait(ctx); err != nil {
+				return err
+			}
+			return f()
+		}}
+	}
+}
+
+// RateLimiter verteilt Zugriffe gleichmäßig, sodass max. qps Zugriffe pro Sekunde gestartet werden.
+// Er wird auch direkt von Clients verwendet, die einzelne Requests begrenzen (zB drive).
+type RateLimiter struct {
+	mutex    *sync.Mutex // schützt next
+	interval time.Duration
+	next     time.Time // frühester Zeitpunkt für den nächsten Zugriff
+}
+
+// NewRateLimiter erzeugt einen RateLimiter. qps <= 0 bedeutet unbegrenzt.
+func NewRateLimiter(qps float64) *RateLimiter {
+	var interval time.Duration
+	if qps > 0 {
+		interval = time.Duration(float64(time.Second) / qps)
+	}
+	return &RateLimiter{mutex: &sync.Mutex{}, interval: interval}
+}
+
+// Wait wartet, bis der nächste Zugriff gestartet werden darf (oder der ctx beendet wird).
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+
+	// LOCK / UNLOCK
+	l.mutex.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mutex.Unlock()
+
+	return Sleep(ctx, at.Sub(now))
+}
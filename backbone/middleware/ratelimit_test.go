@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"splitfuseX/backbone/local"
+)
+
+func TestRateLimit(t *testing.T) {
+	client := Chain(local.NewDiskClient(t.TempDir()), RateLimit(100))
+
+	// 11 Zugriffe bei 100 pro Sekunde: 10 Abstände zu je 10ms
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		if err := client.UpdateFileList(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("11 calls at 100 qps took only %v", elapsed)
+	}
+
+	// FileList greift nicht auf den Speicher zu
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		client.FileList()
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("FileList should not be limited: %v", elapsed)
+	}
+
+	// abbrechen
+	slow := Chain(local.NewDiskClient(t.TempDir()), RateLimit(0.001))
+	slow.UpdateFileList()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := slow.UpdateFileListContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// unbegrenzt
+	start = time.Now()
+	unlimited := NewRateLimiter(0)
+	for i := 0; i < 1000; i++ {
+		unlimited.Wait(context.Background())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("unlimited limiter took %v", elapsed)
+	}
+
+	if RateLimit(0) != nil {
+		t.Fatal("RateLimit(0) should be disabled")
+	}
+}
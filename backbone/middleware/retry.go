@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"time"
+
+	"splitfuseX/backbone"
+	"splitfuseX/logging"
+	"splitfuseX/metrics"
+)
+
+// retries zählt die Wiederholungen je Methode (siehe Retry).
+var retries = metrics.Default.NewCounter("splitfusex_backbone_retries_total", "Wiederholte Zugriffe auf den Speicher je Methode", "method")
+
+// RetryOptions sind die Einstellungen für Retry.
+type RetryOptions struct {
+	MaxRetries int                  // wie oft ein Zugriff nach einem Fehler wiederholt wird (0 deaktiviert Retry)
+	MinBackoff time.Duration        // Wartezeit vor der ersten Wiederholung, sie verdoppelt sich mit jedem Versuch (default 1s)
+	MaxBackoff time.Duration        // max. Wartezeit zwischen zwei Versuchen (default 30s)
+	Retryable  func(err error) bool // welche Fehler wiederholt werden (default Retryable)
+}
+
+// Retry wiederholt fehlgeschlagene Zugriffe auf den Speicher mit exponential backoff und jitter.
+// Bei Read wird nur das Öffnen des Streams wiederholt, nicht ein Fehler beim späteren Lesen.
+// Save wird nur wiederholt, wenn der Stream ein io.Seeker ist.
+func Retry(opts RetryOptions) Middleware {
+	if opts.MaxRetries <= 0 {
+		return nil
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 1 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	if opts.Retryable == nil {
+		opts.Retryable = Retryable
+	}
+
+	return func(client backbone.Client) backbone.Client {
+		return &decorator{Client: client, around: func(ctx context.Context, method string, replayable bool, f func() error) error {
+			for attempt := 0; ; attempt++ {
+				err := f()
+				if err == nil || !replayable || attempt >= opts.MaxRetries || ctx.Err() != nil || !opts.Retryable(err) {
+					return err
+				}
+
+				wait := Backoff(attempt, opts.MinBackoff, opts.MaxBackoff)
+				retries.Inc(method)
+				logging.Warn("backbone: retry", logging.F("method", method), logging.F("retry", attempt+1), logging.Duration(wait), logging.Err(err))
+				if err := Sleep(ctx, wait); err != nil {
+					return err
+				}
+			}
+		}}
+	}
+}
+
+// Retryable ist die Standard-Prüfung von Retry: Alle Fehler außer dem Ende eines ctx
+// und Fehlern, die sich durch eine Wiederholung nicht ändern (nicht vorhanden, keine Berechtigung, ungültig).
+func Retryable(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, os.ErrPermission), errors.Is(err, os.ErrInvalid):
+		return false
+	}
+	return true
+}
+
+// Backoff berechnet die Wartezeit vor dem nächsten Versuch: minWait * 2^attempt (max. maxWait),
+// davon wird zufällig bis zur Hälfte abgezogen (jitter), damit nicht alle Streams gleichzeitig wiederholen.
+func Backoff(attempt int, minWait, maxWait time.Duration) time.Duration {
+	wait := maxWait
+	if attempt < 30 && minWait<<uint(attempt) < maxWait {
+		wait = minWait << uint(attempt)
+	}
+	half := int64(wait / 2)
+	if half <= 0 {
+		return wait
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"splitfuseX/backbone"
+	"splitfuseX/backbone/local"
+)
+
+// testRetry ist Retry mit kurzen Wartezeiten.
+func testRetry(maxRetries int) Middleware {
+	return Retry(RetryOptions{MaxRetries: maxRetries, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+}
+
+// brokenSave liest beim ersten Save einen Teil des Streams und schlägt dann fehl.
+type brokenSave struct {
+	backbone.Client
+	calls int
+}
+
+func (c *brokenSave) SaveContext(ctx context.Context, fileName string, file io.Reader, maxRead int64) (string, error) {
+	c.calls++
+	if c.calls == 1 {
+		io.CopyN(ioutil.Discard, file, 3)
+		return "", errors.New("connection reset")
+	}
+	return c.Client.SaveContext(ctx, fileName, file, maxRead)
+}
+
+func TestRetry(t *testing.T) {
+	faults := NewFaults(0, 0)
+	client := Chain(local.NewDiskClient(t.TempDir()), testRetry(3), faults.Middleware())
+
+	faults.FailNext(MethodSave, 2)
+	fileId, err := client.Save("a", strings.NewReader("hello"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	faults.FailNext(MethodRead, 3)
+	r, err := client.Read(fileId, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(b) != "hello" || faults.Injected() != 5 {
+		t.Fatalf("read %q after %d faults", b, faults.Injected())
+	}
+
+	// zu viele Fehler
+	faults.FailNext(MethodInitFileList, 4)
+	if err := client.InitFileList(); !errors.Is(err, ErrInjected) {
+		t.Fatalf("expected injected fault, got %v", err)
+	}
+}
+
+func TestRetrySeek(t *testing.T) {
+	dir := t.TempDir()
+	broken := &brokenSave{Client: local.NewDiskClient(dir)}
+	client := Chain(broken, testRetry(3))
+
+	// ein io.Seeker wird zurückgespult
+	if _, err := client.Save("a", strings.NewReader("hello"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(dir + "/a"); string(b) != "hello" || broken.calls != 2 {
+		t.Fatalf("saved %q after %d calls", b, broken.calls)
+	}
+
+	// ein Stream kann nicht wiederholt werden
+	broken.calls = 0
+	if _, err := client.Save("b", io.MultiReader(strings.NewReader("hello")), 0); err == nil || broken.calls != 1 {
+		t.Fatalf("stream should not be retried: %v after %d calls", err, broken.calls)
+	}
+}
+
+func TestRetryPermanent(t *testing.T) {
+	faults := NewFaults(0, 0)
+	calls := 0
+	counter := func(client backbone.Client) backbone.Client {
+		return &decorator{Client: client, around: func(ctx context.Context, method string, replayable bool, f func() error) error {
+			calls++
+			return f()
+		}}
+	}
+	client := Chain(local.NewDiskClient(t.TempDir()), testRetry(3), counter, faults.Middleware())
+
+	// eine fehlende Datei wird nicht wiederholt
+	if _, err := client.Read("bm9wZQ==", 0, 100); !os.IsNotExist(err) || calls != 1 {
+		t.Fatalf("missing file: %v after %d calls", err, calls)
+	}
+
+	// das Ende des ctx beendet auch das Warten
+	calls = 0
+	slow := Chain(local.NewDiskClient(t.TempDir()), Retry(RetryOptions{MaxRetries: 3, MinBackoff: time.Hour}), faults.Middleware())
+	faults.FailNext(MethodUpdateFileList, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := slow.UpdateFileListContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRetryOptions(t *testing.T) {
+	faults := NewFaults(0, 0)
+
+	// eigene Prüfung: ErrInjected gilt als dauerhaft
+	client := Chain(local.NewDiskClient(t.TempDir()), Retry(RetryOptions{
+		MaxRetries: 3,
+		MinBackoff: time.Millisecond,
+		Retryable:  func(err error) bool { return !errors.Is(err, ErrInjected) },
+	}), faults.Middleware())
+	faults.FailNext(MethodUpdateFileList, 1)
+	if err := client.UpdateFileList(); !errors.Is(err, ErrInjected) {
+		t.Fatalf("custom Retryable ignored: %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 100; attempt++ {
+		max := 64 * time.Second
+		if attempt < 6 {
+			max = time.Second << uint(attempt)
+		}
+		if wait := Backoff(attempt, time.Second, 64*time.Second); wait < max/2 || wait > max {
+			t.Errorf("Backoff(%d) = %v, want %v-%v", attempt, wait, max/2, max)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("connection reset"), true},
+		{fmt.Errorf("save: %w", ErrInjected), true},
+		{context.Canceled, false},
+		{fmt.Errorf("read: %w", context.DeadlineExceeded), false},
+		{&os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}, false},
+		{os.ErrPermission, false},
+	}
+	for _, test := range tests {
+		if got := Retryable(test.err); got != test.want {
+			t.Errorf("Retryable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+	if Retry(RetryOptions{}) != nil {
+		t.Error("Retry without MaxRetries should be disabled")
+	}
+}
@@ -0,0 +1,407 @@
+// Package mirror verteilt die Chunks und die DB auf mehrere Speicher (zB Google Drive und eine lokale Festplatte).
+// Der Client schreibt in alle Speicher und liest vom schnellsten erreichbaren (mit failover).
+// Mit Sync können fehlende Dateien zwischen zwei Speichern kopiert werden.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"splitfuseX/backbone"
+	"splitfuseX/logging"
+)
+
+// So lange wird ein Speicher nach einem Fehler beim Lesen nur noch als letzte Möglichkeit verwendet.
+const FailureBackoff = 30 * time.Second
+
+// Target ist ein Speicher des Mirror mit einem Namen für Meldungen (zB "drive" oder "local:/mnt/backup").
+type Target struct {
+	Name   string
+	Client backbone.Client
+}
+
+// Client ist ein backbone.Client, der jede Datei in alle Targets schreibt und vom schnellsten erreichbaren liest.
+// Chunks werden über Name und Größe zugeordnet, andere Dateien (zB die DB) stehen je Target in der FileList. Die fileId hat das Format "<index>:<fileId>" (index des ersten
+// Targets mit dieser Datei), damit sie auch vor dem nächsten UpdateFileList gelesen werden kann.
+// HINWEIS: Eine Datei, die nur in einem Target vorhanden ist, gilt als vorhanden (zB beim Upload). Fehlende Kopien
+// können mit Sync ergänzt werden.
+type Client struct {
+	targets []*target
+
+	mutex *sync.RWMutex     // schützt files
+	files map[string]*entry // key ist die fileId des Mirror
+}
+
+// target ist ein Speicher mit seinem Zustand.
+type target struct {
+	Target
+	index int
+
+	mutex       *sync.Mutex   // schützt alle folgenden Felder
+	initialized bool          // war InitFileList erfolgreich?
+	latency     time.Duration // gleitender Mittelwert der Zeit bis ein Stream geöffnet ist
+	downUntil   time.Time     // bis dahin wird das Target nach einem Fehler gemieden
+}
+
+// entry ist eine Datei im Mirror mit ihren fileIds in den Targets ("" bedeutet nicht vorhanden).
+type entry struct {
+	object *backbone.FileObject
+	ids    []string
+}
+
+// New erzeugt einen Client für die Targets (min. eines).
+func New(targets ...Target) (*Client, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("mirror needs at least one target")
+	}
+	c := &Client{mutex: &sync.RWMutex{}, files: make(map[string]*entry)}
+	for i, t := range targets {
+		c.targets = append(c.targets, &target{Target: t, index: i, mutex: &sync.Mutex{}})
+	}
+	return c, nil
+}
+
+// Read liest vom schnellsten erreichbaren Target, das die Datei enthält (siehe ReadContext).
+func (c *Client) Read(fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	return c.ReadContext(context.Background(), fileId, offset, fileSize)
+}
+
+// ReadContext probiert alle Targets mit der Datei der Reihe nach: zuerst die erreichbaren, sortiert nach ihrer Latenz.
+// Ein Fehler beim späteren Lesen aus dem Stream führt nicht zu einem failover.
+func (c *Client) ReadContext(ctx context.Context, fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	ids, err := c.ids(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, t := range c.readOrder(ids) {
+		start := time.Now()
+		r, err := t.Client.ReadContext(ctx, ids[t.index], offset, fileSize)
+		if err == nil {
+			t.succeeded(time.Since(start))
+			return r, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		t.failed()
+		logging.Warn("mirror: read failed, trying next target", logging.FileId(fileId), logging.Backbone(t.Name), logging.Err(err))
+		errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Trash verschiebt die Datei in allen Targets in den Papierkorb.
+func (c *Client) Trash(fileId string) error {
+	return c.TrashContext(context.Background(), fileId)
+}
+
+// TrashContext verschiebt die Datei in allen Targets in den Papierkorb. Fehler aller Targets werden gesammelt.
+func (c *Client) TrashContext(ctx context.Context, fileId string) error {
+	ids, err := c.ids(fileId)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, t := range c.targets {
+		if ids[t.index] == "" {
+			continue
+		}
+		if err := t.Client.TrashContext(ctx, ids[t.index]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Save speichert die Datei in allen Targets (siehe SaveContext).
+func (c *Client) Save(fileName string, file io.Reader, maxRead int64) (string, error) {
+	return c.SaveContext(context.Background(), fileName, file, maxRead)
+}
+
+// SaveContext speichert die Datei nacheinander in allen Targets. Schlägt ein Target fehl, dann schlägt auch
+// SaveContext fehl (die bereits geschriebenen Kopien bleiben erhalten und werden beim nächsten Upload erkannt).
+// Ein io.Seeker wird für jedes Target zurückgespult, jeder andere Stream wird dafür im Speicher gepuffert.
+func (c *Client) SaveContext(ctx context.Context, fileName string, file io.Reader, maxRead int64) (string, error) {
+	if len(c.targets) == 1 {
+		fileId, err := c.targets[0].Client.SaveContext(ctx, fileName, file, maxRead)
+		if err != nil {
+			return "", err
+		}
+		return mirrorId(0, fileId), nil
+	}
+
+	// der Stream muss mehrfach gelesen werden
+	r, ok := file.(io.ReadSeeker)
+	var start int64
+	if ok {
+		var err error
+		start, err = r.Seek(0, io.SeekCurrent)
+		ok = err == nil
+	}
+	if !ok {
+		if maxRead > 0 {
+			file = io.LimitReader(file, maxRead)
+		}
+		b, err := ioutil.ReadAll(backbone.ContextReader(ctx, file))
+		if err != nil {
+			return "", err
+		}
+		r, start = bytes.NewReader(b), 0
+	}
+
+	ret := ""
+	var errs []error
+	for _, t := range c.targets {
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return "", err
+		}
+		fileId, err := t.Client.SaveContext(ctx, fileName, r, maxRead)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+			continue
+		}
+		if ret == "" {
+			ret = mirrorId(t.index, fileId)
+		}
+	}
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	return ret, nil
+}
+
+// InitFileList liest die Dateien aller Targets ein (siehe InitFileListContext).
+func (c *Client) InitFileList() error {
+	return c.InitFileListContext(context.Background())
+}
+
+// InitFileListContext liest die Dateien aller Targets ein. Ein Target, das nicht erreichbar ist, wird ausgelassen
+// (seine Dateien fehlen dann in der FileList). Nur wenn kein Target erreichbar ist, wird ein Fehler zurückgegeben.
+func (c *Client) InitFileListContext(ctx context.Context) error {
+	return c.refresh(ctx, true)
+}
+
+// UpdateFileList aktualisiert die Dateien aller Targets (siehe UpdateFileListContext).
+func (c *Client) UpdateFileList() error {
+	return c.UpdateFileListContext(context.Background())
+}
+
+// UpdateFileListContext aktualisiert die Dateien aller Targets. Ein Target, bei dem InitFileList noch nicht
+// erfolgreich war, wird dabei neu eingelesen.
+func (c *Client) UpdateFileListContext(ctx context.Context) error {
+	return c.refresh(ctx, false)
+}
+
+// FileList gibt die zusammengeführten Dateien aller Targets zurück.
+func (c *Client) FileList() map[string]*backbone.FileObject {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	ret := make(map[string]*backbone.FileObject, len(c.files))
+	for fileId, e := range c.files {
+		ret[fileId] = e.object
+	}
+	return ret
+}
+
+// refresh aktualisiert alle Targets und führt ihre Dateien zusammen.
+func (c *Client) refresh(ctx context.Context, init bool) error {
+	var errs []error
+	lists := make([]map[string]*backbone.FileObject, len(c.targets))
+	for _, t := range c.targets {
+		if err := t.refresh(ctx, init); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logging.Warn("mirror: target not available", logging.Backbone(t.Name), logging.Err(err))
+			errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+		}
+		// nach einem fehlgeschlagenen Update gilt die bisherige Liste weiter
+		if t.isInitialized() {
+			lists[t.index] = t.Client.FileList()
+		}
+	}
+	if len(errs) == len(c.targets) {
+		return errors.Join(errs...)
+	}
+
+	files := merge(lists)
+	c.mutex.Lock()
+	c.files = files
+	c.mutex.Unlock()
+	return nil
+}
+
+// refresh ruft InitFileList (bei init oder wenn es noch nie erfolgreich war) oder UpdateFileList auf.
+func (t *target) refresh(ctx context.Context, init bool) error {
+	var err error
+	if init || !t.isInitialized() {
+		err = t.Client.InitFileListContext(ctx)
+		t.mutex.Lock()
+		t.initialized = err == nil
+		t.mutex.Unlock()
+	} else {
+		err = t.Client.UpdateFileListContext(ctx)
+	}
+	return err
+}
+
+// isInitialized gibt zurück, ob InitFileList erfolgreich war.
+func (t *target) isInitialized() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.initialized
+}
+
+// merge ordnet die Chunks der Targets über Name und Größe einander zu. Gibt es in einem Target mehrere Chunks
+// mit gleichem Namen und gleicher Größe, dann wird jeweils der k-te (sortiert nach fileId) zugeordnet.
+// Andere Dateien (zB die DB) werden nicht zugeordnet: Eine alte DB mit gleicher Größe in einer Kopie hat einen anderen
+// Inhalt. Jedes Target behält dafür einen eigenen Eintrag (mit eigener ModifiedTime), damit die neueste gewählt wird.
+func merge(lists []map[string]*backbone.FileObject) map[string]*entry {
+	type key struct {
+		name   string
+		size   int64
+		k      int
+		target int // -1 für Chunks, sonst der index des Targets (keine Zuordnung)
+	}
+	entries := make(map[key]*entry)
+	var order []key
+	for i, list := range lists {
+		// sortieren, damit die Zuordnung stabil ist
+		ids := make([]string, 0, len(list))
+		for fileId := range list {
+			ids = append(ids, fileId)
+		}
+		sort.Strings(ids)
+
+		seen := make(map[key]int)
+		for _, fileId := range ids {
+			obj := list[fileId]
+			k := key{name: obj.Name, size: obj.Size, target: -1}
+			if !isChunkName(obj.Name) {
+				k.target = i
+			}
+			k.k = seen[k]
+			seen[key{name: k.name, size: k.size, target: k.target}]++
+
+			e, ok := entries[k]
+			if !ok {
+				e = &entry{
+					object: &backbone.FileObject{Id: mirrorId(i, fileId), Name: obj.Name, Size: obj.Size, ModifiedTime: obj.ModifiedTime},
+					ids:    make([]string, len(lists)),
+				}
+				entries[k] = e
+				order = append(order, k)
+			}
+			e.ids[i] = fileId
+		}
+	}
+
+	files := make(map[string]*entry, len(entries))
+	for _, k := range order {
+		e := entries[k]
+		files[e.object.Id] = e
+	}
+	return files
+}
+
+// isChunkName prüft, ob der Name ein Chunk sein kann (128 Hex-Zeichen, siehe core.KeyFile.CalcChunkName).
+// Chunks mit gleichem Namen haben immer den gleichen Inhalt, andere Dateien (zB die DB) nicht.
+func isChunkName(name string) bool {
+	if len(name) != 128 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ids gibt die fileIds in allen Targets zu einer fileId des Mirror zurück.
+// Ist die Datei (noch) nicht in der FileList, dann wird die fileId aus dem Format "<index>:<fileId>" gelesen.
+func (c *Client) ids(fileId string) ([]string, error) {
+	c.mutex.RLock()
+	e, ok := c.files[fileId]
+	c.mutex.RUnlock()
+	if ok {
+		return e.ids, nil
+	}
+
+	indexStr, targetId, found := strings.Cut(fileId, ":")
+	index, err := strconv.Atoi(indexStr)
+	if !found || err != nil || index < 0 || index >= len(c.targets) {
+		return nil, fmt.Errorf("invalid mirror file id %q", fileId)
+	}
+	ids := make([]string, len(c.targets))
+	ids[index] = targetId
+	return ids, nil
+}
+
+// readOrder sortiert die Targets mit der Datei: zuerst die erreichbaren nach Latenz, dann die nach einem Fehler gemiedenen.
+func (c *Client) readOrder(ids []string) []*target {
+	type candidate struct {
+		t       *target
+		down    bool
+		latency time.Duration
+	}
+	now := time.Now()
+	var candidates []candidate
+	for _, t := range c.targets {
+		if ids[t.index] == "" {
+			continue
+		}
+		t.mutex.Lock()
+		candidates = append(candidates, candidate{t: t, down: now.Before(t.downUntil), latency: t.latency})
+		t.mutex.Unlock()
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].down != candidates[j].down {
+			return !candidates[i].down
+		}
+		return candidates[i].latency < candidates[j].latency
+	})
+	ret := make([]*target, len(candidates))
+	for i, cand := range candidates {
+		ret[i] = cand.t
+	}
+	return ret
+}
+
+// succeeded merkt sich die Latenz eines erfolgreichen Reads (gleitender Mittelwert).
+func (t *target) succeeded(latency time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.latency == 0 {
+		t.latency = latency
+	} else {
+		t.latency = (t.latency*7 + latency) / 8
+	}
+	t.downUntil = time.Time{}
+}
+
+// failed meidet das Target für FailureBackoff.
+func (t *target) failed() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.downUntil = time.Now().Add(FailureBackoff)
+}
+
+// mirrorId erzeugt die fileId des Mirror.
+func mirrorId(index int, fileId string) string {
+	return strconv.Itoa(index) + ":" + fileId
+}
@@ -0,0 +1,248 @@
+package mirror
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"splitfuseX/backbone"
+	"splitfuseX/backbone/local"
+	"splitfuseX/backbone/middleware"
+)
+
+// Namen von Chunks (nur diese werden über Name und Größe zugeordnet)
+var (
+	chunkA = strings.Repeat("a", 128)
+	chunkB = strings.Repeat("b", 128)
+	chunkC = strings.Repeat("c", 128)
+)
+
+// testMirror erzeugt einen Mirror aus zwei lokalen Ordnern. Vor das erste Target wird Faults gesetzt.
+func testMirror(t *testing.T) (*Client, []string, *middleware.Faults) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	faults := middleware.NewFaults(0, 0)
+	c, err := New(
+		Target{Name: "first", Client: middleware.Chain(local.NewDiskClient(dirs[0]), faults.Middleware())},
+		Target{Name: "second", Client: local.NewDiskClient(dirs[1])},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InitFileList(); err != nil {
+		t.Fatal(err)
+	}
+	return c, dirs, faults
+}
+
+// read liest eine ganze Datei aus dem Client.
+func read(t *testing.T, c backbone.Client, fileId string) string {
+	r, err := c.Read(fileId, 0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, _ := ioutil.ReadAll(r)
+	return string(b)
+}
+
+func TestMirror(t *testing.T) {
+	c, dirs, _ := testMirror(t)
+
+	// in alle Targets schreiben (auch einen Stream ohne io.Seeker)
+	fileId, err := c.Save(chunkA, strings.NewReader("hello"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Save(chunkB, io.MultiReader(strings.NewReader("streamed and cut")), 8); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		a, _ := ioutil.ReadFile(filepath.Join(dir, chunkA))
+		b, _ := ioutil.ReadFile(filepath.Join(dir, chunkB))
+		if string(a) != "hello" || string(b) != "streamed" {
+			t.Fatalf("%s: %q %q", dir, a, b)
+		}
+	}
+
+	// lesen vor und nach UpdateFileList
+	if got := read(t, c, fileId); got != "hello" {
+		t.Fatalf("read before update: %q", got)
+	}
+	if err := c.UpdateFileList(); err != nil {
+		t.Fatal(err)
+	}
+	list := c.FileList()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 merged files: %v", list)
+	}
+	if list[fileId] == nil || list[fileId].Name != chunkA || list[fileId].Size != 5 {
+		t.Fatalf("unexpected entry for %s: %v", fileId, list)
+	}
+
+	// eine Datei, die nur im zweiten Target liegt
+	ioutil.WriteFile(filepath.Join(dirs[1], chunkC), []byte("only second"), 0600)
+	c.UpdateFileList()
+	for id, file := range c.FileList() {
+		if file.Name == chunkC {
+			if !strings.HasPrefix(id, "1:") || read(t, c, id) != "only second" {
+				t.Fatalf("file only in second target: %s", id)
+			}
+		}
+	}
+
+	// in allen Targets löschen
+	if err := c.Trash(fileId); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, chunkA)); !os.IsNotExist(err) {
+			t.Fatalf("%s: chunk still exists", dir)
+		}
+	}
+
+	if _, err := c.Read("nope", 0, 10); err == nil {
+		t.Fatal("invalid id should fail")
+	}
+	if _, err := New(); err == nil {
+		t.Fatal("mirror without targets should fail")
+	}
+}
+
+func TestMirrorFailover(t *testing.T) {
+	c, _, faults := testMirror(t)
+	fileId, _ := c.Save(chunkA, strings.NewReader("hello"), 0)
+	c.UpdateFileList()
+
+	// das erste Target fällt aus
+	faults.FailNext(middleware.MethodRead, 1)
+	if got := read(t, c, fileId); got != "hello" {
+		t.Fatalf("failover: %q", got)
+	}
+	if faults.Injected() != 1 {
+		t.Fatalf("first target should have been tried: %d", faults.Injected())
+	}
+
+	// danach wird es gemieden
+	faults.FailNext(middleware.MethodRead, 1)
+	read(t, c, fileId)
+	if faults.Injected() != 1 {
+		t.Fatal("failed target should be avoided")
+	}
+
+	// schreiben schlägt fehl, wenn ein Target fehlschlägt
+	faults.FailNext(middleware.MethodSave, 1)
+	if _, err := c.Save(chunkB, strings.NewReader("x"), 0); !errors.Is(err, middleware.ErrInjected) {
+		t.Fatalf("expected injected fault, got %v", err)
+	}
+}
+
+func TestMirrorFileList(t *testing.T) {
+	c, _, faults := testMirror(t)
+	c.Save(chunkA, strings.NewReader("hello"), 0)
+
+	// ein Target ist nicht erreichbar
+	faults.FailNext(middleware.MethodInitFileList, 1)
+	if err := c.InitFileList(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.FileList()) != 1 {
+		t.Fatalf("files of the second target missing: %v", c.FileList())
+	}
+
+	// beim nächsten Update wird es neu eingelesen
+	if err := c.UpdateFileList(); err != nil || faults.Injected() != 1 {
+		t.Fatal(err)
+	}
+	for id := range c.FileList() {
+		if !strings.HasPrefix(id, "0:") {
+			t.Fatalf("first target should be back: %s", id)
+		}
+	}
+
+	// kein Target ist erreichbar
+	broken, _ := New(Target{Name: "broken", Client: local.NewDiskClient(filepath.Join(t.TempDir(), "missing"))})
+	if err := broken.InitFileList(); err == nil {
+		t.Fatal("expected an error without any target")
+	}
+}
+
+func TestMirrorStaleDb(t *testing.T) {
+	c, dirs, _ := testMirror(t)
+
+	// die Kopie im zweiten Target ist alt, hat aber die gleiche Größe und ist schneller
+	ioutil.WriteFile(filepath.Join(dirs[1], "index.db"), []byte("db version 1"), 0600)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dirs[1], "index.db"), old, old)
+	ioutil.WriteFile(filepath.Join(dirs[0], "index.db"), []byte("db version 2"), 0600)
+	if err := c.InitFileList(); err != nil {
+		t.Fatal(err)
+	}
+	c.targets[1].succeeded(time.Nanosecond)
+	c.targets[0].succeeded(time.Second)
+
+	var newestDb *backbone.FileObject
+	count := 0
+	for _, file := range c.FileList() {
+		if file.Name == "index.db" {
+			count++
+			if newestDb == nil || newestDb.ModifiedTime < file.ModifiedTime {
+				newestDb = file
+			}
+		}
+	}
+	if count != 2 {
+		t.Fatalf("expected one db per target, got %d", count)
+	}
+	if got := read(t, c, newestDb.Id); got != "db version 2" {
+		t.Fatalf("newest db: %q", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	chunk := strings.Repeat("ab", 64)
+	lists := []map[string]*backbone.FileObject{
+		{"x1": {Id: "x1", Name: chunk, Size: 10}, "x2": {Id: "x2", Name: chunk, Size: 10}, "x3": {Id: "x3", Name: "index.db", Size: 5, ModifiedTime: 2}},
+		{"y1": {Id: "y1", Name: chunk, Size: 10}, "y2": {Id: "y2", Name: chunk, Size: 11}, "y3": {Id: "y3", Name: "index.db", Size: 5, ModifiedTime: 1}},
+		nil,
+	}
+	files := merge(lists)
+	if len(files) != 5 {
+		t.Fatalf("expected 5 files: %v", files)
+	}
+	if e := files["0:x1"]; e == nil || e.ids[1] != "y1" || e.ids[2] != "" {
+		t.Fatalf("chunk not merged: %+v", e)
+	}
+	if e := files["0:x2"]; e == nil || e.ids[1] != "" {
+		t.Fatalf("second chunk: %+v", e)
+	}
+	if files["1:y2"] == nil {
+		t.Fatalf("chunks with different sizes must not be merged: %v", files)
+	}
+
+	// die DB wird trotz gleicher Größe nicht zugeordnet (die Kopie kann veraltet sein)
+	if e := files["0:x3"]; e == nil || e.ids[1] != "" || e.object.ModifiedTime != 2 {
+		t.Fatalf("db of first target: %+v", e)
+	}
+	if e := files["1:y3"]; e == nil || e.ids[0] != "" || e.object.ModifiedTime != 1 {
+		t.Fatalf("db of second target: %+v", e)
+	}
+}
+
+func TestIsChunkName(t *testing.T) {
+	for name, want := range map[string]bool{
+		strings.Repeat("0f", 64): true,
+		strings.Repeat("0F", 64): false,
+		strings.Repeat("0f", 63): false,
+		"index.db":               false,
+		strings.Repeat("xy", 64): false,
+	} {
+		if isChunkName(name) != want {
+			t.Errorf("isChunkName(%q) != %v", name, want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"splitfuseX/backbone"
+	"splitfuseX/logging"
+)
+
+// SyncOptions sind die Einstellungen für Sync.
+type SyncOptions struct {
+	Parallel int      // so viele Dateien werden gleichzeitig kopiert (default 1)
+	DryRun   bool     // nur zählen, nichts kopieren oder löschen
+	Replace  []string // Dateinamen (zB die DB), die im Ziel ersetzt statt ergänzt werden
+}
+
+// SyncStats ist das Ergebnis von Sync.
+type SyncStats struct {
+	Present     int   // Dateien, die bereits im Ziel vorhanden sind
+	Copied      int   // kopierte Dateien (bei DryRun: zu kopierende)
+	CopiedBytes int64 // kopierte Bytes (bei DryRun: zu kopierende)
+	Replaced    int   // ersetzte Dateien aus SyncOptions.Replace
+	Failed      int   // Dateien, die nicht kopiert werden konnten
+}
+
+// Sync kopiert alle Dateien von from nach to, die dort fehlen. Verglichen wird über Name und Größe (FileList).
+// Dateien aus opts.Replace werden zuletzt kopiert (die DB soll nur auf vorhandene Chunks verweisen): Unterscheidet sich
+// die neueste Datei mit diesem Namen in from vom Inhalt der neuesten in to, dann wird sie kopiert und alle anderen
+// mit diesem Namen in to werden in den Papierkorb verschoben.
+// Bei beiden Clients muss InitFileList bereits aufgerufen worden sein. Nach einem Fehler wird mit den übrigen Dateien
+// weitergemacht, alle Fehler werden am Ende zurückgegeben. Dateien in to, die in from fehlen, bleiben erhalten.
+func Sync(ctx context.Context, from, to backbone.Client, opts SyncOptions) (SyncStats, error) {
+	var stats SyncStats
+	replace := make(map[string]bool)
+	for _, name := range opts.Replace {
+		replace[name] = true
+	}
+
+	// fehlende Dateien suchen
+	type key struct {
+		name string
+		size int64
+	}
+	present := make(map[key]bool)
+	for _, file := range to.FileList() {
+		present[key{file.Name, file.Size}] = true
+	}
+	missing := make(map[key]*backbone.FileObject)
+	for _, file := range from.FileList() {
+		k := key{file.Name, file.Size}
+		switch {
+		case replace[file.Name]:
+			// zuletzt
+		case present[k]:
+			stats.Present++
+		case missing[k] == nil:
+			missing[k] = file
+		}
+	}
+	files := make([]*backbone.FileObject, 0, len(missing))
+	for _, file := range missing {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	// kopieren
+	errs := syncFiles(ctx, from, to, files, opts, &stats)
+	if ctx.Err() != nil {
+		return stats, ctx.Err()
+	}
+
+	// ersetzen (nur, wenn alle Dateien kopiert wurden)
+	if len(errs) == 0 {
+		for _, name := range opts.Replace {
+			replaced, err := replaceFile(ctx, from, to, name, opts.DryRun)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				continue
+			}
+			if replaced {
+				stats.Replaced++
+			}
+		}
+	}
+	return stats, errors.Join(errs...)
+}
+
+// syncFiles kopiert die Dateien mit opts.Parallel goroutines.
+func syncFiles(ctx context.Context, from, to backbone.Client, files []*backbone.FileObject, opts SyncOptions, stats *SyncStats) []error {
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var errs []error
+	mutex := &sync.Mutex{} // schützt stats und errs
+	wg := &sync.WaitGroup{}
+	queue := make(chan *backbone.FileObject)
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range queue {
+				var err error
+				if !opts.DryRun {
+					err = copyFile(ctx, from, to, file)
+				}
+
+				// LOCK / UNLOCK
+				mutex.Lock()
+				if err != nil {
+					stats.Failed++
+					errs = append(errs, fmt.Errorf("%s: %w", file.Name, err))
+				} else {
+					stats.Copied++
+					stats.CopiedBytes += file.Size
+				}
+				mutex.Unlock()
+
+				if err != nil && ctx.Err() == nil {
+					logging.Warn("sync: copy failed", logging.F("name", file.Name), logging.Err(err))
+				} else if err == nil {
+					logging.Debug("sync: copied", logging.F("name", file.Name), logging.F("size", file.Size), logging.F("dryRun", opts.DryRun))
+				}
+			}
+		}()
+	}
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- file
+	}
+	close(queue)
+	wg.Wait()
+	return errs
+}
+
+// copyFile kopiert eine Datei und prüft dabei die Größe.
+func copyFile(ctx context.Context, from, to backbone.Client, file *backbone.FileObject) error {
+	r, err := from.ReadContext(ctx, file.Id, 0, file.Size)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	counter := &countingReader{r: r}
+	fileId, err := to.SaveContext(ctx, file.Name, counter, file.Size)
+	if err != nil {
+		return err
+	}
+	if counter.n != file.Size {
+		// die unvollständige Kopie würde sonst beim nächsten Sync als eigene Datei gelten
+		to.TrashContext(ctx, fileId)
+		return fmt.Errorf("incomplete copy: %d of %d bytes", counter.n, file.Size)
+	}
+	return nil
+}
+
+// replaceFile kopiert die neueste Datei mit dem Namen, wenn sie sich von der neuesten in to unterscheidet,
+// und verschiebt danach alle anderen mit diesem Namen in to in den Papierkorb.
+func replaceFile(ctx context.Context, from, to backbone.Client, name string, dryRun bool) (bool, error) {
+	source := newest(from.FileList(), name)
+	if source == nil {
+		return false, nil
+	}
+	sourceData, err := readAll(ctx, from, source)
+	if err != nil {
+		return false, err
+	}
+	if target := newest(to.FileList(), name); target != nil && target.Size == source.Size {
+		targetData, err := readAll(ctx, to, target)
+		if err != nil {
+			return false, err
+		}
+		if bytes.Equal(sourceData, targetData) {
+			return false, nil
+		}
+	}
+	if dryRun {
+		return true, nil
+	}
+
+	// zuerst die neue Datei speichern, dann die alten löschen
+	// (manche Speicher überschreiben eine gleichnamige Datei unter derselben fileId, zB local)
+	old := to.FileList()
+	newId, err := to.SaveContext(ctx, name, bytes.NewReader(sourceData), 0)
+	if err != nil {
+		return false, err
+	}
+	for fileId, file := range old {
+		if file.Name == name && fileId != newId {
+			if err := to.TrashContext(ctx, fileId); err != nil {
+				return true, err
+			}
+		}
+	}
+	logging.Info("sync: replaced", logging.F("name", name), logging.F("size", source.Size))
+	return true, nil
+}
+
+// newest gibt die neueste Datei mit dem Namen zurück (oder nil).
+func newest(list map[string]*backbone.FileObject, name string) *backbone.FileObject {
+	var ret *backbone.FileObject
+	for _, file := range list {
+		if file.Name == name && (ret == nil || ret.ModifiedTime < file.ModifiedTime) {
+			ret = file
+		}
+	}
+	return ret
+}
+
+// readAll liest eine ganze Datei.
+func readAll(ctx context.Context, client backbone.Client, file *backbone.FileObject) ([]byte, error) {
+	r, err := client.ReadContext(ctx, file.Id, 0, file.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// countingReader zählt die gelesenen Bytes.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,82 @@
+package mirror
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"splitfuseX/backbone/local"
+)
+
+func TestSync(t *testing.T) {
+	fromDir, toDir := t.TempDir(), t.TempDir()
+	ioutil.WriteFile(filepath.Join(fromDir, "chunk1"), []byte("first chunk"), 0600)
+	ioutil.WriteFile(filepath.Join(fromDir, "chunk2"), []byte("second chunk"), 0600)
+	ioutil.WriteFile(filepath.Join(fromDir, "index.db"), []byte("db version 1"), 0600)
+	ioutil.WriteFile(filepath.Join(toDir, "chunk1"), []byte("first chunk"), 0600)
+	ioutil.WriteFile(filepath.Join(toDir, "other"), []byte("stays"), 0600)
+
+	from, to := local.NewDiskClient(fromDir), local.NewDiskClient(toDir)
+	sync := func(dryRun bool) SyncStats {
+		t.Helper()
+		if err := from.InitFileList(); err != nil {
+			t.Fatal(err)
+		}
+		if err := to.InitFileList(); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := Sync(context.Background(), from, to, SyncOptions{Parallel: 2, DryRun: dryRun, Replace: []string{"index.db"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stats
+	}
+
+	// nur zählen
+	if stats := sync(true); stats.Present != 1 || stats.Copied != 1 || stats.CopiedBytes != 12 || stats.Replaced != 1 {
+		t.Fatalf("dry run: %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(toDir, "chunk2")); !os.IsNotExist(err) {
+		t.Fatal("dry run must not copy")
+	}
+
+	// kopieren
+	if stats := sync(false); stats.Copied != 1 || stats.Replaced != 1 || stats.Failed != 0 {
+		t.Fatalf("sync: %+v", stats)
+	}
+	for name, want := range map[string]string{"chunk1": "first chunk", "chunk2": "second chunk", "index.db": "db version 1", "other": "stays"} {
+		if b, _ := ioutil.ReadFile(filepath.Join(toDir, name)); string(b) != want {
+			t.Fatalf("%s: %q", name, b)
+		}
+	}
+
+	// nichts zu tun
+	if stats := sync(false); stats.Copied != 0 || stats.Replaced != 0 || stats.Present != 2 {
+		t.Fatalf("second sync: %+v", stats)
+	}
+
+	// neue DB mit gleicher Größe
+	ioutil.WriteFile(filepath.Join(fromDir, "index.db"), []byte("db version 2"), 0600)
+	if stats := sync(false); stats.Replaced != 1 {
+		t.Fatalf("new db: %+v", stats)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(toDir, "index.db")); string(b) != "db version 2" {
+		t.Fatalf("db not replaced: %q", b)
+	}
+}
+
+func TestSyncCanceled(t *testing.T) {
+	fromDir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(fromDir, "chunk"), []byte("data"), 0600)
+	from, to := local.NewDiskClient(fromDir), local.NewDiskClient(t.TempDir())
+	from.InitFileList()
+	to.InitFileList()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Sync(ctx, from, to, SyncOptions{}); err != context.Canceled {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package throttle
+
+import (
+	"context"
+	"io"
+
+	"splitfuseX/backbone"
+)
+
+// Limits sind die Limiter für einen Client (nil bedeutet unbegrenzt).
+// Total gilt für Uploads und Downloads zusammen, zusätzlich zu Upload bzw. Download.
+type Limits struct {
+	Total    *Limiter
+	Upload   *Limiter
+	Download *Limiter
+}
+
+// NewClient umhüllt den Client, sodass alle Streams von Read und Save die Limits einhalten.
+// Alle anderen Methoden werden unverändert weitergegeben. Ohne Limits wird der Client selbst zurückgegeben.
+func NewClient(client backbone.Client, limits Limits) backbone.Client {
+	if limits.Total == nil && limits.Upload == nil && limits.Download == nil {
+		return client
+	}
+	return &throttledClient{Client: client, limits: limits}
+}
+
+// throttledClient ist ein backbone.Client mit begrenzter Bandbreite (siehe NewClient).
+type throttledClient struct {
+	backbone.Client
+	limits Limits
+}
+
+func (c *throttledClient) Read(fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	return c.ReadContext(context.Background(), fileId, offset, fileSize)
+}
+
+func (c *throttledClient) ReadContext(ctx context.Context, fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	r, err := c.Client.ReadContext(ctx, fileId, offset, fileSize)
+	if err != nil {
+		return nil, err
+	}
+	return ReadCloser(ctx, r, c.limits.Download, c.limits.Total), nil
+}
+
+func (c *throttledClient) Save(fileName string, file io.Reader, maxRead int64) (string, error) {
+	return c.SaveContext(context.Background(), fileName, file, maxRead)
+}
+
+func (c *throttledClient) SaveContext(ctx context.Context, fileName string, file io.Reader, maxRead int64) (string, error) {
+	return c.Client.SaveContext(ctx, fileName, Reader(ctx, file, c.limits.Upload, c.limits.Total), maxRead)
+}
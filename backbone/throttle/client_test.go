@@ -0,0 +1,85 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"splitfuseX/backbone/local"
+)
+
+func TestClient(t *testing.T) {
+	client := NewClient(local.NewDiskClient(t.TempDir()), Limits{
+		Upload:   NewLimiter(Schedule{Default: 1024 * 1024}),
+		Download: NewLimiter(Schedule{Default: 2 * 1024 * 1024}),
+	})
+	data := bytes.Repeat([]byte("splitfuse"), 256*1024/9)
+
+	// Upload mit 1MB/s
+	start := time.Now()
+	fileId, err := client.Save("chunk", bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("upload of 256KB at 1MB/s took only %v", elapsed)
+	}
+
+	// Download mit 2MB/s
+	start = time.Now()
+	r, err := client.Read(fileId, 0, 20000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("downloaded data differs")
+	}
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Fatalf("download of 256KB at 2MB/s took only %v", elapsed)
+	}
+}
+
+func TestClientUnlimited(t *testing.T) {
+	disk := local.NewDiskClient(t.TempDir())
+	if client := NewClient(disk, Limits{}); client != disk {
+		t.Fatal("without limits the client should be returned unchanged")
+	}
+}
+
+func TestReader(t *testing.T) {
+	limiter := NewLimiter(Schedule{Default: 1024})
+	data := bytes.Repeat([]byte("x"), 100)
+
+	// ein Seeker bleibt ein Seeker
+	r := Reader(context.Background(), bytes.NewReader(data), limiter, nil)
+	ioutil.ReadAll(io.LimitReader(r, 50))
+	if pos, err := r.(io.Seeker).Seek(0, io.SeekStart); err != nil || pos != 0 {
+		t.Fatalf("seek: %d, %v", pos, err)
+	}
+	if got, _ := ioutil.ReadAll(r); !bytes.Equal(got, data) {
+		t.Fatalf("read after seek: %q", got)
+	}
+
+	// ohne Limiter wird nichts umhüllt
+	inner := bytes.NewReader(data)
+	if Reader(context.Background(), inner, nil) != inner {
+		t.Fatal("without limiters the reader should be returned unchanged")
+	}
+
+	// abbrechen
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	big := bytes.Repeat([]byte("x"), 1024*1024)
+	if _, err := ioutil.ReadAll(Reader(ctx, bytes.NewReader(big), limiter)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+}
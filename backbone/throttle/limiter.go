@@ -0,0 +1,94 @@
+// Package throttle begrenzt die Bandbreite beim Lesen aus und Schreiben in einen backbone.Client.
+// Die Grenzen gelten für alle Streams zusammen (zB alle parallelen Uploads) und können von der Uhrzeit abhängen (siehe Schedule).
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxRead begrenzt, wie viele Bytes ein einzelnes Read auf einmal liest.
+// Damit bleiben die Pausen kurz und die Bandbreite wird gleichmäßig auf alle Streams verteilt.
+const maxRead = 32 * 1024
+
+// Limiter ist ein token bucket mit einer Bandbreite nach Zeitplan.
+// Ein Limiter kann von mehreren goroutines gleichzeitig verwendet werden.
+type Limiter struct {
+	mutex    *sync.Mutex // schützt tokens und last
+	schedule Schedule
+	tokens   float64   // verfügbare Bytes (negativ, wenn bereits Bytes reserviert sind)
+	last     time.Time // Zeitpunkt der letzten Aktualisierung von tokens
+	now      func() time.Time
+}
+
+// NewLimiter erzeugt einen Limiter mit dem Zeitplan. Ein Zeitplan ohne Begrenzung ergibt nil (siehe Schedule.Unlimited).
+// Alle Methoden können auch mit einem nil Limiter aufgerufen werden und warten dann nie.
+func NewLimiter(schedule Schedule) *Limiter {
+	if schedule.Unlimited() {
+		return nil
+	}
+	return &Limiter{mutex: &sync.Mutex{}, schedule: schedule, tokens: maxRead, now: time.Now}
+}
+
+// Schedule gibt den Zeitplan des Limiters zurück.
+func (l *Limiter) Schedule() Schedule {
+	if l == nil {
+		return Schedule{}
+	}
+	return l.schedule
+}
+
+// WaitN wartet, bis n Bytes übertragen werden dürfen (oder der ctx beendet wird).
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return ctx.Err()
+	}
+	wait := l.reserve(n)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve zieht n Bytes vom bucket ab und gibt die Wartezeit zurück, bis sie verfügbar sind.
+func (l *Limiter) reserve(n int) time.Duration {
+	// LOCK
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	rate := float64(l.schedule.Rate(now))
+	if rate <= 0 {
+		// gerade unbegrenzt
+		l.tokens = maxRead
+		l.last = now
+		return 0
+	}
+
+	// auffüllen (max. maxRead bzw. die Bytes einer Sekunde, damit nach einer Pause kein großer Burst entsteht)
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * rate
+	}
+	l.last = now
+	burst := rate
+	if burst > maxRead {
+		burst = maxRead
+	}
+	if l.tokens > burst {
+		l.tokens = burst
+	}
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / rate * float64(time.Second))
+}
@@ -0,0 +1,71 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(Schedule{Default: 1024 * 1024})
+	ctx := context.Background()
+
+	// 512KB bei 1MB/s (abzüglich des Bursts) dauern knapp eine halbe Sekunde, auch verteilt auf mehrere goroutines
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 8; j++ {
+				if err := limiter.WaitN(ctx, 16*1024); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("512KB at 1MB/s took %v", elapsed)
+	}
+}
+
+func TestLimiterSchedule(t *testing.T) {
+	day := time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local)
+	limiter := NewLimiter(Schedule{Rules: []Rule{{From: 8 * time.Hour, To: 18 * time.Hour, Rate: 1024}}})
+	limiter.now = func() time.Time { return day }
+
+	// tagsüber begrenzt
+	if wait := limiter.reserve(maxRead); wait <= 0 {
+		t.Fatal("expected a wait during the day")
+	}
+
+	// nachts unbegrenzt
+	day = day.Add(10 * time.Hour)
+	for i := 0; i < 100; i++ {
+		if wait := limiter.reserve(maxRead); wait != 0 {
+			t.Fatalf("unexpected wait at night: %v", wait)
+		}
+	}
+}
+
+func TestLimiterContext(t *testing.T) {
+	limiter := NewLimiter(Schedule{Default: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := limiter.WaitN(ctx, 1024*1024); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestLimiterNil(t *testing.T) {
+	limiter := NewLimiter(Schedule{})
+	if limiter != nil {
+		t.Fatal("unlimited schedule should return nil")
+	}
+	if err := limiter.WaitN(context.Background(), 1024*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,59 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Reader begrenzt die Bandbreite beim Lesen von r mit allen Limitern (nil wird ignoriert).
+// Das Warten bricht ab, sobald der ctx beendet wird (Read gibt dann den Fehler des ctx zurück).
+// Ist r ein io.Seeker, dann kann auch der zurückgegebene Reader springen (zB für die Wiederholung eines Uploads).
+func Reader(ctx context.Context, r io.Reader, limiters ...*Limiter) io.Reader {
+	var active []*Limiter
+	for _, l := range limiters {
+		if l != nil {
+			active = append(active, l)
+		}
+	}
+	if len(active) == 0 {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, limiters: active}
+}
+
+// ReadCloser ist wie Reader, Close wird an den ReadCloser weitergegeben.
+func ReadCloser(ctx context.Context, r io.ReadCloser, limiters ...*Limiter) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{Reader(ctx, r, limiters...), r}
+}
+
+// reader wartet nach jedem Read auf alle Limiter.
+type reader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > maxRead {
+		p = p[:maxRead]
+	}
+	n, err := r.r.Read(p)
+	for _, l := range r.limiters {
+		if waitErr := l.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := r.r.(io.Seeker)
+	if !ok {
+		return 0, errors.New("can't seek: inner reader is not an io.Seeker")
+	}
+	return seeker.Seek(offset, whence)
+}
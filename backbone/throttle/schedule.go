@@ -0,0 +1,148 @@
+package throttle
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/units"
+)
+
+// Schedule legt die erlaubte Bandbreite (Bytes pro Sekunde) abhängig von der Uhrzeit fest.
+// Ein Wert von 0 bedeutet unbegrenzt.
+type Schedule struct {
+	Default int64  // gilt, wenn keine Regel passt
+	Rules   []Rule // die erste passende Regel gewinnt
+}
+
+// Rule ist ein Zeitfenster (Uhrzeit in lokaler Zeit) mit eigener Bandbreite.
+// Ist From größer als To, dann geht das Fenster über Mitternacht (zB 22:00-06:00).
+type Rule struct {
+	From time.Duration // seit Mitternacht
+	To   time.Duration // seit Mitternacht (exklusiv)
+	Rate int64         // Bytes pro Sekunde (0 bedeutet unbegrenzt)
+}
+
+// ParseSchedule liest einen Zeitplan im Format "RATE" oder "RATE,HH:MM-HH:MM=RATE,..." (zB "10MB,08:00-18:00=1MB").
+// Ein Eintrag ohne Zeitfenster ist der Standardwert, RATE verwendet die Einheiten von kingpin (zB 512KB, 2MB oder 0).
+// Ein leerer String ergibt einen Zeitplan ohne Begrenzung.
+func ParseSchedule(s string) (Schedule, error) {
+	var schedule Schedule
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		// Standardwert
+		window, rateStr, hasWindow := strings.Cut(entry, "=")
+		if !hasWindow {
+			rate, err := parseRate(entry)
+			if err != nil {
+				return Schedule{}, err
+			}
+			schedule.Default = rate
+			continue
+		}
+
+		// Zeitfenster
+		fromStr, toStr, ok := strings.Cut(window, "-")
+		if !ok {
+			return Schedule{}, fmt.Errorf("invalid time window %q: use HH:MM-HH:MM", window)
+		}
+		from, err := parseTimeOfDay(fromStr)
+		if err != nil {
+			return Schedule{}, err
+		}
+		to, err := parseTimeOfDay(toStr)
+		if err != nil {
+			return Schedule{}, err
+		}
+		rate, err := parseRate(rateStr)
+		if err != nil {
+			return Schedule{}, err
+		}
+		schedule.Rules = append(schedule.Rules, Rule{From: from, To: to, Rate: rate})
+	}
+	return schedule, nil
+}
+
+// Rate gibt die Bandbreite zum Zeitpunkt t zurück (0 bedeutet unbegrenzt).
+func (s Schedule) Rate(t time.Time) int64 {
+	h, m, sec := t.Clock()
+	now := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	for _, rule := range s.Rules {
+		if rule.contains(now) {
+			return rule.Rate
+		}
+	}
+	return s.Default
+}
+
+// Unlimited ist true, wenn der Zeitplan nie begrenzt.
+func (s Schedule) Unlimited() bool {
+	if s.Default != 0 {
+		return false
+	}
+	for _, rule := range s.Rules {
+		if rule.Rate != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// String gibt den Zeitplan im Format von ParseSchedule zurück.
+func (s Schedule) String() string {
+	entries := []string{formatRate(s.Default)}
+	for _, rule := range s.Rules {
+		entries = append(entries, fmt.Sprintf("%s-%s=%s", formatTimeOfDay(rule.From), formatTimeOfDay(rule.To), formatRate(rule.Rate)))
+	}
+	return strings.Join(entries, ",")
+}
+
+// contains prüft, ob die Uhrzeit (seit Mitternacht) im Zeitfenster liegt.
+func (r Rule) contains(now time.Duration) bool {
+	if r.From <= r.To {
+		return now >= r.From && now < r.To
+	}
+	return now >= r.From || now < r.To // über Mitternacht
+}
+
+// parseRate liest eine Bandbreite in Bytes pro Sekunde (zB 512KB oder 0).
+func parseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "0" {
+		return 0, nil
+	}
+	rate, err := units.ParseBase2Bytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %v", s, err)
+	}
+	if rate < 0 {
+		return 0, fmt.Errorf("invalid rate %q: must not be negative", s)
+	}
+	return int64(rate), nil
+}
+
+// formatRate ist das Gegenstück zu parseRate.
+func formatRate(rate int64) string {
+	if rate == 0 {
+		return "0"
+	}
+	return units.Base2Bytes(rate).String()
+}
+
+// parseTimeOfDay liest eine Uhrzeit im Format HH:MM (00:00 bis 24:00).
+func parseTimeOfDay(s string) (time.Duration, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time of day %q: use HH:MM", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// formatTimeOfDay ist das Gegenstück zu parseTimeOfDay.
+func formatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
@@ -0,0 +1,62 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	schedule, err := ParseSchedule("10MB, 08:00-18:00=1MB,22:00-06:00=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.Default != 10*1024*1024 || len(schedule.Rules) != 2 {
+		t.Fatalf("unexpected schedule: %+v", schedule)
+	}
+	if s := schedule.String(); s != "10MiB,08:00-18:00=1MiB,22:00-06:00=0" {
+		t.Errorf("String() = %q", s)
+	}
+
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		at   time.Duration
+		rate int64
+	}{
+		{7*time.Hour + 59*time.Minute, 10 * 1024 * 1024},
+		{8 * time.Hour, 1024 * 1024},
+		{17*time.Hour + 59*time.Minute, 1024 * 1024},
+		{18 * time.Hour, 10 * 1024 * 1024},
+		{23 * time.Hour, 0},
+		{3 * time.Hour, 0},
+		{6 * time.Hour, 10 * 1024 * 1024},
+	}
+	for _, test := range tests {
+		if rate := schedule.Rate(day.Add(test.at)); rate != test.rate {
+			t.Errorf("Rate(%v) = %d, want %d", test.at, rate, test.rate)
+		}
+	}
+}
+
+func TestParseScheduleUnlimited(t *testing.T) {
+	for _, s := range []string{"", "0", "0,08:00-18:00=0"} {
+		schedule, err := ParseSchedule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !schedule.Unlimited() {
+			t.Errorf("%q should be unlimited", s)
+		}
+	}
+	schedule, _ := ParseSchedule("08:00-18:00=512KB")
+	if schedule.Unlimited() || schedule.Default != 0 {
+		t.Errorf("only limited during the day: %+v", schedule)
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, s := range []string{"fast", "-1MB", "08:00=1MB", "8-18=1MB", "08:00-25:00=1MB", "08:00-18:00=", "08:61-18:00=1MB"} {
+		if _, err := ParseSchedule(s); err == nil {
+			t.Errorf("ParseSchedule(%q) should fail", s)
+		}
+	}
+}
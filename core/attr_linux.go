@@ -0,0 +1,77 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+
+	"splitfuseX/logging"
+)
+
+// statusChangeTime gibt die ctime (letzte Änderung der Metadaten) zurück.
+func statusChangeTime(info os.FileInfo) uint64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return uint64(info.ModTime().Unix())
+	}
+	return uint64(st.Ctim.Sec)
+}
+
+// readXattrs liest alle erweiterten Attribute einer Datei oder eines Ordners.
+// Symbolische Links werden nicht verfolgt und haben daher keine Attribute.
+// Unterstützt das Dateisystem keine xattrs, dann wird nil zurück gegeben.
+// Kann ein einzelnes Attribut nicht gelesen werden, dann wird es übersprungen (und protokolliert).
+func readXattrs(path string, info os.FileInfo) (map[string][]byte, error) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, nil
+	}
+
+	// Liste der Namen lesen (erst Größe ermitteln, dann lesen)
+	size, err := syscall.Listxattr(path, nil)
+	if err == syscall.ENOTSUP || err == syscall.ENODATA {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Die Namen sind mit \0 getrennt
+	ret := make(map[string][]byte)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := getXattr(path, string(name))
+		if err == syscall.ENODATA {
+			continue // inzwischen gelöscht
+		}
+		if err != nil {
+			logging.Warn("scan: skip xattr", logging.Path(path), logging.F("name", string(name)), logging.Err(err))
+			continue
+		}
+		ret[string(name)] = value
+	}
+	return ret, nil
+}
+
+// getXattr liest den Wert eines erweiterten Attributs (erst Größe ermitteln, dann lesen).
+func getXattr(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	size, err = syscall.Getxattr(path, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
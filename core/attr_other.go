@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package core
+
+import (
+	"os"
+)
+
+// statusChangeTime: Ohne Linux wird die mtime verwendet.
+func statusChangeTime(info os.FileInfo) uint64 {
+	return uint64(info.ModTime().Unix())
+}
+
+// readXattrs: Erweiterte Attribute werden nur unter Linux unterstützt.
+func readXattrs(path string, info os.FileInfo) (map[string][]byte, error) {
+	return nil, nil
+}
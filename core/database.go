@@ -10,6 +10,9 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"sort"
+	"time"
 )
 
 // SfDb ist eine Map, dessen Key der Pfad eines Ordners oder einer Datei ist und
@@ -21,13 +24,95 @@ type SfDb map[string]SfFile
 // Ist das Objekt eine Datei, so wird FileChunks gesetzt. Ist es ein Ordner so ist FolderContent gesetzt.
 type SfFile struct {
 	// Attr
-	Size  int64  // size in bytes
-	Mtime uint64 // time of last modification
+	Size      int64  // size in bytes
+	Mtime     uint64 // time of last modification (seconds)
+	MtimeNsec uint32 // time of last modification (nanoseconds within the second, 0 for old DBs)
 
 	// file or folder
 	IsFile        bool            // true is file, false is folder
 	FileChunks    []ChunkHash     // if file: the full chunk list of this file
 	FolderContent []FolderContent // if folder: a list ob sub elements of this folder
+
+	// special files
+	Type       FileType // regular, dir, symlink, ... (bei alten DBs nicht gesetzt, siehe GetType())
+	LinkTarget string   // if symlink: the target of the link
+	LinkGroup  uint64   // if hardlink: all files with the same group share the chunk list (0 = no hardlink)
+	Nlink      uint32   // if hardlink: number of files in the group
+	Rdev       uint64   // if device: device number
+
+	// posix
+	Mode   uint32            // permission bits incl. setuid, setgid and sticky (only valid if Ctime is set)
+	Uid    uint32            // user id of the owner
+	Gid    uint32            // group id of the owner
+	Ctime  uint64            // time of last status change (0 = old DB without posix attributes)
+	Xattrs map[string][]byte // extended attributes (name -> value)
+}
+
+// FileType gibt an, um welche Art von Element es sich handelt.
+type FileType uint8
+
+const (
+	TypeUnknown     FileType = iota // alte DBs ohne Typ: IsFile entscheidet
+	TypeRegular                     // normale Datei mit Chunks
+	TypeDir                         // Ordner mit FolderContent
+	TypeSymlink                     // symbolischer Link mit LinkTarget
+	TypeFifo                        // named pipe (ohne Inhalt)
+	TypeSocket                      // unix socket (ohne Inhalt)
+	TypeCharDevice                  // zeichenorientiertes Gerät (Rdev)
+	TypeBlockDevice                 // blockorientiertes Gerät (Rdev)
+)
+
+// GetType gibt den Typ des Elements zurück.
+// Bei alten DBs ohne Typ wird er aus IsFile abgeleitet.
+func (f SfFile) GetType() FileType {
+	return typeOrLegacy(f.Type, f.IsFile)
+}
+
+// ModTime gibt die Zeit der letzten Änderung mit Nanosekunden zurück.
+func (f SfFile) ModTime() time.Time {
+	return time.Unix(int64(f.Mtime), int64(f.MtimeNsec))
+}
+
+// HasPosixAttr gibt true zurück, wenn Mode, Uid, Gid und Ctime beim Scannen erfasst wurden.
+// Bei alten DBs müssen Standardwerte verwendet werden.
+func (f SfFile) HasPosixAttr() bool {
+	return f.Ctime != 0
+}
+
+// IsRegular gibt true zurück, wenn das Element eine normale Datei ist, die aus Chunks besteht.
+func (f SfFile) IsRegular() bool {
+	return f.GetType() == TypeRegular
+}
+
+// typeOrLegacy leitet den Typ bei alten DB Einträgen aus dem IsFile Flag ab.
+func typeOrLegacy(t FileType, isFile bool) FileType {
+	if t != TypeUnknown {
+		return t
+	}
+	if isFile {
+		return TypeRegular
+	}
+	return TypeDir
+}
+
+// fileTypeFromMode ermittelt den FileType aus dem os.FileMode (von os.Lstat).
+func fileTypeFromMode(mode os.FileMode) FileType {
+	switch {
+	case mode.IsDir():
+		return TypeDir
+	case mode&os.ModeSymlink != 0:
+		return TypeSymlink
+	case mode&os.ModeNamedPipe != 0:
+		return TypeFifo
+	case mode&os.ModeSocket != 0:
+		return TypeSocket
+	case mode&os.ModeCharDevice != 0:
+		return TypeCharDevice
+	case mode&os.ModeDevice != 0:
+		return TypeBlockDevice
+	default:
+		return TypeRegular
+	}
 }
 
 // ChunkHash ist ein sha512 Hash (64 bytes) über den Klartext eines Chunks.
@@ -39,6 +124,13 @@ type ChunkHash [64]byte
 type FolderContent struct {
 	Name   string
 	IsFile bool
+	Type   FileType // bei alten DBs nicht gesetzt, siehe GetType()
+}
+
+// GetType gibt den Typ des Elements zurück.
+// Bei alten DBs ohne Typ wird er aus IsFile abgeleitet.
+func (c FolderContent) GetType() FileType {
+	return typeOrLegacy(c.Type, c.IsFile)
 }
 
 // ------------------------------------------------------------------------------------------------------------------ //
@@ -212,6 +304,24 @@ func DbFromReader(r io.Reader, key []byte) (db SfDb, err error) {
 	return
 }
 
+// ChangedPaths gibt alle Pfade zurück, die in nur einer der beiden DBs vorkommen oder sich unterscheiden.
+// Die Liste ist sortiert, damit Elternordner vor ihrem Inhalt stehen.
+func ChangedPaths(oldDB, newDB SfDb) []string {
+	ret := make([]string, 0)
+	for p, o := range oldDB {
+		if n, ok := newDB[p]; !ok || !reflect.DeepEqual(o, n) {
+			ret = append(ret, p)
+		}
+	}
+	for p := range newDB {
+		if _, ok := oldDB[p]; !ok {
+			ret = append(ret, p)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
 // ------------------------------------------------------------------------------------------------------------------ //
 
 // Wandelt ein Sha512 Hash in ein ChunkHash Objekt um.
@@ -51,13 +51,13 @@ func init() {
 			Mtime:         34,
 			IsFile:        false,
 			FileChunks:    nil,
-			FolderContent: []FolderContent{{"file", true}, {"folder", false}},
+			FolderContent: []FolderContent{{Name: "file", IsFile: true}, {Name: "folder", IsFile: false}},
 		},
 		"großes haus": SfFile{
 			Size:          9,
 			Mtime:         34,
 			IsFile:        true,
-			FolderContent: []FolderContent{{"file", true}, {"folder", false}},
+			FolderContent: []FolderContent{{Name: "file", IsFile: true}, {Name: "folder", IsFile: false}},
 		},
 		"jejejeje": SfFile{
 			Size:   923923,
@@ -235,3 +235,27 @@ func TestCalcChunkSize(t *testing.T) {
 		t.Errorf("TestCalcChunkSize Test #21: (%d)", x)
 	}
 }
+
+func TestChangedPaths(t *testing.T) {
+	oldDB := SfDb{
+		".":   SfFile{FolderContent: []FolderContent{{Name: "a"}, {Name: "b"}}},
+		"a":   SfFile{IsFile: true, Size: 1},
+		"b":   SfFile{IsFile: true, Size: 2},
+		"del": SfFile{IsFile: true},
+	}
+	newDB := SfDb{
+		".":   SfFile{FolderContent: []FolderContent{{Name: "a"}, {Name: "b"}, {Name: "new"}}},
+		"a":   SfFile{IsFile: true, Size: 1},
+		"b":   SfFile{IsFile: true, Size: 3},
+		"new": SfFile{IsFile: true},
+	}
+
+	got := ChangedPaths(oldDB, newDB)
+	want := []string{".", "b", "del", "new"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedPaths() = %v, want %v", got, want)
+	}
+	if len(ChangedPaths(newDB, newDB)) != 0 {
+		t.Errorf("no changes expected")
+	}
+}
@@ -0,0 +1,32 @@
+package core
+
+import "errors"
+
+// ExitError ist ein Fehler mit einem Exit Code für die Kommandozeile (zB 11 ... client_secret nicht gefunden).
+// Die Pakete geben Fehler nur zurück, beendet wird das Programm ausschließlich in main (siehe ExitCode).
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+// Error gibt die Meldung des eigentlichen Fehlers zurück.
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap gibt den eigentlichen Fehler zurück (für errors.Is und errors.As).
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode gibt den Exit Code eines Fehlers zurück: 0 ohne Fehler, 1 für Fehler ohne ExitError.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return 1
+}
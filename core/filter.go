@@ -0,0 +1,368 @@
+package core
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// IGNOREFILE ist der Standardname der Ignore-Datei, die in jedem Ordner des gescannten Baums liegen kann.
+const IGNOREFILE = ".splitfuseignore"
+
+// Filter entscheidet, welche Dateien und Ordner beim Scannen (und damit auch beim Upload) berücksichtigt werden.
+// Die Regeln folgen der gitignore Syntax: Die letzte passende Regel gewinnt und mit '!' kann wieder eingeschlossen werden.
+// Ein nil Filter lässt alles durch.
+type Filter struct {
+	Exclude    []string      // gitignore Muster relativ zum Root-Ordner (zB 'Thumbs.db', '.Trash-*/', '/tmp')
+	Include    []string      // wenn gesetzt, werden nur Dateien aufgenommen, die einem dieser Muster entsprechen
+	IgnoreFile string        // Name der Ignore-Datei in den Ordnern (leerer String deaktiviert diese Funktion)
+	MinSize    int64         // Dateien kleiner als MinSize werden ignoriert (0 = keine Grenze)
+	MaxSize    int64         // Dateien größer als MaxSize werden ignoriert (0 = keine Grenze)
+	MinAge     time.Duration // Dateien, die jünger sind, werden ignoriert (zB noch laufende Downloads)
+	MaxAge     time.Duration // Dateien, die älter sind, werden ignoriert (0 = keine Grenze)
+
+	now      time.Time
+	rules    map[string][]filterRule // key ist der relative Ordner ('.' für root), in dem die Regeln gelten (Exclude)
+	ignores  map[string][]filterRule // Regeln aus den Ignore-Dateien, key wie bei rules
+	loaded   map[string]time.Time    // Ordner, deren Ignore-Datei bereits gelesen wurde (mit ihrer mtime, 0 = keine Datei)
+	includes []filterRule
+}
+
+// filterRule ist ein einzelnes, bereits übersetztes gitignore Muster.
+type filterRule struct {
+	re      *regexp.Regexp
+	negate  bool // '!' am Anfang: wieder einschließen
+	dirOnly bool // '/' am Ende: trifft nur auf Ordner zu
+}
+
+// NewFilter erzeugt einen Filter mit den übergebenen Mustern und der Standard Ignore-Datei.
+func NewFilter(exclude, include []string) *Filter {
+	return &Filter{
+		Exclude:    exclude,
+		Include:    include,
+		IgnoreFile: IGNOREFILE,
+	}
+}
+
+// init übersetzt die Muster aus Exclude und Include. Wird von ScanFolder einmal pro Scan aufgerufen.
+func (f *Filter) init() {
+	if f == nil {
+		return
+	}
+	f.now = time.Now()
+	f.rules = make(map[string][]filterRule)
+	f.rules["."] = parseRules(f.Exclude)
+	f.ignores = make(map[string][]filterRule)
+	f.loaded = make(map[string]time.Time)
+	f.includes = parseRules(f.Include)
+}
+
+// loadIgnoreFile liest die Ignore-Datei im angegebenen Ordner (falls vorhanden).
+// Die Regeln darin gelten für den Ordner und alle Unterordner.
+func (f *Filter) loadIgnoreFile(dir, relDir string) error {
+	if f == nil || f.IgnoreFile == "" {
+		return nil
+	}
+	if _, ok := f.loaded[relDir]; ok {
+		return nil
+	}
+	return f.readIgnoreFile(dir, relDir)
+}
+
+// reloadIgnoreFile ist wie loadIgnoreFile, liest die Ignore-Datei aber erneut, wenn sie seitdem geändert,
+// angelegt oder gelöscht wurde (für SkipPath).
+func (f *Filter) reloadIgnoreFile(dir, relDir string) error {
+	if f == nil || f.IgnoreFile == "" {
+		return nil
+	}
+	mtime, loaded := f.loaded[relDir]
+	if loaded {
+		var current time.Time
+		info, err := os.Stat(filepath.Join(dir, f.IgnoreFile))
+		if err == nil {
+			current = info.ModTime()
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if current.Equal(mtime) {
+			return nil
+		}
+	}
+	return f.readIgnoreFile(dir, relDir)
+}
+
+// readIgnoreFile liest die Ignore-Datei im angegebenen Ordner und ersetzt die bisherigen Regeln daraus.
+func (f *Filter) readIgnoreFile(dir, relDir string) error {
+	delete(f.ignores, relDir)
+	f.loaded[relDir] = time.Time{}
+
+	fh, err := os.Open(filepath.Join(dir, f.IgnoreFile))
+	if os.IsNotExist(err) {
+		return nil // keine Datei -> keine Regeln
+	}
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	if info, err := fh.Stat(); err == nil {
+		f.loaded[relDir] = info.ModTime()
+	}
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	f.ignores[relDir] = parseRules(lines)
+	return nil
+}
+
+// loadParentIgnoreFiles liest die Ignore-Dateien aller Elternordner eines Elements (für UpdatePaths).
+func (f *Filter) loadParentIgnoreFiles(rootpath, relPath string) error {
+	if f == nil {
+		return nil
+	}
+	for _, dir := range parentDirs(path.Dir(filepath.ToSlash(relPath))) {
+		if err := f.loadIgnoreFile(filepath.Join(rootpath, dir), dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clone gibt eine Kopie der Einstellungen ohne den Zustand eines Scans zurück.
+// Ein Filter ist nicht für mehrere goroutines gedacht, die Kopie kann aber unabhängig verwendet werden (zB im watcher).
+func (f *Filter) Clone() *Filter {
+	if f == nil {
+		return nil
+	}
+	return &Filter{
+		Exclude:    f.Exclude,
+		Include:    f.Include,
+		IgnoreFile: f.IgnoreFile,
+		MinSize:    f.MinSize,
+		MaxSize:    f.MaxSize,
+		MinAge:     f.MinAge,
+		MaxAge:     f.MaxAge,
+	}
+}
+
+// SkipPath ist wie Skip, kann aber außerhalb eines Scans aufgerufen werden: Die Muster werden beim ersten Aufruf
+// übersetzt und die Ignore-Dateien aller Elternordner unter rootpath gelesen. Bei jedem weiteren Aufruf wird eine
+// geänderte Ignore-Datei neu gelesen und das Alter (MinAge, MaxAge) mit der aktuellen Zeit verglichen.
+func (f *Filter) SkipPath(rootpath, relPath string, info os.FileInfo) (bool, error) {
+	if f == nil {
+		return false, nil
+	}
+	if f.rules == nil {
+		f.init()
+	}
+	f.now = time.Now()
+	for _, dir := range parentDirs(path.Dir(filepath.ToSlash(relPath))) {
+		if err := f.reloadIgnoreFile(filepath.Join(rootpath, dir), dir); err != nil {
+			return false, err
+		}
+	}
+	return f.Skip(relPath, info), nil
+}
+
+// MinAgeLeft gibt zurück, wie lange eine Datei noch zu jung für MinAge ist (0, wenn sie alt genug ist).
+// Damit kann eine wegen MinAge übersprungene Datei später erneut geprüft werden (siehe watchFunc).
+func (f *Filter) MinAgeLeft(info os.FileInfo) time.Duration {
+	if f == nil || f.MinAge <= 0 || info.IsDir() {
+		return 0
+	}
+	left := f.MinAge - time.Since(info.ModTime())
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// Skip gibt true zurück, wenn das Element (relativer Pfad mit '/' getrennt) nicht gescannt werden soll.
+// Für Ordner bedeutet das, dass auch der gesamte Inhalt übersprungen wird.
+// Der Root-Ordner '.' wird nie übersprungen.
+func (f *Filter) Skip(relPath string, info os.FileInfo) bool {
+	if f == nil || relPath == "." {
+		return false
+	}
+	relPath = filepath.ToSlash(relPath)
+	isDir := info.IsDir()
+
+	// Exclude Regeln: von root bis zum direkten Elternordner, die letzte passende Regel gewinnt
+	excluded := false
+	dir := path.Dir(relPath)
+	for _, base := range parentDirs(dir) {
+		p := relPath
+		if base != "." {
+			p = strings.TrimPrefix(relPath, base+"/")
+		}
+		for _, rules := range [][]filterRule{f.rules[base], f.ignores[base]} {
+			for _, r := range rules {
+				if r.dirOnly && !isDir {
+					continue
+				}
+				if r.re.MatchString(p) {
+					excluded = !r.negate
+				}
+			}
+		}
+	}
+	if excluded {
+		return true
+	}
+
+	// alle weiteren Filter gelten nur für Dateien
+	if isDir {
+		return false
+	}
+
+	// Include Regeln
+	if len(f.includes) > 0 {
+		included := false
+		for _, r := range f.includes {
+			if r.re.MatchString(relPath) {
+				included = !r.negate
+			}
+		}
+		if !included {
+			return true
+		}
+	}
+
+	// Größe
+	size := info.Size()
+	if f.MinSize > 0 && size < f.MinSize {
+		return true
+	}
+	if f.MaxSize > 0 && size > f.MaxSize {
+		return true
+	}
+
+	// Alter
+	now := f.now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	age := now.Sub(info.ModTime())
+	if f.MinAge > 0 && age < f.MinAge {
+		return true
+	}
+	if f.MaxAge > 0 && age > f.MaxAge {
+		return true
+	}
+
+	return false
+}
+
+// parentDirs gibt alle Ordner von root ('.') bis einschließlich dir zurück.
+func parentDirs(dir string) []string {
+	ret := []string{"."}
+	if dir == "." || dir == "" {
+		return ret
+	}
+	parts := strings.Split(dir, "/")
+	for i := range parts {
+		ret = append(ret, strings.Join(parts[:i+1], "/"))
+	}
+	return ret
+}
+
+// parseRules übersetzt gitignore Zeilen in Regeln. Leere Zeilen und Kommentare (#) werden übersprungen.
+func parseRules(lines []string) []filterRule {
+	ret := make([]filterRule, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		r := filterRule{}
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:] // '\#' oder '\!' am Anfang
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		// Ein '/' am Anfang oder in der Mitte verankert das Muster am Ordner der Regel.
+		// Andernfalls passt es auf den Namen in jeder Tiefe.
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+
+		expr := globToRegexp(line)
+		if anchored {
+			expr = "^" + expr + "$"
+		} else {
+			expr = "^(?:.*/)?" + expr + "$"
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			continue // fehlerhafte Muster werden ignoriert (wie bei git)
+		}
+		r.re = re
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+// globToRegexp übersetzt ein gitignore Muster (*, ?, [...], **) in einen regulären Ausdruck.
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				// '**/' passt auf beliebig viele Ordner, '**' am Ende auf alles
+				if i+2 < len(glob) && glob[i+2] == '/' {
+					sb.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					sb.WriteString(".*")
+					i++
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,217 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeInfo ist ein os.FileInfo für die Filter Tests
+type fakeInfo struct {
+	os.FileInfo
+	dir   bool
+	size  int64
+	mtime time.Time
+}
+
+func (fi fakeInfo) IsDir() bool        { return fi.dir }
+func (fi fakeInfo) Size() int64        { return fi.size }
+func (fi fakeInfo) ModTime() time.Time { return fi.mtime }
+
+func TestFilterSkip(t *testing.T) {
+	f := NewFilter([]string{
+		"Thumbs.db",
+		".Trash-*/",
+		"/tmp",
+		"*.part",
+		"!wichtig.part",
+		"cache/**",
+		"a/**/z",
+	}, nil)
+	f.init()
+
+	file := fakeInfo{mtime: time.Now().Add(-time.Hour)}
+	dir := fakeInfo{dir: true}
+
+	tests := []struct {
+		path string
+		info os.FileInfo
+		skip bool
+	}{
+		{".", dir, false},
+		{"Thumbs.db", file, true},
+		{"Filme/Thumbs.db", file, true},
+		{"Filme/Thumbs.dbx", file, false},
+		{".Trash-1000", dir, true},
+		{".Trash-1000", file, false}, // nur Ordner
+		{"tmp", dir, true},
+		{"Filme/tmp", dir, false}, // verankert
+		{"Filme/x.part", file, true},
+		{"Filme/wichtig.part", file, false}, // wieder eingeschlossen
+		{"cache/x/y", file, true},
+		{"a/z", file, true},
+		{"a/b/c/z", file, true},
+		{"b/a/z", file, false},
+		{"Filme/film.mkv", file, false},
+	}
+	for _, tt := range tests {
+		if s := f.Skip(tt.path, tt.info); s != tt.skip {
+			t.Errorf("Skip(%s) = %v, want %v", tt.path, s, tt.skip)
+		}
+	}
+
+	// nil Filter lässt alles durch
+	var n *Filter
+	if n.Skip("Thumbs.db", file) {
+		t.Errorf("nil filter should not skip")
+	}
+}
+
+func TestFilterIncludeSizeAge(t *testing.T) {
+	f := &Filter{
+		Include: []string{"*.mkv", "Bilder/"},
+		MinSize: 10,
+		MaxSize: 100,
+		MinAge:  time.Minute,
+		MaxAge:  24 * time.Hour,
+	}
+	f.init()
+
+	old := time.Now().Add(-time.Hour)
+	tests := []struct {
+		path string
+		info os.FileInfo
+		skip bool
+	}{
+		{"Filme/a.mkv", fakeInfo{size: 50, mtime: old}, false},
+		{"Filme/a.avi", fakeInfo{size: 50, mtime: old}, true},             // kein Include
+		{"Bilder", fakeInfo{dir: true}, false},                            // Ordner werden nicht gefiltert
+		{"Filme/a.mkv", fakeInfo{size: 5, mtime: old}, true},              // zu klein
+		{"Filme/a.mkv", fakeInfo{size: 500, mtime: old}, true},            // zu groß
+		{"Filme/a.mkv", fakeInfo{size: 50, mtime: time.Now()}, true},      // zu jung
+		{"Filme/a.mkv", fakeInfo{size: 50, mtime: time.Unix(0, 0)}, true}, // zu alt
+	}
+	for _, tt := range tests {
+		if s := f.Skip(tt.path, tt.info); s != tt.skip {
+			t.Errorf("Skip(%s) = %v, want %v", tt.path, s, tt.skip)
+		}
+	}
+}
+
+func TestScanFolderFilter(t *testing.T) {
+	// Testordner anlegen
+	root := filepath.Join(os.TempDir(), "filter_test")
+	os.RemoveAll(root)
+	for _, d := range []string{"a", "a/.Trash-1000", "b"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"x.txt":               "x",
+		"Thumbs.db":           "thumbs",
+		"a/y.txt":             "y",
+		"a/y.tmp":             "tmp",
+		"a/.Trash-1000/z.txt": "z",
+		"a/" + IGNOREFILE:     "*.tmp\n.Trash-*/\n",
+		"b/y.tmp":             "tmp",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// scannen
+	newDB, _, _, err := ScanFolder(root, SfDb{}, NewFilter([]string{"Thumbs.db"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// prüfen
+	for _, p := range []string{".", "x.txt", "a", "a/y.txt", "a/" + IGNOREFILE, "b", "b/y.tmp"} {
+		if _, ok := newDB[p]; !ok {
+			t.Errorf("missing in db: %s", p)
+		}
+	}
+	for _, p := range []string{"Thumbs.db", "a/y.tmp", "a/.Trash-1000", "a/.Trash-1000/z.txt"} {
+		if _, ok := newDB[p]; ok {
+			t.Errorf("should not be in db: %s", p)
+		}
+	}
+	for _, c := range newDB["a"].FolderContent {
+		if c.Name == "y.tmp" || c.Name == ".Trash-1000" {
+			t.Errorf("should not be in folder content: %s", c.Name)
+		}
+	}
+	for _, c := range newDB["."].FolderContent {
+		if c.Name == "Thumbs.db" {
+			t.Errorf("should not be in folder content: %s", c.Name)
+		}
+	}
+}
+
+func TestFilterSkipPath(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, IGNOREFILE), []byte("tmp/\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir := fakeInfo{dir: true}
+
+	// die Kopie hat die Einstellungen, aber keinen Zustand
+	f := NewFilter([]string{"cache/"}, nil)
+	f.init()
+	clone := f.Clone()
+	if clone.rules != nil || clone.IgnoreFile != IGNOREFILE || len(clone.Exclude) != 1 {
+		t.Fatalf("wrong clone: %+v", clone)
+	}
+
+	for path, want := range map[string]bool{"cache": true, "tmp": true, "a/tmp": true, "a": false} {
+		if skip, err := clone.SkipPath(root, path, dir); err != nil || skip != want {
+			t.Errorf("SkipPath(%q) = %v, %v, want %v", path, skip, err, want)
+		}
+	}
+	if skip, err := (*Filter)(nil).SkipPath(root, "cache", dir); err != nil || skip {
+		t.Errorf("nil filter: %v, %v", skip, err)
+	}
+
+	// eine geänderte Ignore-Datei wird neu gelesen
+	ignoreFile := filepath.Join(root, IGNOREFILE)
+	if err := ioutil.WriteFile(ignoreFile, []byte("a/\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(ignoreFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{"tmp": false, "a": true} {
+		if skip, err := clone.SkipPath(root, path, dir); err != nil || skip != want {
+			t.Errorf("after change: SkipPath(%q) = %v, %v, want %v", path, skip, err, want)
+		}
+	}
+	if err := os.Remove(ignoreFile); err != nil {
+		t.Fatal(err)
+	}
+	if skip, err := clone.SkipPath(root, "a", dir); err != nil || skip {
+		t.Errorf("after remove: SkipPath(a) = %v, %v", skip, err)
+	}
+
+	// das Alter wird bei jedem Aufruf mit der aktuellen Zeit verglichen
+	clone.MinAge = 50 * time.Millisecond
+	file := fakeInfo{mtime: time.Now()}
+	if skip, _ := clone.SkipPath(root, "x", file); !skip {
+		t.Error("young file should be skipped")
+	}
+	if left := clone.MinAgeLeft(file); left <= 0 || left > clone.MinAge {
+		t.Errorf("MinAgeLeft = %v", left)
+	}
+	time.Sleep(clone.MinAge)
+	if skip, _ := clone.SkipPath(root, "x", file); skip {
+		t.Error("file is old enough now")
+	}
+	if left := clone.MinAgeLeft(file); left != 0 {
+		t.Errorf("MinAgeLeft = %v, want 0", left)
+	}
+}
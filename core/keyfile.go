@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/sha512"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -54,12 +55,30 @@ type cryptReader struct {
 // Read implementiert die Verschlüsselung im Reader
 func (cr *cryptReader) Read(p []byte) (n int, err error) {
 	n, err = cr.innerReader.Read(p)
-	CryptBytes(p, cr.offset, cr.chunkKey)
+	if cryptErr := CryptBytes(p[:n], cr.offset, cr.chunkKey); cryptErr != nil {
+		return 0, cryptErr
+	}
 	cr.offset += int64(n)
 	return n, err
 }
 
+// Seek setzt die Position im inneren Reader (dieser muss ein io.Seeker sein, zB io.SectionReader).
+// Die Position 0 des inneren Readers muss dabei der Anfang des Chunks sein.
+func (cr *cryptReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := cr.innerReader.(io.Seeker)
+	if !ok {
+		return 0, errors.New("can't seek: inner reader is not an io.Seeker")
+	}
+	pos, err := seeker.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	cr.offset = pos
+	return pos, nil
+}
+
 // CryptReader kapselt den übergebenen Reader und sort dafür, dass er verschlüsselt wird.
+// Ist der Reader ein io.Seeker (mit dem Anfang des Chunks bei 0), dann kann auch der zurückgegebene Reader springen.
 func CryptReader(r io.Reader, chunkKey []byte) io.Reader {
 	// new crypt reader
 	cr := &cryptReader{
@@ -76,7 +95,7 @@ func CryptReader(r io.Reader, chunkKey []byte) io.Reader {
 // CryptBytes ver- oder entschlüsselt die übergebenen bytes aus einem Chunk.
 // Von wo im Chunks die bytes stammen, muss mit dem offset angegeben werden.
 // ACHTUNG: Die Werte in data werden durch die Funktion verändert.
-// Im Fehlerfall wird ein error zurück gegeben und die Daten bleiben unverändert
+// Im Fehlerfall (falsche Schlüssellänge) wird ein error zurück gegeben und die Daten bleiben unverändert
 //
 // Verschlüsselung: AES-CTR
 //   Es gibt keinen Nonce. Jeder Chunk muss daher einen eigenen Key haben.
@@ -85,7 +104,7 @@ func CryptReader(r io.Reader, chunkKey []byte) io.Reader {
 //   [{"op":"AES Encrypt","args":[{"option":"Hex","string":"0101010101010...256 Bit PartKey...01010101010101"},
 //   {"option":"Hex","string":"00000000000000000000000000000001"},
 //   {"option":"Hex","string":""},"CTR","NoPadding","Key","Hex"]}]
-func CryptBytes(data []byte, offset int64, chunkKey []byte) {
+func CryptBytes(data []byte, offset int64, chunkKey []byte) error {
 
 	// Berechnet den AES-Block, in dem die bytes starten (muss nicht der Blockanfang sein)
 	// Diese Blocknummer ist dann auch der Counter, da wir bei 0 mit dem Zählen beginnen.
@@ -108,7 +127,7 @@ func CryptBytes(data []byte, offset int64, chunkKey []byte) {
 	// AES Konfiguration
 	block, err := aes.NewCipher(chunkKey)
 	if err != nil {
-		panic("can't crypt bytes with wrong key length")
+		return errors.New("can't crypt bytes with wrong key length")
 	}
 	stream := cipher.NewCTR(block, iv)
 
@@ -120,56 +139,56 @@ func CryptBytes(data []byte, offset int64, chunkKey []byte) {
 
 	// Daten ent- oder verschlüsseln
 	stream.XORKeyStream(data, data)
+	return nil
 }
 
 // Erzeugt ein neues Keyfile das genau 128 random bytes enthält.
 // Existierende Dateien werden NICHT überschrieben.
-// Im Fehlerfall wird mit panic abgebrochen.
-func NewRandomKeyfile(path string) {
+// Im Fehlerfall wird ein error zurück gegeben.
+func NewRandomKeyfile(path string) error {
 	// random key erzeugen
 	randkey := make([]byte, 128)
 	n, err := io.ReadFull(rand.Reader, randkey)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	if n != 128 || len(randkey) != 128 {
-		panic("can't create 128 byte key")
+		return errors.New("can't create 128 byte key")
 	}
 
 	// existiert die datei schon? -> nicht überschreiben
 	if _, err := os.Stat(path); err == nil {
-		panic("file already exists")
+		return fmt.Errorf("file already exists: %s", path)
 	}
 
 	// Datei schreiben
 	err = ioutil.WriteFile(path, randkey, 0600)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	// testweise lesen  (bricht mit panic ab, wenn was nicht stimmt)
-	k := LoadKeyfile(path)
-	k.DbKey()
+	// testweise lesen
+	_, err = LoadKeyfile(path)
+	return err
 }
 
 // LoadKeyfile lädt das Keyfile (genau 128 bytes groß) und generiert daraus die Schlüssel.
-// Im Fehlerfall wird mit panic abgebrochen.
+// Im Fehlerfall wird ein error zurück gegeben.
 //   cryptSecret: Daraus wird der individuelle Chunk Schlüssel für die Verschlüsselung (AES-256-CTR) abgeleitet.
 //   hashSecret: Daraus wird der individuelle ChunkCryptHash für den Chunk Dateiname abgeleitet.
 //   indexSecret: Damit wird die DB verschlüsselt.
-func LoadKeyfile(path string) KeyFile {
+func LoadKeyfile(path string) (KeyFile, error) {
 
-	// Schlüsseldatei einlesen und im Fehlerfall mit panic abbrechen
+	// Schlüsseldatei einlesen
 	filebytes, err := ioutil.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return KeyFile{}, err
 	}
 
-	// In der Datei müssen genau 128 bytes sein, sonst abbruch mit panic.
+	// In der Datei müssen genau 128 bytes sein, sonst abbruch.
 	readlen := len(filebytes)
 	if readlen != 128 {
-		errMsg := fmt.Sprintf("key file must be exactly 128 bytes long (read %d bytes)", readlen)
-		panic(errMsg)
+		return KeyFile{}, fmt.Errorf("key file must be exactly 128 bytes long (read %d bytes)", readlen)
 	}
 
 	// Die Schlüssel ableiten:
@@ -181,5 +200,5 @@ func LoadKeyfile(path string) KeyFile {
 	k.hashSecret = pbkdf2.Key(filebytes[64:], []byte("hash_secret"), 60000, 64, sha512.New)
 	k.indexSecret = pbkdf2.Key(filebytes[32:96], []byte("index_secret"), 99999, 64, sha512.New)
 
-	return k
+	return k, nil
 }
@@ -3,6 +3,7 @@ package core
 import (
 	"bytes"
 	"encoding/hex"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -69,19 +70,17 @@ func TestCalcChunkKey(t *testing.T) {
 // Das keyfile muss genau 128 byte enthalten.
 // Dieser Test prüft, ab das Laden scheitert, wenn es nicht so ist
 func TestFailLoadKeyfile(t *testing.T) {
-
-	defer func() {
-		if r := recover(); r == nil {
-			t.Errorf("The call LoadKeyfile with testfail.keyfile should fail.")
-		}
-	}()
-
-	LoadKeyfile(failKeyFile)
+	if _, err := LoadKeyfile(failKeyFile); err == nil {
+		t.Errorf("The call LoadKeyfile with testfail.keyfile should fail.")
+	}
 }
 
 // Lädt das keyfile und prüft die Ableitung der einzelnen Schlüssel
 func TestLoadKeyfile(t *testing.T) {
-	k := LoadKeyfile(testKeyFile)
+	k, err := LoadKeyfile(testKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if !bytes.Equal(k.cryptSecret, cryptSecret) {
 		t.Errorf("cryptSecret %x is not %x", k.cryptSecret, cryptSecret)
@@ -95,7 +94,7 @@ func TestLoadKeyfile(t *testing.T) {
 }
 
 // schreibt ein neues keyfile
-// wenn irgend etwas nicht passt, dann wird sowieso panic geworfen
+// ein existierendes keyfile darf nicht überschrieben werden
 func TestNewRandomKeyfile(t *testing.T) {
 
 	// datei löschen
@@ -105,7 +104,14 @@ func TestNewRandomKeyfile(t *testing.T) {
 	}
 
 	// datei schreiben
-	NewRandomKeyfile(writeTestFile)
+	if err := NewRandomKeyfile(writeTestFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// nicht überschreiben
+	if err := NewRandomKeyfile(writeTestFile); err == nil {
+		t.Error("existing key file was overwritten")
+	}
 }
 
 // teste die verschlüsselung des chunkhashes (ist dann der dateiname)
@@ -134,7 +140,9 @@ func TestCryptBytes(t *testing.T) {
 		work := make([]byte, len(encdata0))
 		copy(work, encdata0)
 
-		CryptBytes(work[i:], int64(i), key)
+		if err := CryptBytes(work[i:], int64(i), key); err != nil {
+			t.Fatal(err)
+		}
 
 		if !bytes.Equal(work[i:], data[i:]) {
 			t.Errorf("%s\n is not\n %s\n", work[i:], data[i:])
@@ -146,13 +154,19 @@ func TestCryptBytes(t *testing.T) {
 		work := make([]byte, len(encdata1G))
 		copy(work, encdata1G)
 
-		CryptBytes(work[i:], int64(i), key)
+		if err := CryptBytes(work[i:], int64(i), key); err != nil {
+			t.Fatal(err)
+		}
 
 		if !bytes.Equal(work[i:], data[i:]) {
 			t.Errorf("%s\n is not\n %s\n", work[i:], data[i:])
 		}
 	}
 
+	// falsche Schlüssellänge
+	if err := CryptBytes(make([]byte, 10), 0, key[:7]); err == nil {
+		t.Error("CryptBytes with a 7 byte key should fail")
+	}
 }
 
 func TestCryptReader(t *testing.T) {
@@ -178,3 +192,32 @@ func TestCryptReader(t *testing.T) {
 	}
 
 }
+
+func TestCryptReaderSeek(t *testing.T) {
+	key, _ := hex.DecodeString("8374fd0d213ab30f4eb6ae85d43dd4981234b566fff84cfb161e3500b709563e")
+	data := []byte("Das ist ein sehr langer und geheimer text den ich hier entschluessel will! Jajaja, so ist das.")
+	want, _ := ioutil.ReadAll(CryptReader(bytes.NewReader(data), key))
+
+	// erneut lesen nach dem Zurückspulen (zB für die Wiederholung eines Uploads)
+	cr := CryptReader(bytes.NewReader(data), key)
+	ioutil.ReadAll(io.LimitReader(cr, 37))
+	if pos, err := cr.(io.Seeker).Seek(0, io.SeekStart); err != nil || pos != 0 {
+		t.Fatalf("seek: %d, %v", pos, err)
+	}
+	if got, _ := ioutil.ReadAll(cr); !bytes.Equal(got, want) {
+		t.Errorf("CryptReader after seek: %x != %x", got, want)
+	}
+
+	// mitten in einen Block springen
+	if _, err := cr.(io.Seeker).Seek(21, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadAll(cr); !bytes.Equal(got, want[21:]) {
+		t.Errorf("CryptReader after seek to 21: %x != %x", got, want[21:])
+	}
+
+	// der innere Reader muss springen können
+	if _, err := CryptReader(io.MultiReader(bytes.NewReader(data)), key).(io.Seeker).Seek(0, io.SeekStart); err == nil {
+		t.Error("seek without io.Seeker should fail")
+	}
+}
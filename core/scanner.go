@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"sort"
 
+	"splitfuseX/logging"
+
 	"golang.org/x/text/unicode/norm"
 )
 
@@ -22,7 +24,8 @@ const (
 )
 
 // gibt den Ordnerinhalt zurück
-func readDirNames(dirname string) ([]FolderContent, error) {
+// Elemente, die vom Filter ausgeschlossen werden, sind nicht in der Liste enthalten.
+func readDirNames(dirname, relDir string, filter *Filter) ([]FolderContent, error) {
 	// Ordner öffnen
 	f, err := os.Open(dirname)
 	if err != nil {
@@ -42,8 +45,9 @@ func readDirNames(dirname string) ([]FolderContent, error) {
 	for _, v := range names {
 
 		// sub-element Datei oder Ordner?
+		// ACHTUNG: Lstat, damit symbolische Links nicht verfolgt werden
 		tmppath := filepath.Join(dirname, v)
-		info, err := os.Stat(tmppath)
+		info, err := os.Lstat(tmppath)
 		if err != nil {
 			return nil, err
 		}
@@ -53,15 +57,21 @@ func readDirNames(dirname string) ([]FolderContent, error) {
 		// https://blog.golang.org/normalization
 		v = norm.NFC.String(v)
 
+		// ausgeschlossene Elemente überspringen
+		if filter.Skip(filepath.Join(relDir, v), info) {
+			continue
+		}
+
 		// hinzufügen
-		ret = append(ret, FolderContent{Name: v, IsFile: isFile})
+		ret = append(ret, FolderContent{Name: v, IsFile: isFile, Type: fileTypeFromMode(info.Mode())})
 	}
 
 	return ret, nil
 }
 
 // ScanFolder scant einen ganzen Ordner und erstellt daraus eine db.
-func ScanFolder(rootpath string, db SfDb, debug bool) (newDB SfDb, changed bool, summary string, retErr error) {
+// Elemente, die vom Filter ausgeschlossen werden, landen nicht in der db (nil deaktiviert den Filter).
+func ScanFolder(rootpath string, db SfDb, filter *Filter) (newDB SfDb, changed bool, summary string, retErr error) {
 	// clone oldDB
 	oldDB := make(SfDb, len(db))
 	for k, v := range db {
@@ -69,99 +79,229 @@ func ScanFolder(rootpath string, db SfDb, debug bool) (newDB SfDb, changed bool,
 	}
 
 	// init return values
-	countNewOrUpdate := 0
 	newDB = SfDb{}
+	filter.init()
+	s := newScanner(rootpath, filter)
 
 	// Walk
-	retErr = filepath.Walk(rootpath, func(path string, info os.FileInfo, err error) error {
+	retErr = s.walk(rootpath, oldDB, newDB)
+
+	// finale changed?
+	// Alle übernommenen Elemente wurden aus oldDB gelöscht. Bleibt am Ende etwas übrig, dann gab es eine Änderung!
+	changed = s.changed || len(oldDB) > 0
+
+	// Hardlinks: Anzahl der Dateien je Gruppe (innerhalb des gescannten Ordners)
+	countLinks(newDB)
+
+	// Statistik
+	summary = fmt.Sprintf("SCAN: error=%v, sum=%d, changed=%v, newOrUpdate=%d, removed=%d, skipped=%d", retErr, len(newDB), changed, s.countNewOrUpdate, len(oldDB), s.countSkipped)
+	return
+}
+
+// scanner enthält den Zustand eines Scans (siehe ScanFolder und UpdatePaths).
+type scanner struct {
+	rootpath string
+	filter   *Filter
+
+	linkGroups       map[uint64]SfFile // Hardlinks: bereits gescannte Dateien einer Gruppe (die Chunk-Liste wird geteilt)
+	changed          bool
+	countNewOrUpdate int
+	countSkipped     int
+}
+
+func newScanner(rootpath string, filter *Filter) *scanner {
+	return &scanner{
+		rootpath:   rootpath,
+		filter:     filter,
+		linkGroups: make(map[uint64]SfFile),
+	}
+}
+
+// walk scannt den Ordner (oder die Datei) start rekursiv und schreibt alle Elemente in newDB.
+// Übernommene oder aktualisierte Elemente werden aus oldDB gelöscht.
+// HINWEIS: filepath.Walk folgt keinen symbolischen Links (keine Endlosschleifen)
+func (s *scanner) walk(start string, oldDB, newDB SfDb) error {
+	return filepath.Walk(start, func(path string, info os.FileInfo, err error) error {
 		// Fehlerbehandlung der WalkFunc
 		if err != nil {
 			return err
 		}
 
 		// relativen Pfad ermitteln
-		relPath, err := filepath.Rel(rootpath, path)
+		relPath, err := s.relPath(path)
 		if err != nil {
 			return err
 		}
 
-		// UTF8 FIX: Text normalization
-		// https://blog.golang.org/normalization
-		relPath = norm.NFC.String(relPath)
-
-		// Eckdaten des betrachteten Elements ermitteln
-		isFile := !info.IsDir()
-		mtime := uint64(info.ModTime().Unix())
-		size := info.Size()
-
-		// Ordnerinhalt ermitteln, wenn es ein Ordner ist
-		var folderContent []FolderContent
-		if !isFile {
-			folderContent, err = readDirNames(path)
-			if err != nil {
-				// Fehlerbehandlung der readDir Func
-				return err
+		// ausgeschlossene Elemente (und bei Ordnern deren Inhalt) überspringen
+		if s.filter.Skip(relPath, info) {
+			s.countSkipped++
+			logging.Debug("scan: skip", logging.Path(relPath))
+			if info.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
 		}
 
-		// Element in der alten DB suchen
-		e, ok := oldDB[relPath]
-
-		// Fälle, in denen das Element neu gelesen werden muss
-		// andernfalls kann das Element aus der alten DB übernommen werden
-		if !ok || e.Size != size || e.IsFile != isFile || e.Mtime != mtime {
-			countNewOrUpdate++
-			changed = true // Änderung festhalten
-			scanDebug(debug, "new or changed: "+relPath)
-
-			if isFile {
-				// Ist es eine Datei: Element scannen
-				e, err = scanFile(path)
-				if err != nil {
-					// Fehlerbehandlung der ScanFunc
-					return err
-				}
-			} else {
-				// ist es ein Ordner, dann neu baun
-				e = SfFile{
-					Size:          size,
-					Mtime:         mtime,
-					IsFile:        isFile,
-					FolderContent: folderContent,
-				}
-			}
+		// Element in der alten DB suchen und aktualisieren
+		old, ok := oldDB[relPath]
+		e, err := s.entry(path, relPath, info, old, ok)
+		if err != nil {
+			return err
 		}
 
-		// FIX: Den Ordner Content immer setzen
-		// Gibt es keine Änderungen bei den Dateien, dann wird die DB sowieso nicht neu geschrieben
-		// Aber wenn es Änderungen gab, dann sind alle Ordner aktuell
-		// Das mache ich so, well der Abgleich (equal) von folderContent nicht immer funktioniert
-		e.FolderContent = folderContent
-
-		// Ist die einzige Änderung, dass ein altes Element nicht mehr vorhanden ist,
-		// dann muss ich das auch erkennen können. Sollange also das changed Flag nicht andeweitig gesetzt wurde,
-		// muss ich alle übernommenen Elemente aus der alten Datenbank löschen. Bleibt am Ende etwas übrig, dann
-		// gab es eine Änderung!
+		// Element aus der alten DB löschen, damit am Ende entfernte Elemente erkannt werden
 		delete(oldDB, relPath)
 
 		// Element in die neue DB schreiben und funktion beenden
 		newDB[relPath] = e
 		return nil
 	})
+}
 
-	// finale changed?
-	if len(oldDB) > 0 {
-		changed = true
+// relPath ermittelt den normalisierten, relativen Pfad zum Root-Ordner.
+func (s *scanner) relPath(path string) (string, error) {
+	relPath, err := filepath.Rel(s.rootpath, path)
+	if err != nil {
+		return "", err
 	}
 
-	// Statistik
-	summary = fmt.Sprintf("SCAN: error=%v, sum=%d, changed=%v, newOrUpdate=%d, removed=%d", retErr, len(newDB), changed, countNewOrUpdate, len(oldDB))
-	return
+	// UTF8 FIX: Text normalization
+	// https://blog.golang.org/normalization
+	return norm.NFC.String(relPath), nil
 }
 
-func scanDebug(debug bool, msg string) {
-	if debug {
-		println("DEBUG: " + msg)
+// entry erzeugt das SfFile eines einzelnen Elements. Ist das Element in der alten DB (ok) und unverändert,
+// dann wird es übernommen, andernfalls wird es neu gescannt. Ordner werden dabei nicht rekursiv gescannt.
+func (s *scanner) entry(path, relPath string, info os.FileInfo, e SfFile, ok bool) (SfFile, error) {
+	var err error
+
+	// Eckdaten des betrachteten Elements ermitteln
+	isFile := !info.IsDir()
+	mtime := uint64(info.ModTime().Unix())
+	mtimeNsec := uint32(info.ModTime().Nanosecond())
+	size := info.Size()
+	fileType := fileTypeFromMode(info.Mode())
+	group := linkGroup(info)
+	mode, uid, gid := posixAttr(info)
+	ctime := statusChangeTime(info)
+
+	// Ziel eines symbolischen Links
+	var linkTarget string
+	if fileType == TypeSymlink {
+		linkTarget, err = os.Readlink(path)
+		if err != nil {
+			return SfFile{}, err
+		}
+	}
+
+	// Ordnerinhalt ermitteln, wenn es ein Ordner ist
+	var folderContent []FolderContent
+	if !isFile {
+		// die Regeln der Ignore-Datei gelten ab diesem Ordner
+		err = s.filter.loadIgnoreFile(path, filepath.ToSlash(relPath))
+		if err != nil {
+			return SfFile{}, err
+		}
+		folderContent, err = readDirNames(path, relPath, s.filter)
+		if err != nil {
+			// Fehlerbehandlung der readDir Func
+			return SfFile{}, err
+		}
+	}
+
+	// Alte DBs kennen nur Sekunden: Passen die Sekunden, dann werden die Nanosekunden
+	// ohne erneutes Scannen übernommen (sonst müsste nach dem Update alles neu gehasht werden)
+	if ok && e.MtimeNsec == 0 && e.Mtime == mtime && mtimeNsec != 0 {
+		e.MtimeNsec = mtimeNsec
+		s.changed = true
+	}
+
+	// Fälle, in denen das Element neu gelesen werden muss
+	// andernfalls kann das Element aus der alten DB übernommen werden
+	if !ok || e.Size != size || e.IsFile != isFile || e.Mtime != mtime || e.MtimeNsec != mtimeNsec || e.GetType() != fileType || e.LinkTarget != linkTarget {
+		s.countNewOrUpdate++
+		s.changed = true // Änderung festhalten
+		logging.Debug("scan: new or changed", logging.Path(relPath))
+
+		if other, found := s.linkGroups[group]; found && group != 0 && other.Size == size && other.Mtime == mtime && other.MtimeNsec == mtimeNsec {
+			// Hardlink auf eine bereits gescannte Datei: Chunk-Liste übernehmen
+			e = other
+		} else if fileType == TypeRegular {
+			// Ist es eine Datei: Element scannen
+			e, err = scanFile(path)
+			if err != nil {
+				// Fehlerbehandlung der ScanFunc
+				return SfFile{}, err
+			}
+		} else if isFile {
+			// symbolische Links und spezielle Dateien haben keinen Inhalt, der gescannt werden kann
+			e = SfFile{
+				Size:       size,
+				Mtime:      mtime,
+				MtimeNsec:  mtimeNsec,
+				IsFile:     isFile,
+				LinkTarget: linkTarget,
+				Rdev:       deviceNumber(info),
+			}
+		} else {
+			// ist es ein Ordner, dann neu baun
+			e = SfFile{
+				Size:          size,
+				Mtime:         mtime,
+				MtimeNsec:     mtimeNsec,
+				IsFile:        isFile,
+				FolderContent: folderContent,
+			}
+		}
+	}
+
+	// FIX: Den Ordner Content immer setzen
+	// Gibt es keine Änderungen bei den Dateien, dann wird die DB sowieso nicht neu geschrieben
+	// Aber wenn es Änderungen gab, dann sind alle Ordner aktuell
+	// Das mache ich so, well der Abgleich (equal) von folderContent nicht immer funktioniert
+	e.FolderContent = folderContent
+
+	// Metadaten (Berechtigungen, Besitzer, xattrs) haben sich geändert?
+	// Der Inhalt muss dafür nicht neu gescannt werden.
+	// HINWEIS: Jede Änderung der xattrs aktualisiert auch die ctime.
+	if e.Ctime != ctime || e.Mode != mode || e.Uid != uid || e.Gid != gid {
+		s.changed = true
+		logging.Debug("scan: new or changed attributes", logging.Path(relPath))
+
+		e.Xattrs, err = readXattrs(path, info)
+		if err != nil {
+			return SfFile{}, err
+		}
+	}
+
+	// Typ, Hardlink Gruppe und posix Attribute immer setzen (alte DBs haben diese Werte nicht)
+	e.Type = fileType
+	e.LinkGroup = group
+	e.Mode = mode
+	e.Uid = uid
+	e.Gid = gid
+	e.Ctime = ctime
+	if group != 0 {
+		s.linkGroups[group] = e
+	}
+
+	return e, nil
+}
+
+// countLinks setzt bei allen Hardlinks die Anzahl der Dateien in der Gruppe.
+func countLinks(db SfDb) {
+	count := make(map[uint64]uint32)
+	for _, e := range db {
+		if e.LinkGroup != 0 {
+			count[e.LinkGroup]++
+		}
+	}
+	for p, e := range db {
+		if e.LinkGroup != 0 {
+			e.Nlink = count[e.LinkGroup]
+			db[p] = e
+		}
 	}
 }
 
@@ -230,7 +370,9 @@ func scanFile(path string) (SfFile, error) {
 	return SfFile{
 		Size:       int64(fileSize),
 		Mtime:      uint64(fileInfo.ModTime().Unix()),
+		MtimeNsec:  uint32(fileInfo.ModTime().Nanosecond()),
 		IsFile:     !fileInfo.IsDir(),
+		Type:       TypeRegular,
 		FileChunks: chunkList,
 	}, nil
 }
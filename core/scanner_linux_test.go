@@ -0,0 +1,171 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestScanFolderLinks(t *testing.T) {
+	// Testordner anlegen
+	root := filepath.Join(os.TempDir(), "scanner_links_test")
+	os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("hallo welt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(root, "a.txt"), filepath.Join(root, "sub", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join(root, "sub", "loop")); err != nil { // zyklischer Link
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(root, "fifo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// scannen
+	newDB, _, _, err := ScanFolder(root, SfDb{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// symbolische Links
+	if e := newDB["link"]; e.GetType() != TypeSymlink || e.LinkTarget != "a.txt" || len(e.FileChunks) != 0 {
+		t.Errorf("wrong symlink: %+v", e)
+	}
+	if e := newDB["sub/loop"]; e.GetType() != TypeSymlink || e.LinkTarget != ".." {
+		t.Errorf("wrong symlink: %+v", e)
+	}
+	if _, ok := newDB["sub/loop/a.txt"]; ok {
+		t.Errorf("symlink was followed")
+	}
+
+	// Hardlinks
+	a, b := newDB["a.txt"], newDB["sub/b.txt"]
+	if a.LinkGroup == 0 || a.LinkGroup != b.LinkGroup || a.Nlink != 2 || b.Nlink != 2 {
+		t.Errorf("wrong hardlink group: %d/%d, %d/%d", a.LinkGroup, a.Nlink, b.LinkGroup, b.Nlink)
+	}
+	if len(a.FileChunks) != 1 || !reflect.DeepEqual(a.FileChunks, b.FileChunks) {
+		t.Errorf("hardlinks should share the chunk list")
+	}
+
+	// spezielle Dateien
+	if e := newDB["fifo"]; e.GetType() != TypeFifo || len(e.FileChunks) != 0 {
+		t.Errorf("wrong fifo: %+v", e)
+	}
+
+	// Ordnerinhalt
+	for _, c := range newDB["."].FolderContent {
+		if c.Name == "link" && c.GetType() != TypeSymlink {
+			t.Errorf("wrong folder content type: %+v", c)
+		}
+	}
+
+	// ein zweiter Scan ändert nichts
+	_, changed, _, err := ScanFolder(root, newDB, nil)
+	if err != nil || changed {
+		t.Errorf("second scan: changed=%v, err=%v", changed, err)
+	}
+}
+
+func TestScanFolderPosixAttr(t *testing.T) {
+	// Testordner anlegen
+	root := filepath.Join(os.TempDir(), "scanner_attr_test")
+	os.RemoveAll(root)
+	if err := os.MkdirAll(root, 0700); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(root, "a.txt")
+	if err := ioutil.WriteFile(p, []byte("hallo welt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(p, 0751); err != nil {
+		t.Fatal(err)
+	}
+	xattrs := syscall.Setxattr(p, "user.splitfuse", []byte("test"), 0) == nil // nicht jedes Dateisystem kann xattrs
+
+	// scannen
+	db1, _, _, err := ScanFolder(root, SfDb{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := db1["a.txt"]
+	if !e.HasPosixAttr() || e.Mode != 0751 || e.Uid != uint32(os.Getuid()) || e.Gid != uint32(os.Getgid()) {
+		t.Errorf("wrong posix attributes: mode=%o, uid=%d, gid=%d, ctime=%d", e.Mode, e.Uid, e.Gid, e.Ctime)
+	}
+	if xattrs && string(e.Xattrs["user.splitfuse"]) != "test" {
+		t.Errorf("wrong xattrs: %v", e.Xattrs)
+	}
+
+	// nur die Berechtigungen ändern -> changed, aber gleiche Chunks
+	time.Sleep(1100 * time.Millisecond) // ctime hat nur Sekunden
+	if err := os.Chmod(p, 0640); err != nil {
+		t.Fatal(err)
+	}
+	db2, changed, _, err := ScanFolder(root, db1, nil)
+	if err != nil || !changed {
+		t.Fatalf("chmod not detected: changed=%v, err=%v", changed, err)
+	}
+	if db2["a.txt"].Mode != 0640 || !reflect.DeepEqual(db2["a.txt"].FileChunks, e.FileChunks) {
+		t.Errorf("wrong mode after chmod: %o", db2["a.txt"].Mode)
+	}
+
+}
+
+func TestReadXattrs(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "plain.txt")
+	if err := ioutil.WriteFile(p, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ohne xattrs
+	if xattrs, err := readXattrs(p, info); err != nil || len(xattrs) != 0 {
+		t.Errorf("plain file: %v, %v", xattrs, err)
+	}
+
+	// eine fehlende Datei ist ein Fehler
+	if _, err := readXattrs(filepath.Join(dir, "missing"), info); err == nil {
+		t.Error("missing file should fail")
+	}
+}
+
+// statInfo ist ein os.FileInfo mit einem syscall.Stat_t für die linkGroup Tests
+type statInfo struct {
+	os.FileInfo
+	st *syscall.Stat_t
+}
+
+func (fi statInfo) IsDir() bool      { return false }
+func (fi statInfo) Sys() interface{} { return fi.st }
+
+func TestLinkGroup(t *testing.T) {
+	a := statInfo{st: &syscall.Stat_t{Dev: 1, Ino: 42, Nlink: 2}}
+	b := statInfo{st: &syscall.Stat_t{Dev: 2, Ino: 42, Nlink: 2}} // gleicher Inode auf einem anderen Gerät
+	c := statInfo{st: &syscall.Stat_t{Dev: 1, Ino: 42, Nlink: 3}}
+	single := statInfo{st: &syscall.Stat_t{Dev: 1, Ino: 43, Nlink: 1}}
+
+	if linkGroup(a) == 0 || linkGroup(a) != linkGroup(c) {
+		t.Errorf("same file: %d != %d", linkGroup(a), linkGroup(c))
+	}
+	if linkGroup(a) == linkGroup(b) {
+		t.Errorf("same inode on different devices should not share a group")
+	}
+	if linkGroup(single) != 0 {
+		t.Errorf("single link: %d", linkGroup(single))
+	}
+}
@@ -3,9 +3,12 @@ package core
 import (
 	"bytes"
 	"encoding/hex"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 var (
@@ -26,12 +29,12 @@ func TestScanFolder(t *testing.T) {
 	db = SfDb{}
 
 	// scan local dir
-	db, changed1, _, err1 := ScanFolder("./", db, false)
+	db, changed1, _, err1 := ScanFolder("./", db, nil)
 	// scan local dir (again)
-	db, changed2, _, err2 := ScanFolder("./", db, false)
+	db, changed2, _, err2 := ScanFolder("./", db, nil)
 	// add a fake file and scan local dir (again)
 	db["iAmAFakeFile.txt"] = SfFile{}
-	db, changed3, _, err3 := ScanFolder("./", db, false)
+	db, changed3, _, err3 := ScanFolder("./", db, nil)
 
 	// check errors
 	if err1 != nil || err2 != nil || err3 != nil {
@@ -109,3 +112,61 @@ func TestScanFileHash(t *testing.T) {
 		t.Errorf("testfail.keyfile hash wrong: %x", of.FileChunks[0][:])
 	}
 }
+
+func TestScanFolderNanoseconds(t *testing.T) {
+	// Testordner anlegen
+	root := filepath.Join(os.TempDir(), "scanner_nsec_test")
+	os.RemoveAll(root)
+	if err := os.MkdirAll(root, 0700); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(root, "a.txt")
+	mtime := time.Unix(1500000000, 100)
+	if err := ioutil.WriteFile(p, []byte("version 1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	db1, _, _, err := ScanFolder(root, SfDb{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db1["a.txt"].MtimeNsec != 100 || !db1["a.txt"].ModTime().Equal(mtime) {
+		t.Errorf("wrong nanoseconds: %d", db1["a.txt"].MtimeNsec)
+	}
+
+	// Änderung in der gleichen Sekunde (gleiche Größe)
+	if err := ioutil.WriteFile(p, []byte("version 2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime2 := time.Unix(1500000000, 200)
+	if err := os.Chtimes(p, mtime2, mtime2); err != nil {
+		t.Fatal(err)
+	}
+	db2, changed, _, err := ScanFolder(root, db1, nil)
+	if err != nil || !changed {
+		t.Fatalf("change in the same second not detected: changed=%v, err=%v", changed, err)
+	}
+	if reflect.DeepEqual(db1["a.txt"].FileChunks, db2["a.txt"].FileChunks) {
+		t.Errorf("file was not scanned again")
+	}
+
+	// alte DB ohne Nanosekunden: die Nanosekunden werden übernommen, ohne neu zu scannen
+	legacy := SfDb{}
+	for k, v := range db2 {
+		v.MtimeNsec = 0
+		legacy[k] = v
+	}
+	fake := legacy["a.txt"]
+	fake.FileChunks = []ChunkHash{{1, 2, 3}} // würde beim erneuten Scannen überschrieben
+	legacy["a.txt"] = fake
+	db3, changed, _, err := ScanFolder(root, legacy, nil)
+	if err != nil || !changed {
+		t.Fatalf("legacy db: changed=%v, err=%v", changed, err)
+	}
+	if db3["a.txt"].MtimeNsec != 200 || !reflect.DeepEqual(db3["a.txt"].FileChunks, fake.FileChunks) {
+		t.Errorf("legacy db: file was scanned again or nanoseconds are missing")
+	}
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+// +build !windows
+
+package core
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"os"
+	"syscall"
+)
+
+// linkGroup gibt für Hardlinks (mehr als ein Link auf die Datei) einen eindeutigen Schlüssel zurück.
+// Inodes sind nur innerhalb eines Dateisystems eindeutig (im gescannten Ordner können weitere gemountet sein),
+// daher ist der Schlüssel ein Hash aus Gerät und Inode. Ist die Datei kein Hardlink, dann ist der Schlüssel 0.
+func linkGroup(info os.FileInfo) uint64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 || info.IsDir() {
+		return 0
+	}
+	return deviceInodeKey(uint64(st.Dev), uint64(st.Ino))
+}
+
+// deviceInodeKey bildet aus Gerät und Inode einen Schlüssel, der nie 0 ist.
+func deviceInodeKey(dev, ino uint64) uint64 {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], dev)
+	binary.LittleEndian.PutUint64(buf[8:], ino)
+	h := fnv.New64a()
+	h.Write(buf[:])
+	if key := h.Sum64(); key != 0 {
+		return key
+	}
+	return 1
+}
+
+// deviceNumber gibt die Gerätenummer von Block- und Zeichengeräten zurück.
+func deviceNumber(info os.FileInfo) uint64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return uint64(st.Rdev)
+}
+
+// posixAttr gibt die Berechtigungen (inkl. setuid, setgid und sticky) sowie den Besitzer zurück.
+func posixAttr(info os.FileInfo) (mode, uid, gid uint32) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return uint32(info.Mode().Perm()), 0, 0
+	}
+	return uint32(st.Mode) & 07777, st.Uid, st.Gid
+}
@@ -0,0 +1,18 @@
+package core
+
+import "os"
+
+// linkGroup: Hardlinks werden unter Windows nicht erkannt.
+func linkGroup(info os.FileInfo) uint64 {
+	return 0
+}
+
+// deviceNumber: Geräte gibt es unter Windows nicht.
+func deviceNumber(info os.FileInfo) uint64 {
+	return 0
+}
+
+// posixAttr: Unter Windows gibt es nur die Berechtigungen von os.FileMode und keinen Besitzer.
+func posixAttr(info os.FileInfo) (mode, uid, gid uint32) {
+	return uint32(info.Mode().Perm()), 0, 0
+}
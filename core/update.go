@@ -0,0 +1,144 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// UpdatePaths aktualisiert die db nur für die angegebenen Elemente (relative Pfade zum Root-Ordner),
+// anstatt den ganzen Ordner mit ScanFolder zu scannen. Ist ein Element ein Ordner, dann wird dieser
+// rekursiv gescannt. Nicht mehr vorhandene (oder ausgeschlossene) Elemente werden mit ihrem Inhalt entfernt.
+// Die Elternordner werden ebenfalls aktualisiert (FolderContent).
+// ACHTUNG: Die übergebene db wird dabei verändert!
+func UpdatePaths(rootpath string, db SfDb, relPaths []string, filter *Filter) (changed bool, summary string, retErr error) {
+	filter.init()
+	s := newScanner(rootpath, filter)
+	removed := 0
+
+	// normalisieren, doppelte entfernen und sortieren (Elternordner vor ihrem Inhalt)
+	todo := make(map[string]bool)
+	for _, p := range relPaths {
+		p = path.Clean(filepath.ToSlash(norm.NFC.String(p)))
+
+		// Ist der Elternordner (noch) nicht in der DB, dann muss er selbst gescannt werden
+		for p != "." {
+			if _, ok := db[path.Dir(p)]; ok {
+				break
+			}
+			p = path.Dir(p)
+		}
+		todo[p] = true
+	}
+	list := make([]string, 0, len(todo))
+	for p := range todo {
+		list = append(list, p)
+	}
+	sort.Strings(list)
+
+	// Elternordner, deren FolderContent neu gelesen werden muss
+	parents := make(map[string]bool)
+
+	for _, relPath := range list {
+		absPath := filepath.Join(rootpath, filepath.FromSlash(relPath))
+
+		// Ignore-Dateien der Elternordner laden
+		if err := filter.loadParentIgnoreFiles(rootpath, relPath); err != nil {
+			retErr = err
+			break
+		}
+
+		// alten Stand (Element und Inhalt) aus der DB nehmen
+		oldDB := removeTree(db, relPath)
+
+		// existiert das Element noch?
+		info, err := os.Lstat(absPath)
+		if os.IsNotExist(err) || (err == nil && filter.Skip(relPath, info)) {
+			// gelöscht oder ausgeschlossen
+			removed += len(oldDB)
+			if relPath != "." {
+				parents[path.Dir(relPath)] = true
+			}
+			continue
+		}
+		if err != nil {
+			retErr = err
+			break
+		}
+
+		// Element (rekursiv) scannen
+		newDB := SfDb{}
+		err = s.walk(absPath, oldDB, newDB)
+		for k, v := range newDB {
+			db[k] = v
+		}
+		if err != nil {
+			retErr = err
+			break
+		}
+		removed += len(oldDB)
+		if relPath != "." {
+			parents[path.Dir(relPath)] = true
+		}
+	}
+
+	// Elternordner aktualisieren (Ordnerinhalt und Attribute)
+	for relPath := range parents {
+		old, ok := db[relPath]
+		if !ok || todo[relPath] || retErr != nil {
+			continue // nicht in der DB oder bereits gescannt
+		}
+		absPath := filepath.Join(rootpath, filepath.FromSlash(relPath))
+		info, err := os.Lstat(absPath)
+		if err != nil {
+			continue // wird mit dem Event für den Ordner selbst behandelt
+		}
+		e, err := s.entry(absPath, relPath, info, old, ok)
+		if err != nil {
+			retErr = err
+			break
+		}
+		if !folderContentEqual(old.FolderContent, e.FolderContent) {
+			s.changed = true
+		}
+		db[relPath] = e
+	}
+
+	// Hardlinks neu zählen
+	countLinks(db)
+
+	changed = s.changed || removed > 0
+	summary = fmt.Sprintf("UPDATE: error=%v, paths=%d, changed=%v, newOrUpdate=%d, removed=%d, skipped=%d", retErr, len(list), changed, s.countNewOrUpdate, removed, s.countSkipped)
+	return
+}
+
+// removeTree entfernt ein Element und (bei Ordnern) den gesamten Inhalt aus der db und gibt die entfernten Elemente zurück.
+func removeTree(db SfDb, relPath string) SfDb {
+	ret := SfDb{}
+	prefix := relPath + "/"
+	for k, v := range db {
+		if k == relPath || relPath == "." || strings.HasPrefix(k, prefix) {
+			ret[k] = v
+			delete(db, k)
+		}
+	}
+	return ret
+}
+
+// folderContentEqual vergleicht zwei Ordnerinhalte.
+func folderContentEqual(a, b []FolderContent) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
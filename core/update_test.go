@@ -0,0 +1,73 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUpdatePaths(t *testing.T) {
+	// Testordner anlegen
+	root := filepath.Join(os.TempDir(), "update_test")
+	os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "a"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"x.txt": "x", "a/y.txt": "y", "a/z.txt": "z"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, _, _, err := ScanFolder(root, SfDb{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nichts geändert
+	changed, _, err := UpdatePaths(root, db, []string{"x.txt", "a"}, nil)
+	if err != nil || changed {
+		t.Fatalf("unexpected change: changed=%v, err=%v", changed, err)
+	}
+
+	// ändern, löschen und einen neuen Ordner anlegen
+	if err := ioutil.WriteFile(filepath.Join(root, "x.txt"), []byte("x2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "a/z.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "b/c"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "b/c/w.txt"), []byte("w"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// nur die betroffenen Pfade aktualisieren (b/c/w.txt: der Elternordner ist noch nicht in der DB)
+	changed, summary, err := UpdatePaths(root, db, []string{"x.txt", "a/z.txt", "b/c/w.txt"}, nil)
+	if err != nil || !changed {
+		t.Fatalf("change not detected: changed=%v, err=%v", changed, err)
+	}
+
+	// das Ergebnis muss einem vollständigen Scan entsprechen
+	full, _, _, err := ScanFolder(root, SfDb{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(db, full) {
+		t.Errorf("db differs from full scan (%s)", summary)
+		for k := range full {
+			if !reflect.DeepEqual(db[k], full[k]) {
+				t.Errorf("differs: %s", k)
+			}
+		}
+	}
+	if _, ok := db["a/z.txt"]; ok {
+		t.Errorf("deleted file still in db")
+	}
+	if _, ok := db["b/c/w.txt"]; !ok {
+		t.Errorf("new file not in db")
+	}
+}
@@ -1,7 +1,9 @@
 package fh
 
-// Wieviel darf max. im fh Cache gespeichert werden (10 MB)
-// Hinweis: Diese Cache-Größe ist pro FH und kann sich daher schnell summieren (RAM sparern!)
+import "time"
+
+// Wieviel darf max. im Cache eines Streams gespeichert werden (10 MB)
+// Hinweis: Diese Cache-Größe ist pro Stream und kann sich daher schnell summieren (RAM sparern!)
 const MaxCacheSize = 10 * 1024 * 1024
 
 // Wie weit soll VOR einem offset initial gelesen werden (1 MB)
@@ -12,10 +14,37 @@ const PreloadSize = 1 * 1024 * 1024
 // Die Chunks können soweiso max. 1 GB groß werden.
 const MaxFileSize = 20 * 1024 * 1024 * 1024
 
-// Wie weit darf ungecached nach vorne gesprungen werden, bis ein Fehler kommt (50 MB)
+// Wie weit darf ungecached nach vorne gesprungen werden, bis ein neuer Stream geöffnet wird (50 MB)
 // Vorspringen gedeutet, dass die Daten trotzdem bis zu dem Punkt geladen werden müssen.
 const MaxForwardJump = 50 * 1024 * 1024
 
+// Wie viele Streams (Range-Requests) darf ein FH gleichzeitig offen halten
+// Wird ein weiterer Stream benötigt, dann wird der am längsten nicht verwendete Stream geschlossen.
+const MaxStreams = 4
+
+// Wie oft darf ein Stream nach einem Verbindungsfehler (pro Download) neu geöffnet werden
+const MaxStreamRetries = 3
+
 // Wieviel bytes können von google auf einmal empfangen werden (größe eines CacheElement).
 // Das ist der read buffer beim Download.
 const ReadBufferSize = 32768
+
+// Wie groß ist ein Block im DiskCache (1 MB)
+// Es werden immer ganze Blöcke geladen und auf der Festplatte gespeichert.
+const DiskCacheBlockSize = 1 * 1024 * 1024
+
+// Mit welchem Fenster beginnt das Vorausladen bei sequenziellem Lesen (256 KB)
+// Bei jedem weiteren sequenziellen Read() wird das Fenster verdoppelt.
+const MinReadAhead = 256 * 1024
+
+// Wie weit wird bei sequenziellem Lesen max. vorausgeladen (8 MB)
+// Hinweis: Das muss kleiner als MaxCacheSize sein, sonst wird Vorausgeladenes wieder verworfen, bevor es gelesen wird.
+const MaxReadAhead = 8 * 1024 * 1024
+
+// In welchen Schritten wird vorausgeladen (256 KB)
+// Ein Schritt blockiert den Stream, gleichzeitige Read() Aufrufe müssen solange warten.
+const ReadAheadStep = 256 * 1024
+
+// Wie lange darf ein Read() im FUSE max. dauern (2 Minuten)
+// Danach wird der Download abgebrochen und EIO zurück gegeben, damit hängende Verbindungen nicht ewig blockieren.
+const ReadTimeout = 2 * time.Minute
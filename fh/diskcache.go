@@ -0,0 +1,190 @@
+package fh
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskCache ist ein Cache für Chunk-Blöcke auf der lokalen Festplatte.
+// Im Gegensatz zum Cache des FileHandler bleibt er über Release() und einen Neustart hinweg erhalten.
+// Die Blöcke werden verschlüsselt abgelegt (genau so wie im Speicher).
+// Ist der Cache voll, dann werden die am längsten nicht mehr verwendeten Blöcke gelöscht (LRU).
+type DiskCache struct {
+	mutex   *sync.Mutex
+	dir     string                   // Ordner, in dem die Blöcke liegen
+	maxSize int64                    // max. Größe aller Blöcke in Bytes
+	size    int64                    // aktuelle Größe aller Blöcke in Bytes
+	lru     *list.List               // *diskCacheEntry, vorne steht der zuletzt verwendete Block
+	entries map[string]*list.Element // key ist der Dateiname des Blocks
+}
+
+// diskCacheEntry ist ein Block im DiskCache
+type diskCacheEntry struct {
+	name string
+	size int64
+}
+
+// diskCacheTmpPrefix ist der Prefix von Dateien, die gerade geschrieben werden
+const diskCacheTmpPrefix = ".tmp-"
+
+// NewDiskCache öffnet (oder erstellt) einen DiskCache im angegebenen Ordner.
+// Bereits vorhandene Blöcke werden übernommen, die Reihenfolge (LRU) ergibt sich dabei aus der mtime der Dateien.
+func NewDiskCache(dir string, maxSize int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	c := &DiskCache{
+		mutex:   &sync.Mutex{},
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	// vorhandene Blöcke einlesen
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		// abgebrochene Schreibvorgänge entfernen
+		if strings.HasPrefix(info.Name(), diskCacheTmpPrefix) {
+			os.Remove(filepath.Join(dir, info.Name()))
+			continue
+		}
+		c.entries[info.Name()] = c.lru.PushFront(&diskCacheEntry{name: info.Name(), size: info.Size()})
+		c.size += info.Size()
+	}
+
+	// auf die max. Größe verkleinern
+	c.mutex.Lock()
+	c.evict()
+	c.mutex.Unlock()
+
+	return c, nil
+}
+
+// Get gibt einen Block (verschlüsselt) zurück. Ist der Block nicht im Cache, dann ist ok false.
+func (c *DiskCache) Get(chunkName string, block int64) (b []byte, ok bool) {
+	name := diskCacheBlockName(chunkName, block)
+
+	// LOCK / UNLOCK
+	c.mutex.Lock()
+	e, ok := c.entries[name]
+	if ok {
+		c.lru.MoveToFront(e)
+	}
+	c.mutex.Unlock()
+	if !ok {
+		diskCacheRequests.Inc("miss")
+		return nil, false
+	}
+
+	// Die Datei wird ohne Lock gelesen. Wurde sie inzwischen gelöscht, dann ist das ein Cache-Miss.
+	p := filepath.Join(c.dir, name)
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		diskCacheRequests.Inc("miss")
+		return nil, false
+	}
+	diskCacheRequests.Inc("hit")
+
+	// mtime aktualisieren, damit die Reihenfolge nach einem Neustart erhalten bleibt
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return b, true
+}
+
+// Contains prüft, ob ein Block im Cache ist (ohne die Reihenfolge zu verändern).
+func (c *DiskCache) Contains(chunkName string, block int64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, ok := c.entries[diskCacheBlockName(chunkName, block)]
+	return ok
+}
+
+// Put speichert einen Block (verschlüsselt) im Cache.
+func (c *DiskCache) Put(chunkName string, block int64, b []byte) error {
+	name := diskCacheBlockName(chunkName, block)
+
+	// Blöcke, die größer als der ganze Cache sind, werden gar nicht erst gespeichert
+	if int64(len(b)) > c.maxSize {
+		return nil
+	}
+
+	// zuerst in eine temporäre Datei schreiben, damit es nie halbe Blöcke gibt
+	tmp, err := ioutil.TempFile(c.dir, diskCacheTmpPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// LOCK / UNLOCK
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// Eintrag aktualisieren oder neu anlegen
+	if e, ok := c.entries[name]; ok {
+		entry := e.Value.(*diskCacheEntry)
+		c.size -= entry.size
+		entry.size = int64(len(b))
+		c.lru.MoveToFront(e)
+	} else {
+		c.entries[name] = c.lru.PushFront(&diskCacheEntry{name: name, size: int64(len(b))})
+	}
+	c.size += int64(len(b))
+
+	c.evict()
+	return nil
+}
+
+// Size gibt die aktuelle Größe aller Blöcke in Bytes zurück.
+func (c *DiskCache) Size() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.size
+}
+
+// evict löscht die am längsten nicht verwendeten Blöcke, bis der Cache nicht mehr zu groß ist.
+// ACHTUNG: Der mutex muss bereits gesperrt sein!
+func (c *DiskCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		e := c.lru.Back()
+		entry := e.Value.(*diskCacheEntry)
+		c.lru.Remove(e)
+		delete(c.entries, entry.name)
+		c.size -= entry.size
+		os.Remove(filepath.Join(c.dir, entry.name))
+	}
+}
+
+// diskCacheBlockName ist der Dateiname eines Blocks im Cache-Ordner.
+func diskCacheBlockName(chunkName string, block int64) string {
+	return fmt.Sprintf("%s.%d", chunkName, block)
+}
@@ -0,0 +1,68 @@
+package fh
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskCache(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "unit_test_diskcache")
+	os.RemoveAll(dir)
+
+	// Platz für genau 2 Blöcke
+	c, err := NewDiskCache(dir, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := bytes.Repeat([]byte{'a'}, 10)
+	b := bytes.Repeat([]byte{'b'}, 10)
+	x := bytes.Repeat([]byte{'x'}, 10)
+
+	shouldPass(t, c.Put("chunk", 0, a), "put a")
+	shouldPass(t, c.Put("chunk", 1, b), "put b")
+	if got, ok := c.Get("chunk", 0); !ok || !bytes.Equal(got, a) {
+		t.Errorf("block 0 not in cache")
+	}
+
+	// Block 1 wurde am längsten nicht verwendet und muss weichen
+	shouldPass(t, c.Put("other", 0, x), "put x")
+	if _, ok := c.Get("chunk", 1); ok {
+		t.Errorf("block 1 should be evicted")
+	}
+	if c.Size() != 20 {
+		t.Errorf("wrong size: %d", c.Size())
+	}
+
+	// zu große Blöcke werden nicht gespeichert
+	shouldPass(t, c.Put("big", 0, make([]byte, 21)), "put big")
+	if _, ok := c.Get("big", 0); ok {
+		t.Errorf("big block should not be cached")
+	}
+
+	// nach einem Neustart ist der Cache noch vorhanden
+	c2, err := NewDiskCache(dir, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c2.Get("other", 0); !ok || !bytes.Equal(got, x) {
+		t.Errorf("block not in cache after restart")
+	}
+	if got, ok := c2.Get("chunk", 0); !ok || !bytes.Equal(got, a) {
+		t.Errorf("block not in cache after restart")
+	}
+
+	// ein kleinerer Cache entfernt beim Öffnen die ältesten Blöcke
+	c3, err := NewDiskCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c3.Get("other", 0); ok {
+		t.Errorf("oldest block should be evicted")
+	}
+	if _, ok := c3.Get("chunk", 0); !ok {
+		t.Errorf("newest block should be kept")
+	}
+}
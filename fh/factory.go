@@ -1,57 +1,48 @@
 package fh
 
 import (
-	"io"
+	"context"
 	"sync"
 
 	"splitfuseX/backbone"
 )
 
 // NewFileHandler erzeugt ein neues FileHandler Objekt. Mit fileId wird die Datei auf dem Drive angegeben.
-// Der offset bestimmt, an welcher Stelle grob die Datei gelesen werden soll.
+// Der offset bestimmt, an welcher Stelle grob die Datei gelesen werden soll. Dort beginnt der erste Stream.
+// Geöffnet wird er erst beim ersten Download (im ctx des Aufrufers), daher blockiert diese Methode nie.
+// Alle Verbindungen laufen im ctx (zB der Lebensdauer des Mounts) und werden mit seinem Ende abgebrochen.
 // Hinweis: Der offset wird von dieser Methode etwas nach unten korrigiert damit initial mehr Daten gelesen werden.
-func NewFileHandler(client backbone.Client, fileId string, offset int64) (*FileHandler, error) {
+func NewFileHandler(ctx context.Context, client backbone.Client, fileId string, offset int64) *FileHandler {
+	ctx, cancel := context.WithCancel(ctx)
+	fh := &FileHandler{
+		mutex:  &sync.Mutex{},
+		client: client,
+		fileId: fileId,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	// ersten Stream anlegen (noch nicht geöffnet)
+	fh.streams = append(fh.streams, fh.newStream(offset))
+	openFileHandlers.Inc()
+
+	// return fh object
+	return fh
+}
 
-	// Es wird ein bestimmter offset angefordert. (pre-load)
-	// Aber zur sicherheit werden einige Bytes davor mit gelesen,
-	// weil ein nachträgliches "vorlesen" nicht mehr möglich ist.
+// newStream erzeugt einen (noch nicht geöffneten) Stream ab dem gewünschten offset.
+// Aber zur Sicherheit werden einige Bytes davor mit gelesen (pre-load),
+// weil kurze Sprünge zurück (zB beim Lesen von Headern) sonst einen weiteren Stream benötigen würden.
+func (fh *FileHandler) newStream(offset int64) *stream {
 	offset = offset - PreloadSize
 	if offset < 0 {
 		offset = 0
 	}
-
-	// http response zur Datei holen
-	resp, err := client.Read(fileId, offset, MaxFileSize)
-	if err != nil {
-		return nil, err
-	}
-
-	// Liest einmal ein CacheElement. (einen ganzen ReadBufferSize großen Block lesen)
-	// Das kann bei einer leeren Datei auch 0 Bytes enthalten.
-	b := make([]byte, ReadBufferSize)
-	n, err := resp.Read(b)
-	if err != nil && err != io.EOF { // alle Fehler AUßER EOF zurückgeben
-		return nil, err
-	}
-	b = b[:n] // trim buffer
-
-	cacheElement := &CacheElement{
-		b:      b,
-		offset: offset,
+	return &stream{
+		fh:        fh,
+		mutex:     &sync.Mutex{},
+		connMutex: &sync.Mutex{},
+		start:     offset,
+		offset:    offset,
 	}
-
-	// Nun, da der fh auf die Datei in Google Drive weiter gerückt wurde,
-	// muss ein neuer fhOffset berechnet werden.
-	// (fhOffset: nächstes, noch nicht gelesenes Byte der Datei auf Google Drive)
-	offset += int64(n)
-
-	// return fh object
-	return &FileHandler{
-		mutex:  &sync.Mutex{},
-		resp:   resp,
-		offset: offset,
-
-		firstCacheElement: cacheElement,
-		lastCacheElement:  cacheElement,
-	}, nil
 }
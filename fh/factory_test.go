@@ -1,6 +1,7 @@
 package fh
 
 import (
+	"context"
 	"encoding/base64"
 	"os"
 	"reflect"
@@ -17,16 +18,13 @@ func TestNewFileHandler(t *testing.T) {
 
 	// TestNewFileHandler()
 	id := base64.StdEncoding.EncodeToString([]byte(testFileList[0].name))
-	fh, err := NewFileHandler(client, id, PreloadSize*2)
-	if err != nil {
-		t.Error(err)
-	}
+	fh := NewFileHandler(context.Background(), client, id, PreloadSize*2)
 	defer fh.CloseAndClear()
 
 	// TESTS  PreloadSize
 	b, err := fh.Download(PreloadSize-1, 10)
-	shouldFail(t, err, "PreloadSize: one byte to much")
-	testBytes(t, b, testFileList[0].path, PreloadSize, 0, "no bytes")
+	shouldPass(t, err, "PreloadSize: one byte to much (new stream)")
+	testBytes(t, b, testFileList[0].path, PreloadSize-1, 10, "new stream")
 
 	b, err = fh.Download(PreloadSize, 10)
 	shouldPass(t, err, "PreloadSize: max preload")
@@ -1,17 +1,48 @@
 package fh
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"io"
 	"sync"
+
+	"splitfuseX/backbone"
+	"splitfuseX/logging"
 )
 
 // FileHandler stellt Methoden zur Verfügung, um mit einer drive Datei zu interagieren.
-// Jeder FileHandler hat dabei seinen eigenen Cache der im RAM abgelegt ist.
+// Für beliebige Zugriffe (zB Springen in einem Video) werden mehrere Streams (Range-Requests) parallel offen gehalten.
+// Jeder Stream hat dabei seinen eigenen Cache der im RAM abgelegt ist.
 type FileHandler struct {
-	mutex  *sync.Mutex   // sorgt dafür, dass alle exportierten Methoden atomar sind
+	mutex   *sync.Mutex // schützt die Liste der Streams und deren Bereiche (start, offset)
+	client  backbone.Client
+	fileId  string
+	streams []*stream // offene Streams, vorne steht der zuletzt verwendete Stream (max. MaxStreams)
+	closed  bool      // CloseAndClear() wurde aufgerufen
+
+	// Alle Verbindungen laufen in diesem ctx. CloseAndClear() beendet ihn, damit hängende Downloads abbrechen.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// stream ist eine Verbindung zur Datei auf Google Drive ab einem bestimmten offset (Range-Request).
+// Ein Stream liest nur vorwärts. Für Daten davor wird ein neuer Stream geöffnet.
+type stream struct {
+	fh    *FileHandler
+	mutex *sync.Mutex // sorgt dafür, dass immer nur ein Download() gleichzeitig den Stream verwendet
+
+	// Diese Werte werden nur geändert, wenn fh.mutex UND mutex gesperrt sind.
+	start  int64 // erstes Byte im Cache des Streams
+	offset int64 // nächstes, noch nicht gelesenes Byte der Datei auf Google Drive
+
 	resp   io.ReadCloser // Verbindung zur Datei auf Google Drive
-	offset int64         // nächstes, noch nicht gelesenes Byte der Datei auf Google Drive
+	eof    bool          // das Ende der Datei wurde erreicht
+	closed bool          // der Stream wurde geschlossen und darf nicht mehr verwendet werden
+
+	// Mit cancel wird die aktuelle Verbindung abgebrochen (auch während eines blockierenden Read, siehe interrupt).
+	// cancel wird nur geändert, wenn mutex UND connMutex gesperrt sind.
+	connMutex *sync.Mutex
+	cancel    context.CancelFunc
 
 	// Der Cache ist eine verkettete Liste von CacheElements.
 	firstCacheElement *CacheElement // das erste CacheElement
@@ -27,78 +58,286 @@ type CacheElement struct {
 	next     *CacheElement // nächstes CacheElement (verkettete Liste)
 }
 
-// CloseAndClear schließt die Verbindung zur Datei und löscht den Cache.
+// errStreamUnusable bedeutet, dass der Stream inzwischen nicht mehr für den angeforderten offset geeignet ist
+// (geschlossen oder von einem anderen Download() weitergerückt). Es wird dann ein anderer Stream gesucht.
+var errStreamUnusable = errors.New("stream unusable")
+
+// errClosed wird von Download() zurück gegeben, wenn der FileHandler bereits geschlossen wurde.
+var errClosed = errors.New("file handler closed")
+
+// CloseAndClear schließt alle Verbindungen zur Datei und löscht die Caches.
 func (fh *FileHandler) CloseAndClear() {
 
 	// LOCK / UNLOCK
 	fh.mutex.Lock()
-	defer fh.mutex.Unlock()
-
-	// Schließe die Verbindung zu Google Drive
-	if fh.resp != nil {
-		fh.resp.Close()
+	streams := fh.streams
+	fh.streams = nil
+	if !fh.closed {
+		openFileHandlers.Dec()
 	}
+	fh.closed = true
+	fh.mutex.Unlock()
 
-	// Setze alle Variablen auf nil, damit der Garbage Collector den Speicher freigeben kann
-	fh.resp = nil
-	fh.offset = 0
-	fh.firstCacheElement = nil
-	fh.lastCacheElement = nil
+	// Laufende Downloads abbrechen und die Verbindungen zu Google Drive schließen
+	fh.cancel()
+	for _, s := range streams {
+		s.close()
+	}
 }
 
 // Download gibt Bytes ab dem gewünschten Offset zurück.
+// Liegt der offset vor dem Cache oder zu weit dahinter, dann wird ein neuer Stream geöffnet.
 // Hinweis: die gewünschte Länge ist als max. zu verstehen und muss nicht erreicht werden.
+// Download darf gleichzeitig aufgerufen werden (zB vom Prefetcher).
 func (fh *FileHandler) Download(requestedOffset int64, length int) ([]byte, error) {
+	return fh.DownloadContext(context.Background(), requestedOffset, length)
+}
+
+// DownloadContext ist wie Download. Wird der ctx beendet (zB Timeout eines FUSE Read), dann wird die Verbindung
+// des verwendeten Streams abgebrochen und der Fehler des ctx zurück gegeben. Der Stream wird beim nächsten Download neu geöffnet.
+func (fh *FileHandler) DownloadContext(ctx context.Context, requestedOffset int64, length int) ([]byte, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		s := fh.pickStream(requestedOffset)
+		if s == nil {
+			return nil, errClosed
+		}
+
+		// LOCK / UNLOCK
+		s.mutex.Lock()
+		stop := s.watch(ctx)
+		b, err := s.download(ctx, requestedOffset, length)
+		stop()
+		s.mutex.Unlock()
+
+		// Der Stream wurde inzwischen von einem anderen Download() verwendet -> neu suchen
+		if err == errStreamUnusable {
+			continue
+		}
+		return b, err
+	}
+}
+
+// pickStream sucht einen Stream, dessen Cache den offset enthält oder der ihn mit wenigen Bytes erreicht.
+// Gibt es keinen, dann wird ein neuer Stream angelegt (aber noch nicht geöffnet).
+// Sind es dann zu viele Streams, wird der am längsten nicht verwendete Stream geschlossen.
+// Wurde der FileHandler bereits geschlossen, dann wird nil zurück gegeben.
+func (fh *FileHandler) pickStream(requestedOffset int64) *stream {
 
 	// LOCK / UNLOCK
 	fh.mutex.Lock()
 	defer fh.mutex.Unlock()
 
-	// Kein Zurücklesen!
-	// Wird versucht auf Daten vor dem Cache zu zugreifen, dann ist das ein Fehler!
-	if requestedOffset < fh.firstCacheElement.offset {
-		return nil, fmt.Errorf("can't read backward: requestedOffset=%d, cacheStartOffset=%d", requestedOffset, fh.firstCacheElement.offset)
+	if fh.closed {
+		return nil
+	}
+
+	// den Stream mit dem kleinsten Sprung nach vorne suchen
+	best := -1
+	var bestJump int64
+	for i, s := range fh.streams {
+		if requestedOffset < s.start || requestedOffset > s.offset+MaxForwardJump {
+			continue
+		}
+		jump := requestedOffset - s.offset
+		if jump < 0 {
+			jump = 0 // im Cache
+		}
+		if best < 0 || jump < bestJump {
+			best, bestJump = i, jump
+		}
+	}
+
+	// Stream vorne einreihen (zuletzt verwendet)
+	var s *stream
+	if best >= 0 {
+		s = fh.streams[best]
+		fh.streams = append(fh.streams[:best], fh.streams[best+1:]...)
+	} else {
+		s = fh.newStream(requestedOffset)
+	}
+	fh.streams = append([]*stream{s}, fh.streams...)
+
+	// zu viele Streams? -> den ältesten schließen (im Hintergrund, er könnte noch verwendet werden)
+	for len(fh.streams) > MaxStreams {
+		old := fh.streams[len(fh.streams)-1]
+		fh.streams = fh.streams[:len(fh.streams)-1]
+		go old.close()
+	}
+
+	return s
+}
+
+// watch bricht die Verbindung des Streams ab, sobald der ctx beendet wird (siehe interrupt).
+// Die zurückgegebene Funktion beendet die Überwachung.
+func (s *stream) watch(ctx context.Context) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {} // kann nie beendet werden (zB context.Background())
 	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.interrupt()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
 
-	// Keine weiten Sprünge!
-	// Wird versucht einen großen Bereich beim Lesen zu überspringen, dann ist das ein Fehler! (nur sequenzielles Lesen!)
-	if requestedOffset > fh.offset+MaxForwardJump {
-		return nil, fmt.Errorf("requestedOffset too far away: requestedOffset=%d, fhOffset=%d", requestedOffset, fh.offset)
+// interrupt bricht die aktuelle Verbindung ab. Ein blockierendes Read gibt dann einen Fehler zurück.
+// Der mutex des Streams wird dafür NICHT benötigt.
+func (s *stream) interrupt() {
+	s.connMutex.Lock()
+	defer s.connMutex.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// setCancel ersetzt die Funktion zum Abbrechen der aktuellen Verbindung (und bricht die alte ab).
+// ACHTUNG: Der mutex des Streams muss bereits gesperrt sein!
+func (s *stream) setCancel(cancel context.CancelFunc) {
+	s.connMutex.Lock()
+	defer s.connMutex.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.cancel = cancel
+}
+
+// open öffnet die Verbindung zur Datei ab dem offset des Streams.
+// Die Verbindung läuft im ctx des FileHandler, damit sie länger als ein einzelner Download bestehen kann.
+// ACHTUNG: Der mutex des Streams muss bereits gesperrt sein!
+func (s *stream) open() error {
+
+	// http response zur Datei holen
+	ctx, cancel := context.WithCancel(s.fh.ctx)
+	s.setCancel(cancel)
+	resp, err := s.fh.client.ReadContext(ctx, s.fh.fileId, s.offset, MaxFileSize)
+	if err != nil {
+		return err
+	}
+	s.resp = resp
+
+	// leeres CacheElement als Anfang der verketteten Liste
+	if s.firstCacheElement == nil {
+		s.firstCacheElement = &CacheElement{b: []byte{}, offset: s.offset}
+		s.lastCacheElement = s.firstCacheElement
+	}
+	return nil
+}
+
+// close schließt die Verbindung des Streams und löscht den Cache.
+func (s *stream) close() {
+
+	// LOCK / UNLOCK
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Schließe die Verbindung zu Google Drive
+	if s.resp != nil {
+		s.resp.Close()
+	}
+	s.setCancel(nil)
+
+	// Setze alle Variablen auf nil, damit der Garbage Collector den Speicher freigeben kann
+	s.resp = nil
+	s.closed = true
+	s.firstCacheElement = nil
+	s.lastCacheElement = nil
+}
+
+// download gibt Bytes ab dem gewünschten Offset aus dem Stream zurück.
+// ACHTUNG: Der mutex des Streams muss bereits gesperrt sein!
+func (s *stream) download(ctx context.Context, requestedOffset int64, length int) ([]byte, error) {
+
+	// Ist der Stream (noch) für diesen offset geeignet?
+	// Ein anderer Download() könnte ihn inzwischen geschlossen oder weitergerückt haben.
+	if s.closed || requestedOffset < s.start || requestedOffset > s.offset+MaxForwardJump {
+		return nil, errStreamUnusable
+	}
+
+	// liegen die Daten bereits im Cache?
+	if requestedOffset+int64(length) <= s.offset || s.eof {
+		streamCacheRequests.Inc("hit")
+	} else {
+		streamCacheRequests.Inc("miss")
+	}
+
+	// neuer (oder abgebrochener) Stream -> Verbindung öffnen
+	if s.resp == nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.open(); err != nil {
+			return nil, err
+		}
 	}
 
 	// Diese Schleife lädt Daten in den Cache, wenn sie angefordert werden.
 	// ACHTUNG: Es kann sein, das bereits EOF erreicht wurde und dieser Wunsch nie erfüllt werden kann!
-	for requestedOffset+int64(length) > fh.offset {
+	retries := 0
+	for requestedOffset+int64(length) > s.offset && !s.eof {
 
 		// Liest einmal ein CacheElement.
 		// Das kann bei einer leeren Datei auch 0 Bytes enthalten.
 		b := make([]byte, ReadBufferSize)
-		n, err := fh.resp.Read(b)
+		n, err := s.resp.Read(b)
+		if err != nil && err != io.EOF && ctx.Err() != nil {
+			// Abbruch (siehe interrupt): die Verbindung wird beim nächsten Download ab dem aktuellen offset neu geöffnet
+			s.resp.Close()
+			s.resp = nil
+			return nil, ctx.Err()
+		}
+		if err != nil && err != io.EOF && s.fh.ctx.Err() != nil {
+			// CloseAndClear() wurde aufgerufen
+			return nil, errClosed
+		}
 		if err != nil && err != io.EOF {
-			return nil, err
+			// Verbindungsfehler: Die Verbindung wird ab dem aktuellen offset neu aufgebaut
+			retries++
+			if retries > MaxStreamRetries {
+				return nil, err
+			}
+			streamRetries.Inc()
+			logging.Warn("stream: reopen after read error", logging.FileId(s.fh.fileId), logging.F("offset", s.offset), logging.F("retry", retries), logging.Err(err))
+			s.resp.Close()
+			if err := s.open(); err != nil {
+				return nil, err
+			}
+			continue
 		}
 		b = b[:n] // trim buffer
 
-		cacheElement := &CacheElement{
-			b:      b,
-			offset: fh.offset,
-		}
-
 		// Es wurden keine Bytes gelesen
 		// Damit gibt es auch nichts mehr --> Schleife verlassen
 		if n <= 0 {
+			s.eof = true
 			break
 		}
 
-		// Nun, da der fh auf die Datei in Google Drive weitergerückt wurde,
-		// muss ein neuer fhOffset berechnet werden.
-		// (fhOffset: nächstes, noch nicht gelesenes Byte der Datei auf Google Drive)
-		fh.offset += int64(n)
-
 		// Das neue CacheElement in die verkettete Liste einbaun
-		cacheElement.previous = fh.lastCacheElement
-		fh.lastCacheElement.next = cacheElement
-		fh.lastCacheElement = cacheElement
+		cacheElement := &CacheElement{
+			b:        b,
+			offset:   s.offset,
+			previous: s.lastCacheElement,
+		}
+		s.lastCacheElement.next = cacheElement
+		s.lastCacheElement = cacheElement
+
+		// Nun, da der Stream auf die Datei in Google Drive weitergerückt wurde,
+		// muss ein neuer offset berechnet werden.
+		// (offset: nächstes, noch nicht gelesenes Byte der Datei auf Google Drive)
+		s.fh.mutex.Lock()
+		s.offset += int64(n)
+		s.fh.mutex.Unlock()
+
+		if err == io.EOF {
+			s.eof = true
+		}
 	}
 
 	/*
@@ -109,7 +348,7 @@ func (fh *FileHandler) Download(requestedOffset int64, length int) ([]byte, erro
 	 */
 
 	// Suche von Hinten nach dem CacheElement, in dem die angeforderten Daten beginnen.
-	cache := fh.lastCacheElement
+	cache := s.lastCacheElement
 	for requestedOffset < cache.offset {
 		cache = cache.previous
 	}
@@ -126,9 +365,9 @@ func (fh *FileHandler) Download(requestedOffset int64, length int) ([]byte, erro
 	}
 
 	// Es werden Bytes für die Zurückgabe vorbereitet.
-	// Für den Anfang sind das alle Bytes, die im aktuellen CacheElement vorhanden sind.
-	// (Natürlich exklusive des innerOffset)
-	retBytes := cache.b[innerOffset:]
+	// Die Bytes werden kopiert, damit der Aufrufer sie verändern darf (zB beim Entschlüsseln), ohne den Cache zu zerstören.
+	retBytes := make([]byte, 0, length)
+	retBytes = append(retBytes, cache.b[innerOffset:]...)
 
 	// Es kann jedoch sein, dass die angeforderten Daten auch in andere CacheElements hinein reichen.
 	// Daher wird das retBytes solange angereichert, bis es größer ist als die angeforderte Datenmenge.
@@ -145,7 +384,7 @@ func (fh *FileHandler) Download(requestedOffset int64, length int) ([]byte, erro
 	}
 
 	// Zuletzt muss der Cache auf seine maximale Größe verfkleinert werden
-	fh.cleanupCache()
+	s.cleanupCache()
 
 	// EOF (Kompatibilität)
 	// Werden 0 bytes zurück gegeben, dann wird stattdessen ein EOF Error geworfen.
@@ -157,9 +396,10 @@ func (fh *FileHandler) Download(requestedOffset int64, length int) ([]byte, erro
 }
 
 // cleanupCache verkleinert den Cache, sollte er zu groß sein.
-func (fh *FileHandler) cleanupCache() {
-	size := 0                    // ermittelte Größe des Caches
-	cache := fh.lastCacheElement // aktuelles CacheElement
+// ACHTUNG: Der mutex des Streams muss bereits gesperrt sein!
+func (s *stream) cleanupCache() {
+	size := 0                   // ermittelte Größe des Caches
+	cache := s.lastCacheElement // aktuelles CacheElement
 
 	// Wir gehen von Hinten die verkettete Liste durch,
 	// solange bis der Anfang der Liste erreicht wurde.
@@ -170,12 +410,17 @@ func (fh *FileHandler) cleanupCache() {
 		// HUCH! DER CACHE IST ZU GROß!!
 		if size > MaxCacheSize {
 			// Hier hacken wir die Liste ab!
-			fh.firstCacheElement = cache        // dieses Element ist nun der Anfang
-			fh.firstCacheElement.previous = nil // und der Anfang hat kein Element vor sich
-			break                               // Ende!
+			s.firstCacheElement = cache        // dieses Element ist nun der Anfang
+			s.firstCacheElement.previous = nil // und der Anfang hat kein Element vor sich
+			break                              // Ende!
 		}
 
 		// nächstes Element
 		cache = cache.previous
 	}
+
+	// der Bereich des Streams beginnt nun beim ersten CacheElement
+	s.fh.mutex.Lock()
+	s.start = s.firstCacheElement.offset
+	s.fh.mutex.Unlock()
 }
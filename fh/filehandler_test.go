@@ -1,12 +1,16 @@
 package fh
 
 import (
+	"context"
 	"encoding/base64"
 	"io"
 	"math/rand"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
+	"splitfuseX/backbone"
 	"splitfuseX/backbone/local"
 )
 
@@ -18,10 +22,7 @@ func TestFileHandler_Const(t *testing.T) {
 
 	// TestNewFileHandler()
 	fileId := base64.StdEncoding.EncodeToString([]byte(testFileList[0].name))
-	fh, err := NewFileHandler(client, fileId, 0)
-	if err != nil {
-		t.Error(err)
-	}
+	fh := NewFileHandler(context.Background(), client, fileId, 0)
 	defer fh.CloseAndClear()
 
 	// TESTS
@@ -36,17 +37,58 @@ func TestFileHandler_Const(t *testing.T) {
 	testBytes(t, b, testFileList[0].path, 0, MaxCacheSize*2+1000, "MaxCacheSize: start 2*cache")
 
 	b, err = fh.Download(0, 10)
-	shouldFail(t, err, "MaxCacheSize: requested bytes not in the cache")
-	testBytes(t, b, testFileList[0].path, 0, 0, "MaxCacheSize: error: no bytes read")
+	shouldPass(t, err, "MaxCacheSize: requested bytes not in the cache (new stream)")
+	testBytes(t, b, testFileList[0].path, 0, 10, "MaxCacheSize: new stream")
 
 	// MaxForwardJump
 	b, err = fh.Download(MaxForwardJump*2, 10)
-	shouldFail(t, err, "MaxForwardJump error")
-	testBytes(t, b, testFileList[0].path, MaxForwardJump*2, 0, "MaxForwardJump error")
+	shouldPass(t, err, "MaxForwardJump: new stream")
+	testBytes(t, b, testFileList[0].path, MaxForwardJump*2, 10, "MaxForwardJump: new stream")
 
 	b, err = fh.Download(MaxForwardJump, 10)
 	shouldPass(t, err, "MaxForwardJump ok")
 	testBytes(t, b, testFileList[0].path, MaxForwardJump, 10, "MaxForwardJump ok")
+
+	// MaxStreams
+	if len(fh.streams) > MaxStreams {
+		t.Errorf("MaxStreams: too many streams: %d", len(fh.streams))
+	}
+}
+
+// Test random access (mehrere Streams, auch gleichzeitig)
+func TestFileHandler_RandomAccess(t *testing.T) {
+
+	// Dummy Client
+	client := local.NewDiskClient(testFileList[0].folder)
+
+	// TestNewFileHandler()
+	fileId := base64.StdEncoding.EncodeToString([]byte(testFileList[0].name))
+	fh := NewFileHandler(context.Background(), client, fileId, 0)
+	defer fh.CloseAndClear()
+
+	// rückwärts lesen
+	fileSize := int64(testFileList[0].size)
+	for offset := fileSize - 4096; offset > fileSize-MaxCacheSize*3; offset -= PreloadSize / 2 {
+		b, err := fh.Download(offset, 4096)
+		shouldPass(t, err, "backward read")
+		testBytes(t, b, testFileList[0].path, offset, 4096, "backward read")
+	}
+
+	// mehrere Leser gleichzeitig an verschiedenen Stellen
+	wg := &sync.WaitGroup{}
+	for i := 0; i < MaxStreams*2; i++ {
+		wg.Add(1)
+		go func(r *rand.Rand) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				offset := r.Int63n(fileSize)
+				b, err := fh.Download(offset, 10000)
+				shouldPass(t, err, "concurrent read")
+				testBytes(t, b, testFileList[0].path, offset, 10000, "concurrent read")
+			}
+		}(rand.New(rand.NewSource(int64(i))))
+	}
+	wg.Wait()
 }
 
 // Test download
@@ -57,10 +99,7 @@ func TestFileHandler_Download(t *testing.T) {
 
 	// TestNewFileHandler()
 	fileId := base64.StdEncoding.EncodeToString([]byte(testFileList[0].name))
-	fh, err := NewFileHandler(client, fileId, 0)
-	if err != nil {
-		t.Error(err)
-	}
+	fh := NewFileHandler(context.Background(), client, fileId, 0)
 	defer fh.CloseAndClear()
 
 	// TESTS
@@ -91,10 +130,7 @@ func TestFileHandler_BigRead(t *testing.T) {
 		fileId := base64.StdEncoding.EncodeToString([]byte(x.name))
 
 		// new fh
-		fh, err := NewFileHandler(client, fileId, 0)
-		if err != nil {
-			t.Error(err)
-		}
+		fh := NewFileHandler(context.Background(), client, fileId, 0)
 		defer fh.CloseAndClear() // Das ist absicht! Die FH internen Caches sollen in der Schleife erhalten bleiben!
 
 		// new file (origin)
@@ -139,3 +175,61 @@ func TestFileHandler_BigRead(t *testing.T) {
 		}
 	}
 }
+
+// stallingClient liefert die ersten 1000 Bytes und blockiert dann, bis der ctx beendet wird (hängender Download).
+type stallingClient struct {
+	backbone.Client
+}
+
+func (c *stallingClient) ReadContext(ctx context.Context, fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	available := 1000 - offset
+	if available < 0 {
+		available = 0
+	}
+	return io.NopCloser(io.MultiReader(io.LimitReader(zeroReader{}, available), &blockingReader{ctx})), nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) { return len(p), nil }
+
+type blockingReader struct{ ctx context.Context }
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	<-r.ctx.Done()
+	return 0, r.ctx.Err()
+}
+
+// Test Abbruch hängender Downloads (ctx und CloseAndClear)
+func TestFileHandler_Context(t *testing.T) {
+	fh := NewFileHandler(context.Background(), &stallingClient{}, "stalled", 0)
+
+	// Bytes im Cache gehen auch ohne Verbindung
+	if b, err := fh.Download(0, 1000); err != nil || len(b) != 1000 {
+		t.Fatalf("download cached bytes: %d, %v", len(b), err)
+	}
+
+	// Timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := fh.DownloadContext(ctx, 0, 2000); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// CloseAndClear bricht einen hängenden Download ab
+	done := make(chan error)
+	go func() {
+		_, err := fh.Download(0, 2000)
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	fh.CloseAndClear()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error after CloseAndClear")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CloseAndClear did not abort the download")
+	}
+}
@@ -0,0 +1,11 @@
+package fh
+
+import "splitfuseX/metrics"
+
+// Metriken der FileHandler und Caches (siehe metrics.Default)
+var (
+	streamCacheRequests = metrics.Default.NewCounter("splitfusex_fh_cache_requests_total", "Downloads eines Streams: hit (aus dem RAM Cache) oder miss (aus dem Speicher)", "result")
+	streamRetries       = metrics.Default.NewCounter("splitfusex_fh_stream_retries_total", "Neu geöffnete Verbindungen nach einem Verbindungsfehler")
+	openFileHandlers    = metrics.Default.NewGauge("splitfusex_fh_open", "Offene FileHandler")
+	diskCacheRequests   = metrics.Default.NewCounter("splitfusex_diskcache_requests_total", "Zugriffe auf den DiskCache: hit oder miss", "result")
+)
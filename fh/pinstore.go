@@ -0,0 +1,265 @@
+package fh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PinStore speichert ganze Chunks von angehefteten (pin) Dateien auf der lokalen Festplatte.
+// Die Chunks werden verschlüsselt abgelegt (genau so wie im Speicher).
+// Im Gegensatz zum DiskCache werden Chunks nie automatisch gelöscht, sondern nur mit Retain().
+// Ist das Quota (maxSize) erreicht, dann werden keine weiteren Chunks gespeichert.
+// Zusätzlich wird die Liste der angehefteten Pfade (relativ zum Root des Mounts) im Ordner gespeichert.
+type PinStore struct {
+	mutex   *sync.Mutex
+	dir     string           // Ordner mit der Liste der Pfade und dem Unterordner für die Chunks
+	maxSize int64            // Quota: max. Größe aller Chunks in Bytes
+	size    int64            // aktuelle Größe aller Chunks in Bytes (inkl. gerade geschriebener)
+	chunks  map[string]int64 // chunkName -> Größe
+	paths   map[string]bool  // angeheftete Pfade
+}
+
+// ErrPinQuota wird zurückgegeben, wenn ein Chunk das Quota des PinStore überschreiten würde.
+var ErrPinQuota = errors.New("pin quota exceeded")
+
+const (
+	pinStoreChunkDir = "chunks"    // Unterordner für die Chunks
+	pinStorePathFile = "pins.json" // Liste der angehefteten Pfade
+)
+
+// NewPinStore öffnet (oder erstellt) einen PinStore im angegebenen Ordner.
+// Bereits vorhandene Chunks und Pfade werden übernommen.
+func NewPinStore(dir string, maxSize int64) (*PinStore, error) {
+	chunkDir := filepath.Join(dir, pinStoreChunkDir)
+	if err := os.MkdirAll(chunkDir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &PinStore{
+		mutex:   &sync.Mutex{},
+		dir:     dir,
+		maxSize: maxSize,
+		chunks:  make(map[string]int64),
+		paths:   make(map[string]bool),
+	}
+
+	// vorhandene Chunks einlesen
+	infos, err := ioutil.ReadDir(chunkDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		// abgebrochene Schreibvorgänge entfernen
+		if strings.HasPrefix(info.Name(), diskCacheTmpPrefix) {
+			os.Remove(filepath.Join(chunkDir, info.Name()))
+			continue
+		}
+		s.chunks[info.Name()] = info.Size()
+		s.size += info.Size()
+	}
+
+	// angeheftete Pfade einlesen
+	b, err := ioutil.ReadFile(filepath.Join(dir, pinStorePathFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var paths []string
+		if err := json.Unmarshal(b, &paths); err != nil {
+			return nil, fmt.Errorf("can't parse %s: %v", pinStorePathFile, err)
+		}
+		for _, p := range paths {
+			s.paths[p] = true
+		}
+	}
+
+	return s, nil
+}
+
+// Paths gibt alle angehefteten Pfade sortiert zurück.
+func (s *PinStore) Paths() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ret := make([]string, 0, len(s.paths))
+	for p := range s.paths {
+		ret = append(ret, p)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// AddPath heftet einen Pfad an und speichert die Liste.
+func (s *PinStore) AddPath(p string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.paths[p] {
+		return nil
+	}
+	s.paths[p] = true
+	if err := s.savePaths(); err != nil {
+		delete(s.paths, p)
+		return err
+	}
+	return nil
+}
+
+// RemovePath entfernt einen angehefteten Pfad und speichert die Liste.
+// War der Pfad nicht angeheftet, dann ist ok false.
+func (s *PinStore) RemovePath(p string) (ok bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.paths[p] {
+		return false, nil
+	}
+	delete(s.paths, p)
+	if err := s.savePaths(); err != nil {
+		s.paths[p] = true
+		return false, err
+	}
+	return true, nil
+}
+
+// savePaths schreibt die Liste der Pfade (zuerst in eine temporäre Datei).
+// ACHTUNG: Der mutex muss bereits gesperrt sein!
+func (s *PinStore) savePaths() error {
+	paths := make([]string, 0, len(s.paths))
+	for p := range s.paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	b, err := json.Marshal(paths)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.dir, diskCacheTmpPrefix+pinStorePathFile)
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, pinStorePathFile))
+}
+
+// Contains prüft, ob ein Chunk im PinStore ist.
+func (s *PinStore) Contains(chunkName string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.chunks[chunkName]
+	return ok
+}
+
+// ReadAt liest Bytes (verschlüsselt) eines Chunks. Am Ende des Chunks werden weniger Bytes zurückgegeben.
+// Ist der Chunk nicht im PinStore, dann ist ok false.
+func (s *PinStore) ReadAt(chunkName string, offset int64, length int) (b []byte, ok bool) {
+	if !s.Contains(chunkName) {
+		return nil, false
+	}
+
+	// Die Datei wird ohne Lock gelesen. Wurde sie inzwischen gelöscht, dann ist ok false.
+	f, err := os.Open(filepath.Join(s.dir, pinStoreChunkDir, chunkName))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	b = make([]byte, length)
+	n, err := f.ReadAt(b, offset)
+	if err != nil && err != io.EOF {
+		return nil, false
+	}
+	return b[:n], true
+}
+
+// Put speichert einen ganzen Chunk (verschlüsselt) mit der angegebenen Größe.
+// Würde das Quota überschritten werden, dann wird ErrPinQuota zurückgegeben.
+func (s *PinStore) Put(chunkName string, r io.Reader, size int64) error {
+
+	// Platz reservieren
+	s.mutex.Lock()
+	if _, ok := s.chunks[chunkName]; ok {
+		s.mutex.Unlock()
+		return nil
+	}
+	if s.size+size > s.maxSize {
+		s.mutex.Unlock()
+		return ErrPinQuota
+	}
+	s.size += size
+	s.mutex.Unlock()
+
+	err := s.write(chunkName, r, size)
+
+	// LOCK / UNLOCK
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err != nil {
+		s.size -= size
+		return err
+	}
+	s.chunks[chunkName] = size
+	return nil
+}
+
+// write schreibt einen Chunk zuerst in eine temporäre Datei, damit es nie halbe Chunks gibt.
+func (s *PinStore) write(chunkName string, r io.Reader, size int64) error {
+	chunkDir := filepath.Join(s.dir, pinStoreChunkDir)
+	tmp, err := ioutil.TempFile(chunkDir, diskCacheTmpPrefix)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(tmp, io.LimitReader(r, size))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n != size {
+		err = fmt.Errorf("chunk %s is incomplete: %d of %d bytes", chunkName, n, size)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(chunkDir, chunkName))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Retain löscht alle Chunks, die nicht in keep enthalten sind.
+func (s *PinStore) Retain(keep map[string]bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for chunkName, size := range s.chunks {
+		if keep[chunkName] {
+			continue
+		}
+		os.Remove(filepath.Join(s.dir, pinStoreChunkDir, chunkName))
+		delete(s.chunks, chunkName)
+		s.size -= size
+	}
+}
+
+// Size gibt die aktuelle Größe aller Chunks in Bytes zurück.
+func (s *PinStore) Size() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.size
+}
+
+// MaxSize gibt das Quota in Bytes zurück.
+func (s *PinStore) MaxSize() int64 {
+	return s.maxSize
+}
@@ -0,0 +1,74 @@
+package fh
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Prüft Put, ReadAt, Retain, das Quota und die gespeicherten Pfade (auch nach einem Neustart)
+func TestPinStore(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "TestPinStore")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	s, err := NewPinStore(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// speichern und lesen
+	if err := s.Put("a", bytes.NewReader(bytes.Repeat([]byte("a"), 60)), 60); err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := s.ReadAt("a", 50, 20); !ok || !bytes.Equal(b, bytes.Repeat([]byte("a"), 10)) {
+		t.Errorf("wrong read at the end of the chunk: %v %q", ok, b)
+	}
+	if _, ok := s.ReadAt("b", 0, 10); ok {
+		t.Error("b should not be in the store")
+	}
+
+	// Quota und unvollständige Chunks
+	if err := s.Put("b", bytes.NewReader(make([]byte, 50)), 50); err != ErrPinQuota {
+		t.Errorf("put should fail with ErrPinQuota: %v", err)
+	}
+	if err := s.Put("c", bytes.NewReader(make([]byte, 10)), 20); err == nil {
+		t.Error("put of an incomplete chunk should fail")
+	}
+	if s.Size() != 60 || s.Contains("c") {
+		t.Errorf("wrong size: %d", s.Size())
+	}
+
+	// Pfade
+	if err := s.AddPath("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddPath("file"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.RemovePath("file"); !ok || err != nil {
+		t.Errorf("remove path failed: %v %v", ok, err)
+	}
+	if ok, _ := s.RemovePath("unknown"); ok {
+		t.Error("unknown path should not be removed")
+	}
+
+	// Neustart: Chunks und Pfade bleiben erhalten
+	s, err = NewPinStore(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Size() != 60 || !s.Contains("a") {
+		t.Errorf("chunks not restored: %d", s.Size())
+	}
+	if p := s.Paths(); len(p) != 1 || p[0] != "dir" {
+		t.Errorf("paths not restored: %v", p)
+	}
+
+	// Retain löscht alle anderen Chunks
+	s.Retain(map[string]bool{})
+	if s.Size() != 0 || s.Contains("a") {
+		t.Errorf("chunk not removed: %d", s.Size())
+	}
+}
@@ -0,0 +1,93 @@
+package fuse
+
+import (
+	"fmt"
+	"sync"
+
+	"splitfuseX/backbone"
+	"splitfuseX/core"
+)
+
+// chunkIndex beschleunigt Open(): Die fileIds der Chunks werden über einen Index gesucht (statt die ganze FileList
+// zu durchsuchen) und die abgeleiteten Schlüssel (PBKDF2) werden nur einmal pro Chunk berechnet.
+// Der Nullwert ist ein leerer, verwendbarer Index.
+type chunkIndex struct {
+	mutex  sync.RWMutex
+	fileId map[chunkObject]string          // Name und Größe eines Chunks -> fileId (siehe update)
+	keys   map[core.ChunkHash]derivedChunk // bereits berechnete Namen und Schlüssel
+}
+
+// chunkObject identifiziert einen Chunk im Speicher.
+type chunkObject struct {
+	name string
+	size int64
+}
+
+// derivedChunk enthält die aus einem ChunkHash abgeleiteten Werte.
+type derivedChunk struct {
+	name string // Dateiname im Speicher (hex)
+	key  []byte // Schlüssel für AES-256
+}
+
+// update baut den Index aus der FileList neu auf. Muss nach jedem UpdateFileList() aufgerufen werden.
+func (idx *chunkIndex) update(fileList map[string]*backbone.FileObject) {
+	newIndex := make(map[chunkObject]string, len(fileList))
+	for fileId, obj := range fileList {
+		newIndex[chunkObject{name: obj.Name, size: obj.Size}] = fileId
+	}
+
+	idx.mutex.Lock()
+	idx.fileId = newIndex
+	idx.mutex.Unlock()
+}
+
+// lookup sucht die fileId eines Chunks.
+func (idx *chunkIndex) lookup(name string, size int64) (string, bool) {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	fileId, ok := idx.fileId[chunkObject{name: name, size: size}]
+	return fileId, ok
+}
+
+// derive gibt Namen und Schlüssel eines Chunks zurück. Diese werden nur beim ersten Mal berechnet.
+func (idx *chunkIndex) derive(keyFile core.KeyFile, chunkHash core.ChunkHash) (string, []byte) {
+	idx.mutex.RLock()
+	d, ok := idx.keys[chunkHash]
+	idx.mutex.RUnlock()
+	if ok {
+		return d.name, d.key
+	}
+
+	// berechnen (ohne Lock, das dauert)
+	d = derivedChunk{
+		name: fmt.Sprintf("%x", keyFile.CalcChunkName(chunkHash[:])),
+		key:  keyFile.CalcChunkKey(chunkHash[:]),
+	}
+
+	idx.mutex.Lock()
+	if idx.keys == nil {
+		idx.keys = make(map[core.ChunkHash]derivedChunk)
+	}
+	idx.keys[chunkHash] = d
+	idx.mutex.Unlock()
+
+	return d.name, d.key
+}
+
+// prune entfernt alle berechneten Schlüssel, deren Chunks nicht mehr in der DB sind.
+func (idx *chunkIndex) prune(db core.SfDb) {
+	used := make(map[core.ChunkHash]bool)
+	for _, dbFile := range db {
+		for _, chunkHash := range dbFile.FileChunks {
+			used[chunkHash] = true
+		}
+	}
+
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	for chunkHash := range idx.keys {
+		if !used[chunkHash] {
+			delete(idx.keys, chunkHash)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package fuse
+
+import (
+	"fmt"
+	"testing"
+
+	"splitfuseX/backbone"
+	"splitfuseX/core"
+)
+
+// Prüft Index, Schlüssel-Cache und prune
+func TestChunkIndex(t *testing.T) {
+	var idx chunkIndex
+	keyFile := core.KeyFile{}
+	hash := core.ChunkHash{1, 2, 3}
+
+	// Namen und Schlüssel müssen denen von KeyFile entsprechen
+	name, key := idx.derive(keyFile, hash)
+	if name != fmt.Sprintf("%x", keyFile.CalcChunkName(hash[:])) || string(key) != string(keyFile.CalcChunkKey(hash[:])) {
+		t.Fatal("derive() differs from KeyFile")
+	}
+	if len(idx.keys) != 1 {
+		t.Errorf("key not cached: %d", len(idx.keys))
+	}
+
+	// Index: Name und Größe müssen passen
+	idx.update(map[string]*backbone.FileObject{"id1": {Name: name, Size: 100}})
+	if fileId, ok := idx.lookup(name, 100); !ok || fileId != "id1" {
+		t.Errorf("lookup failed: %q %v", fileId, ok)
+	}
+	if _, ok := idx.lookup(name, 99); ok {
+		t.Error("lookup with wrong size should fail")
+	}
+
+	// neue FileList ersetzt den Index
+	idx.update(map[string]*backbone.FileObject{})
+	if _, ok := idx.lookup(name, 100); ok {
+		t.Error("lookup after update should fail")
+	}
+
+	// prune entfernt nicht mehr verwendete Schlüssel
+	idx.prune(core.SfDb{"a": core.SfFile{FileChunks: []core.ChunkHash{hash}}})
+	if len(idx.keys) != 1 {
+		t.Errorf("used key removed: %d", len(idx.keys))
+	}
+	idx.prune(core.SfDb{})
+	if len(idx.keys) != 0 {
+		t.Errorf("unused key not removed: %d", len(idx.keys))
+	}
+}
@@ -0,0 +1,27 @@
+package fuse
+
+import (
+	"strconv"
+	"time"
+
+	"splitfuseX/metrics"
+)
+
+// Metriken des Mounts (siehe metrics.Default)
+var (
+	fuseOps        = metrics.Default.NewCounter("splitfusex_fuse_ops_total", "FUSE Aufrufe je Operation", "op")
+	fuseOpDuration = metrics.Default.NewHistogram("splitfusex_fuse_op_duration_seconds", "Dauer der FUSE Aufrufe je Operation", metrics.DefBuckets, "op")
+	openFiles      = metrics.Default.NewGauge("splitfusex_fuse_open_files", "Geöffnete Dateien im Mount")
+	dbRefreshes    = metrics.Default.NewCounter("splitfusex_db_refresh_total", "Aufrufe von checkDbUpdate() je Status Code", "status")
+)
+
+// observeOp zählt einen FUSE Aufruf und misst seine Dauer. Aufruf am Anfang der Methode mit defer.
+func observeOp(op string, start time.Time) {
+	fuseOps.Inc(op)
+	fuseOpDuration.Observe(time.Since(start).Seconds(), op)
+}
+
+// observeDbRefresh zählt einen Aufruf von checkDbUpdate() mit seinem Status Code.
+func observeDbRefresh(status int) {
+	dbRefreshes.Inc(strconv.Itoa(status))
+}
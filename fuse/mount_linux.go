@@ -1,19 +1,49 @@
 package fuse
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"splitfuseX/backbone"
 	"splitfuseX/core"
+	"splitfuseX/fh"
+	"splitfuseX/logging"
 
 	"github.com/hanwen/go-fuse/fuse"
 	"github.com/hanwen/go-fuse/fuse/nodefs"
 	"github.com/hanwen/go-fuse/fuse/pathfs"
 )
 
+// mountRetries und mountRetryDelay bestimmen, wie oft (und mit welcher anfänglichen Wartezeit, die sich jedes Mal
+// verdoppelt) das erste Laden der DB wiederholt wird, wenn der Speicher nicht erreichbar ist (ca. 1 Minute).
+var (
+	mountRetries    = 6
+	mountRetryDelay = time.Second
+)
+
+// Server ist der FUSE Server eines Mounts (siehe MountNormal).
+type Server = fuse.Server
+
 // MountNormal greift auf Chunks zu und mountet die Klartextdateien
-func MountNormal(apiClient backbone.Client, dbFileName, keyFilePath, mountpoint string, debugFlag bool, test bool) *fuse.Server {
+// Mit mapOwner gehören alle Dateien dem mountenden Benutzer, andernfalls werden uid/gid aus der DB verwendet.
+// Mit diskCache werden gelesene Chunks auf der lokalen Festplatte zwischengespeichert (nil deaktiviert diese Funktion).
+// Die DB wird im Hintergrund alle refresh (min. 1 Sekunde, 0 bedeutet 10 Minuten) aktualisiert.
+// Mit offlineDb wird eine lokale Kopie der DB gespeichert, die verwendet wird, wenn der Speicher nicht erreichbar ist
+// ("" deaktiviert diese Funktion). Offline werden nur Chunks aus dem diskCache gelesen (sonst ENETUNREACH).
+// Mit pins können Dateien und Ordner angeheftet werden (siehe PinXAttr), ihre Chunks werden dann immer lokal gespeichert.
+// Gibt es noch keine DB, dann wird ein leerer Ordner gemountet, der sich nach dem ersten Upload der DB füllt.
+// Ohne test blockiert die Methode, bis der Ordner wieder ausgehängt wird.
+// Im Fehlerfall wird ein core.ExitError zurück gegeben mit 51 ... Speicher nicht erreichbar (FileList),
+// 52 ... DB kann nicht heruntergeladen werden, 53 ... DB kann nicht entschlüsselt werden (Keyfile?) oder 54 ... mount error!
+func MountNormal(apiClient backbone.Client, dbFileName, keyFilePath, mountpoint string, mapOwner bool, diskCache *fh.DiskCache, pins *fh.PinStore, offlineDb string, refresh time.Duration, debugFlag bool, test bool) (*Server, error) {
+
+	// Keyfile laden
+	keyFile, err := core.LoadKeyfile(keyFilePath)
+	if err != nil {
+		return nil, err
+	}
 
 	// OPTIONEN
 	opts := &fuse.MountOptions{
@@ -22,48 +52,120 @@ func MountNormal(apiClient backbone.Client, dbFileName, keyFilePath, mountpoint
 		MaxReadAhead:   131072,
 		Debug:          debugFlag,
 		AllowOther:     true,
-		SingleThreaded: true,
+		SingleThreaded: false, // SplitFs und SplitFile sind für gleichzeitige Aufrufe ausgelegt
 	}
 
 	// SplitFS erzeugen  (mit meinen Methoden)
 	fs := &SplitFs{
 		FileSystem: pathfs.NewDefaultFileSystem(),
 
-		debug:      debugFlag,
+		mapOwner:   mapOwner,
+		interval:   int64(refresh / time.Second),
 		dbFileName: dbFileName,
-		keyFile:    core.LoadKeyfile(keyFilePath),
+		keyFile:    keyFile,
 		apiClient:  apiClient,
+		diskCache:  diskCache,
+		offlineDb:  offlineDb,
+		pins:       pins,
 		mutex:      &sync.Mutex{},
 	}
 
-	// Alle Dateien von google Drive laden
-	debug(debugFlag, LOGINFO, "InitFileList()", nil)
-	fs.apiClient.InitFileList()
-
-	// checkDbUpdate lädt die DB von google drive herunter
-	debug(debugFlag, LOGINFO, "load DB", nil)
-	statusCode := fs.checkDbUpdate()
-	if statusCode != 0 {
-		panic(fmt.Errorf("checkDbUpdate() error %d", statusCode))
+	// Alle Dateien von google Drive laden und die DB herunterladen
+	logging.Info("load db", logging.Path(dbFileName))
+	if exitCode := fs.loadDb(); exitCode != 0 {
+		return nil, &core.ExitError{Code: exitCode, Err: fmt.Errorf("can't load db '%s': %s", dbFileName, loadDbErrors[exitCode])}
 	}
 
 	// Als Zwischenschicht, (dann ist alles ein wenig einfacher), kommt NewPathNodeFs zum Einsatz
-	nfs := pathfs.NewPathNodeFs(fs, nil)
+	// ClientInodes: Hardlinks werden anhand der Inode aus GetAttr() erkannt
+	nfs := pathfs.NewPathNodeFs(fs, &pathfs.PathNodeFsOptions{ClientInodes: true})
+	fs.nfs = nfs
 
 	// NewFileSystemConnector erzeugen
 	fsconn := nodefs.NewFileSystemConnector(nfs.Root(), nil)
 
+	// Lebensdauer des Mounts (endet mit dem Aushängen, im test nie)
+	fs.ctx, fs.cancel = context.WithCancel(context.Background())
+
 	// FUSE mit den Optionen mounten
-	debug(debugFlag, LOGINFO, "start FUSE server (mount)", nil)
+	logging.Info("start fuse server (mount)", logging.Path(mountpoint))
 	server, err := fuse.NewServer(fsconn.RawFS(), mountpoint, opts)
 	if err != nil {
-		panic(err)
+		fs.cancel()
+		return nil, &core.ExitError{Code: 54, Err: fmt.Errorf("can't mount '%s': %v", mountpoint, err)}
 	}
 
-	// loop (wartet auf EXIT)
+	// DB im Hintergrund aktualisieren
+	go fs.refreshDb(fs.ctx.Done())
+
+	// loop (wartet auf EXIT), danach werden die Aktualisierung und laufende Downloads beendet
 	if !test {
 		server.Serve()
+		fs.cancel()
+	}
+
+	return server, nil
+}
+
+// loadDbErrors beschreibt die Fehlercodes von loadDb().
+var loadDbErrors = map[int]string{
+	51: "storage not reachable",
+	52: "can't download db file",
+	53: "can't decrypt db file (wrong key file?)",
+}
+
+// loadDb initialisiert die FileList und lädt die DB. Ist der Speicher (noch) nicht erreichbar, dann wird die lokale
+// Kopie der DB verwendet (offline, siehe offlineDb) oder es wird mit Backoff erneut versucht (siehe mountRetries).
+// Gibt es noch keine DB, dann wird eine leere DB gesetzt. Beide werden beim nächsten Update (siehe refreshDb) ersetzt.
+// return:
+//
+//	 0 ... Erfolgreich (oder leere DB)
+//	51 ... FileList kann nicht geladen werden
+//	52 ... Fehler beim Download der DB
+//	53 ... Fehler beim Entschlüsseln der DB
+func (fs *SplitFs) loadDb() int {
+	delay := mountRetryDelay
+	exitCode := 0
+
+	for try := 0; try <= mountRetries; try++ {
+		// warten (backoff)
+		if try > 0 {
+			logging.Warn("loadDb(): retry", logging.F("delay", delay), logging.F("exitCode", exitCode))
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		// Intervall zurücksetzen, sonst liefert checkDbUpdate() nur 401
+		fs.mutex.Lock()
+		fs.lastDbUpdate = 0
+		fs.mutex.Unlock()
+
+		// checkDbUpdate lädt alle Dateien des Speichers und die DB herunter
+		switch fs.checkDbUpdate() {
+		case 0:
+			return 0
+		case 403:
+			// noch keine DB: leeren Root Ordner anzeigen
+			logging.Info("loadDb(): no db file, mount empty folder", logging.Path(fs.dbFileName))
+			fs.mutex.Lock()
+			fs.db = core.SfDb{".": core.SfFile{Type: core.TypeDir, Mtime: uint64(time.Now().Unix())}}
+			fs.mutex.Unlock()
+			return 0
+		case 402:
+			exitCode = 51
+			if fs.loadOfflineDb() {
+				return 0
+			}
+		case 405:
+			exitCode = 52
+			if fs.loadOfflineDb() {
+				return 0
+			}
+		default:
+			// 406: eventuell wird die DB gerade geschrieben
+			exitCode = 53
+		}
 	}
 
-	return server
+	return exitCode
 }
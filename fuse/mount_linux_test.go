@@ -0,0 +1,94 @@
+package fuse
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"splitfuseX/backbone"
+	"splitfuseX/backbone/local"
+	"splitfuseX/core"
+)
+
+// flakyClient schlägt bei den ersten fails Aufrufen von InitFileList fehl (Speicher nicht erreichbar)
+type flakyClient struct {
+	backbone.Client
+	fails int
+}
+
+func (c *flakyClient) InitFileListContext(ctx context.Context) error {
+	if c.fails > 0 {
+		c.fails--
+		return fmt.Errorf("storage unreachable")
+	}
+	return c.Client.InitFileListContext(ctx)
+}
+
+func (c *flakyClient) InitFileList() error {
+	return c.InitFileListContext(context.Background())
+}
+
+// Prüft das Mounten ohne DB (leerer Ordner) und die Wiederholungen beim Laden
+func TestLoadDb(t *testing.T) {
+	mountRetryDelay = time.Millisecond
+	defer func() { mountRetryDelay = time.Second }()
+
+	testFolder := path.Join(os.TempDir(), "TestLoadDb")
+	os.RemoveAll(testFolder)
+	os.Mkdir(testFolder, 0700)
+	defer os.RemoveAll(testFolder)
+
+	newFs := func(fails int) *SplitFs {
+		return &SplitFs{
+			interval:   1,
+			dbFileName: "index.db",
+			keyFile:    core.KeyFile{},
+			apiClient:  &flakyClient{Client: local.NewDiskClient(testFolder), fails: fails},
+			mutex:      &sync.Mutex{},
+		}
+	}
+
+	// Speicher dauerhaft nicht erreichbar
+	if exitCode := newFs(mountRetries + 1).loadDb(); exitCode != 51 {
+		t.Errorf("exit code should be 51: %d", exitCode)
+	}
+
+	// noch keine DB: leerer Root Ordner (nach zwei Fehlversuchen)
+	fs := newFs(2)
+	if exitCode := fs.loadDb(); exitCode != 0 {
+		t.Fatalf("exit code should be 0: %d", exitCode)
+	}
+	root, ok := fs.lookup(".")
+	if !ok || root.GetType() != core.TypeDir || len(root.FolderContent) != 0 {
+		t.Fatalf("empty root expected: %v %v", ok, root)
+	}
+
+	// nach dem ersten Upload wird die DB geladen
+	db := core.SfDb{
+		".": core.SfFile{Type: core.TypeDir, FolderContent: []core.FolderContent{{Name: "a", IsFile: true}}},
+		"a": core.SfFile{Type: core.TypeRegular, IsFile: true},
+	}
+	if err := core.DbToFile(path.Join(testFolder, "index.db"), fs.keyFile.DbKey(), db); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if s := fs.checkDbUpdate(); s != 0 {
+		t.Fatalf("can't load db: status is %d", s)
+	}
+	if _, ok := fs.lookup("a"); !ok {
+		t.Errorf("file not found after db upload")
+	}
+
+	// DB kann nicht entschlüsselt werden
+	if err := ioutil.WriteFile(path.Join(testFolder, "index.db"), []byte("no valid db"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if exitCode := newFs(0).loadDb(); exitCode != 53 {
+		t.Errorf("exit code should be 53: %d", exitCode)
+	}
+}
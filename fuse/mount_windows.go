@@ -1,8 +1,35 @@
 package fuse
 
-import "splitfuseX/backbone"
+import (
+	"errors"
+	"time"
+
+	"splitfuseX/backbone"
+	"splitfuseX/fh"
+)
+
+// errNoFuse wird unter windows von allen Funktionen zurück gegeben.
+var errNoFuse = errors.New("fuse only work with linux")
+
+// Server ist unter windows nur ein Platzhalter, damit MountNormal die gleiche Signatur wie unter linux hat.
+type Server struct{}
 
 // dummy mount für windows
-func MountNormal(apiClient backbone.Client, dbFileName, keyFilePath, mountpoint string, debug bool, test bool) {
-	panic("fuse only work with linux")
+func MountNormal(apiClient backbone.Client, dbFileName, keyFilePath, mountpoint string, mapOwner bool, diskCache *fh.DiskCache, pins *fh.PinStore, offlineDb string, refresh time.Duration, debug bool, test bool) (*Server, error) {
+	return nil, errNoFuse
+}
+
+// dummy pin für windows
+func Pin(p string) error {
+	return errNoFuse
+}
+
+// dummy unpin für windows
+func Unpin(p string) error {
+	return errNoFuse
+}
+
+// dummy pin status für windows
+func PinStatus(p string, list bool) (string, error) {
+	return "", errNoFuse
 }
@@ -0,0 +1,77 @@
+package fuse
+
+import (
+	"os"
+	"syscall"
+
+	"splitfuseX/core"
+	"splitfuseX/logging"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// errOffline wird bei Read() zurückgegeben, wenn der Speicher nicht erreichbar ist und ein Chunk nicht im diskCache liegt.
+// (ENETUNREACH statt EIO, damit der Benutzer sieht, dass die Datei nur offline nicht verfügbar ist)
+var errOffline = fuse.Status(syscall.ENETUNREACH)
+
+// isOffline gibt an, ob der Speicher beim letzten Update (siehe checkDbUpdate) nicht erreichbar war.
+func (fs *SplitFs) isOffline() bool {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.offline
+}
+
+// setOffline setzt den Offline-Status und meldet Änderungen.
+func (fs *SplitFs) setOffline(offline bool) {
+	fs.mutex.Lock()
+	changed := fs.offline != offline
+	fs.offline = offline
+	fs.mutex.Unlock()
+
+	if changed && offline {
+		logging.Warn("storage offline")
+	} else if changed {
+		logging.Info("storage online")
+	}
+}
+
+// saveOfflineDb speichert die DB (verschlüsselt) als lokale Kopie für den Offline-Betrieb (siehe offlineDb).
+// Die Datei wird zuerst unter einem temporären Namen geschrieben, damit nie eine halbe DB übrig bleibt.
+func (fs *SplitFs) saveOfflineDb(db core.SfDb) {
+	if fs.offlineDb == "" {
+		return
+	}
+
+	tmp := fs.offlineDb + ".tmp"
+	err := core.DbToFile(tmp, fs.keyFile.DbKey(), db)
+	if err == nil {
+		err = os.Rename(tmp, fs.offlineDb)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		logging.Error("saveOfflineDb(): can't write", logging.Path(fs.offlineDb), logging.Err(err))
+	}
+}
+
+// loadOfflineDb setzt die lokale Kopie der DB, wenn es eine gibt.
+// lastDbMtime bleibt dabei unverändert, damit die DB beim nächsten erfolgreichen Update (online) ersetzt wird.
+func (fs *SplitFs) loadOfflineDb() bool {
+	if fs.offlineDb == "" {
+		return false
+	}
+	if _, err := os.Stat(fs.offlineDb); err != nil {
+		return false // noch keine Kopie
+	}
+
+	db, err := core.DbFromFile(fs.offlineDb, fs.keyFile.DbKey())
+	if err != nil {
+		logging.Error("loadOfflineDb(): can't read", logging.Path(fs.offlineDb), logging.Err(err))
+		return false
+	}
+
+	logging.Info("loadOfflineDb(): use local copy", logging.Path(fs.offlineDb))
+	fs.mutex.Lock()
+	fs.db = db
+	fs.mutex.Unlock()
+	return true
+}
@@ -0,0 +1,114 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"splitfuseX/backbone/local"
+	"splitfuseX/core"
+	"splitfuseX/fh"
+)
+
+// Prüft den Offline-Betrieb: lokale Kopie der DB, Lesen aus dem diskCache und errOffline für fehlende Chunks
+func TestOffline(t *testing.T) {
+
+	// Klartext Dateien und Chunks anlegen
+	testFolder := path.Join(os.TempDir(), "TestOffline")
+	origFolder := path.Join(testFolder, "orig")
+	chunkFolder := path.Join(testFolder, "chunks")
+	os.RemoveAll(testFolder)
+	os.MkdirAll(origFolder, 0700)
+	os.MkdirAll(chunkFolder, 0700)
+	defer os.RemoveAll(testFolder)
+
+	files := map[string][]byte{"cached": bytes.Repeat([]byte("a"), 5000), "uncached": bytes.Repeat([]byte("b"), 5000)}
+	for name, b := range files {
+		if err := ioutil.WriteFile(path.Join(origFolder, name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keyFile := core.KeyFile{}
+	writeTestChunks(t, origFolder, chunkFolder, files)
+
+	diskCache, err := fh.NewDiskCache(path.Join(testFolder, "cache"), 100*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFs := func() *SplitFs {
+		return &SplitFs{
+			interval:   1,
+			dbFileName: "index.db",
+			keyFile:    keyFile,
+			apiClient:  local.NewDiskClient(chunkFolder),
+			diskCache:  diskCache,
+			offlineDb:  path.Join(testFolder, "offline.db"),
+			mutex:      &sync.Mutex{},
+		}
+	}
+	read := func(fs *SplitFs, name string) ([]byte, error) {
+		file, status := fs.Open(name, 0, nil)
+		if status != 0 {
+			return nil, fmt.Errorf("open status %v", status)
+		}
+		defer file.Release()
+		buf := make([]byte, 5000)
+		res, status := file.(*SplitFile).read(context.Background(), buf, 0)
+		if status != 0 {
+			return nil, fmt.Errorf("read status %v", status)
+		}
+		b, _ := res.Bytes(buf)
+		return b, nil
+	}
+
+	// online: DB laden (lokale Kopie wird gespeichert) und eine Datei in den Cache lesen
+	fs := newFs()
+	if exitCode := fs.loadDb(); exitCode != 0 {
+		t.Fatalf("exit code should be 0: %d", exitCode)
+	}
+	if fs.isOffline() {
+		t.Error("storage should be online")
+	}
+	if b, err := read(fs, "cached"); err != nil || !bytes.Equal(b, files["cached"]) {
+		t.Fatalf("online read failed: %v", err)
+	}
+
+	// Speicher nicht mehr erreichbar und neu mounten
+	if err := os.Rename(chunkFolder, chunkFolder+".away"); err != nil {
+		t.Fatal(err)
+	}
+	fs = newFs()
+	if exitCode := fs.loadDb(); exitCode != 0 {
+		t.Fatalf("offline db not used: %d", exitCode)
+	}
+	if !fs.isOffline() {
+		t.Error("storage should be offline")
+	}
+	if _, ok := fs.lookup("uncached"); !ok {
+		t.Fatal("file not found in offline db")
+	}
+
+	// Dateien im Cache können gelesen werden, alle anderen liefern errOffline
+	if b, err := read(fs, "cached"); err != nil || !bytes.Equal(b, files["cached"]) {
+		t.Errorf("offline read of cached file failed: %v", err)
+	}
+	if _, err := read(fs, "uncached"); err == nil || err.Error() != fmt.Sprintf("read status %v", errOffline) {
+		t.Errorf("offline read of uncached file should fail with errOffline: %v", err)
+	}
+
+	// ohne lokale Kopie wird nicht offline gemountet
+	fs = newFs()
+	fs.offlineDb = ""
+	mountRetries, mountRetryDelay = 0, 0
+	defer func() { mountRetries, mountRetryDelay = 6, time.Second }()
+	if exitCode := fs.loadDb(); exitCode != 51 {
+		t.Errorf("exit code should be 51: %d", exitCode)
+	}
+}
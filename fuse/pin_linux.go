@@ -0,0 +1,265 @@
+package fuse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"syscall"
+
+	"splitfuseX/core"
+	"splitfuseX/fh"
+	"splitfuseX/logging"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// Control-Attribute für das Anheften (pin) von Dateien und Ordnern im Mount (siehe SetXAttr, RemoveXAttr und GetXAttr).
+// Die Chunks angehefteter Pfade werden im PinStore gespeichert und von dort gelesen (auch offline).
+const (
+	PinXAttr     = "user.splitfusex.pin"  // setzen: pin, entfernen: unpin, lesen: Status des Pfads
+	PinListXAttr = "user.splitfusex.pins" // lesen: alle angehefteten Pfade mit Status
+)
+
+// pinCovers prüft, ob der Pfad name durch den angehefteten Pfad pinPath abgedeckt ist (Ordner gelten rekursiv).
+func pinCovers(pinPath, name string) bool {
+	return pinPath == "." || name == pinPath || strings.HasPrefix(name, pinPath+"/")
+}
+
+// pinnedChunks gibt alle Chunks der Dateien unter den angegebenen Pfaden zurück (chunkName -> Größe).
+func (fs *SplitFs) pinnedChunks(db core.SfDb, paths []string) map[string]int64 {
+	ret := make(map[string]int64)
+	for name, dbFile := range db {
+		if !dbFile.IsRegular() {
+			continue
+		}
+		covered := false
+		for _, p := range paths {
+			if pinCovers(p, name) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			continue
+		}
+		for i, chunkHash := range dbFile.FileChunks {
+			chunkName, _ := fs.chunks.derive(fs.keyFile, chunkHash)
+			ret[chunkName] = core.CalcChunkSize(i, dbFile.Size)
+		}
+	}
+	return ret
+}
+
+// pinName wandelt den Namen von pathfs in den Pfad der DB um.
+func pinName(name string) string {
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// pin heftet einen Pfad an. Passen nicht alle angehefteten Chunks in das Quota, dann wird ENOSPC zurückgegeben.
+func (fs *SplitFs) pin(name string) fuse.Status {
+	if fs.pins == nil {
+		return fuse.ENOSYS
+	}
+	name = pinName(name)
+	if _, ok := fs.lookup(name); !ok {
+		return fuse.ENOENT
+	}
+
+	// Quota prüfen (alle bisherigen und die neuen Chunks)
+	var needed int64
+	for _, size := range fs.pinnedChunks(fs.getDb(), append(fs.pins.Paths(), name)) {
+		needed += size
+	}
+	if needed > fs.pins.MaxSize() {
+		logging.Warn("pin(): quota exceeded", logging.Path(name), logging.F("needed", needed), logging.F("quota", fs.pins.MaxSize()))
+		return fuse.Status(syscall.ENOSPC)
+	}
+
+	if err := fs.pins.AddPath(name); err != nil {
+		logging.Error("pin(): can't save pins", logging.Path(name), logging.Err(err))
+		return fuse.EIO
+	}
+	logging.Info("pin()", logging.Path(name))
+
+	// Chunks im Hintergrund herunterladen
+	go fs.syncPins()
+	return fuse.OK
+}
+
+// unpin entfernt einen angehefteten Pfad. Nicht mehr benötigte Chunks werden aus dem PinStore gelöscht.
+func (fs *SplitFs) unpin(name string) fuse.Status {
+	if fs.pins == nil {
+		return fuse.ENOSYS
+	}
+	name = pinName(name)
+
+	ok, err := fs.pins.RemovePath(name)
+	if err != nil {
+		logging.Error("unpin(): can't save pins", logging.Path(name), logging.Err(err))
+		return fuse.EIO
+	}
+	if !ok {
+		return fuse.ENOATTR // nicht (direkt) angeheftet
+	}
+	logging.Info("unpin()", logging.Path(name))
+
+	go fs.syncPins()
+	return fuse.OK
+}
+
+// pinStatus gibt den Status eines angehefteten Pfads zurück, zB "pinned 3/4 chunks (12345/23456 bytes)".
+// Ist der Pfad (auch über einen Elternordner) nicht angeheftet, dann ist ok false.
+func (fs *SplitFs) pinStatus(name string) (status string, ok bool) {
+	name = pinName(name)
+	for _, p := range fs.pins.Paths() {
+		if pinCovers(p, name) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return "", false
+	}
+
+	// lokale Chunks zählen
+	var count, local int
+	var size, localSize int64
+	for chunkName, chunkSize := range fs.pinnedChunks(fs.getDb(), []string{name}) {
+		count++
+		size += chunkSize
+		if fs.pins.Contains(chunkName) {
+			local++
+			localSize += chunkSize
+		}
+	}
+	return fmt.Sprintf("pinned %d/%d chunks (%d/%d bytes)", local, count, localSize, size), true
+}
+
+// pinList gibt alle angehefteten Pfade mit ihrem Status (eine Zeile je Pfad) und die Belegung des Quotas zurück.
+func (fs *SplitFs) pinList() string {
+	var b strings.Builder
+	for _, p := range fs.pins.Paths() {
+		status, _ := fs.pinStatus(p)
+		fmt.Fprintf(&b, "%s\t%s\n", p, status)
+	}
+	fmt.Fprintf(&b, "quota\t%d/%d bytes\n", fs.pins.Size(), fs.pins.MaxSize())
+	return b.String()
+}
+
+// syncPins lädt alle fehlenden Chunks der angehefteten Pfade in den PinStore und löscht nicht mehr benötigte.
+// Wird sie aufgerufen, während sie bereits läuft, dann wird sie danach noch einmal ausgeführt.
+func (fs *SplitFs) syncPins() {
+	if fs.pins == nil {
+		return
+	}
+
+	// LOCK / UNLOCK
+	fs.mutex.Lock()
+	if fs.pinning {
+		fs.pinAgain = true
+		fs.mutex.Unlock()
+		return
+	}
+	fs.pinning = true
+	fs.mutex.Unlock()
+
+	for {
+		fs.downloadPins()
+
+		fs.mutex.Lock()
+		if !fs.pinAgain {
+			fs.pinning = false
+			fs.mutex.Unlock()
+			return
+		}
+		fs.pinAgain = false
+		fs.mutex.Unlock()
+	}
+}
+
+// downloadPins ist ein Durchlauf von syncPins().
+func (fs *SplitFs) downloadPins() {
+	wanted := fs.pinnedChunks(fs.getDb(), fs.pins.Paths())
+
+	// nicht mehr benötigte Chunks löschen
+	keep := make(map[string]bool, len(wanted))
+	for chunkName := range wanted {
+		keep[chunkName] = true
+	}
+	fs.pins.Retain(keep)
+
+	// fehlende Chunks sortiert herunterladen (damit die Reihenfolge nachvollziehbar ist)
+	names := make([]string, 0, len(wanted))
+	for chunkName := range wanted {
+		if !fs.pins.Contains(chunkName) {
+			names = append(names, chunkName)
+		}
+	}
+	sort.Strings(names)
+
+	// die Downloads enden mit dem Aushängen
+	ctx := fs.context()
+	for _, chunkName := range names {
+		if ctx.Err() != nil {
+			return
+		}
+		size := wanted[chunkName]
+		fileId, ok := fs.chunks.lookup(chunkName, size)
+		if !ok {
+			logging.Error("downloadPins(): can't find a fileId", logging.F("chunkName", chunkName))
+			continue
+		}
+
+		resp, err := fs.apiClient.ReadContext(ctx, fileId, 0, size)
+		if err == nil {
+			err = fs.pins.Put(chunkName, resp, size)
+			resp.Close()
+		}
+		if err == fh.ErrPinQuota {
+			logging.Warn("downloadPins(): quota exceeded", logging.Err(err))
+			return
+		}
+		if err != nil {
+			logging.Error("downloadPins(): can't download chunk", logging.F("chunkName", chunkName), logging.FileId(fileId), logging.Err(err))
+			if fs.isOffline() {
+				return
+			}
+			continue
+		}
+		logging.Debug("downloadPins(): chunk", logging.F("chunkName", chunkName), logging.F("size", size))
+	}
+}
+
+// Pin heftet eine Datei oder einen Ordner in einem gemounteten SplitFs an (siehe PinXAttr).
+func Pin(p string) error {
+	return syscall.Setxattr(p, PinXAttr, []byte{}, 0)
+}
+
+// Unpin entfernt eine angeheftete Datei oder einen Ordner in einem gemounteten SplitFs.
+func Unpin(p string) error {
+	return syscall.Removexattr(p, PinXAttr)
+}
+
+// PinStatus gibt den Status eines Pfads in einem gemounteten SplitFs zurück.
+// Mit list werden alle angehefteten Pfade des Mounts aufgelistet (siehe PinListXAttr), p ist dann ein beliebiger Pfad im Mount.
+func PinStatus(p string, list bool) (string, error) {
+	attr := PinXAttr
+	if list {
+		attr = PinListXAttr
+	}
+
+	// Größe abfragen, dann lesen
+	size, err := syscall.Getxattr(p, attr, nil)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Getxattr(p, attr, buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:size]), nil
+}
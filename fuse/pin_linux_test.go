@@ -0,0 +1,121 @@
+package fuse
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"splitfuseX/backbone/local"
+	"splitfuseX/core"
+	"splitfuseX/fh"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// Prüft pin, unpin, den Status, das Quota und das Lesen aus dem PinStore
+func TestPin(t *testing.T) {
+
+	// Klartext Dateien und Chunks anlegen
+	testFolder := path.Join(os.TempDir(), "TestPin")
+	origFolder := path.Join(testFolder, "orig")
+	chunkFolder := path.Join(testFolder, "chunks")
+	os.RemoveAll(testFolder)
+	os.MkdirAll(path.Join(origFolder, "dir"), 0700)
+	os.MkdirAll(chunkFolder, 0700)
+	defer os.RemoveAll(testFolder)
+
+	files := map[string][]byte{"dir/a": bytes.Repeat([]byte("a"), 5000), "dir/b": bytes.Repeat([]byte("b"), 5000), "c": bytes.Repeat([]byte("c"), 5000)}
+	for name, b := range files {
+		if err := ioutil.WriteFile(path.Join(origFolder, name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestChunks(t, origFolder, chunkFolder, files)
+
+	// Quota: nur dir/a und dir/b haben Platz
+	pins, err := fh.NewPinStore(path.Join(testFolder, "pins"), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &SplitFs{
+		interval:   1,
+		dbFileName: "index.db",
+		keyFile:    core.KeyFile{},
+		apiClient:  local.NewDiskClient(chunkFolder),
+		pins:       pins,
+		mutex:      &sync.Mutex{},
+	}
+	if exitCode := fs.loadDb(); exitCode != 0 {
+		t.Fatalf("exit code should be 0: %d", exitCode)
+	}
+
+	// warten, bis syncPins() fertig ist
+	waitForPins := func(size int64) {
+		for i := 0; i < 50; i++ {
+			if pins.Size() == size {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("pinned size should be %d: %d", size, pins.Size())
+	}
+
+	// Ordner anheften
+	if s := fs.SetXAttr("dir", PinXAttr, nil, 0, nil); s != fuse.OK {
+		t.Fatalf("pin failed: %v", s)
+	}
+	waitForPins(10000)
+	if status, s := fs.GetXAttr("dir/a", PinXAttr, nil); s != fuse.OK || string(status) != "pinned 1/1 chunks (5000/5000 bytes)" {
+		t.Errorf("wrong status: %q %v", status, s)
+	}
+	if _, s := fs.GetXAttr("c", PinXAttr, nil); s != fuse.ENOATTR {
+		t.Errorf("c should not be pinned: %v", s)
+	}
+	if list, _ := fs.GetXAttr("", PinListXAttr, nil); !strings.HasPrefix(string(list), "dir\tpinned 2/2 chunks") {
+		t.Errorf("wrong list: %q", list)
+	}
+
+	// Quota überschritten
+	if s := fs.SetXAttr("c", PinXAttr, nil, 0, nil); s != fuse.Status(syscall.ENOSPC) {
+		t.Errorf("pin should fail with ENOSPC: %v", s)
+	}
+
+	// angeheftete Dateien werden auch ohne Speicher gelesen
+	if err := os.Rename(chunkFolder, chunkFolder+".away"); err != nil {
+		t.Fatal(err)
+	}
+	file, s := fs.Open("dir/a", 0, nil)
+	if s != fuse.OK {
+		t.Fatalf("open failed: %v", s)
+	}
+	buf := make([]byte, 5000)
+	res, s := file.Read(buf, 0)
+	if s != fuse.OK {
+		t.Fatalf("read failed: %v", s)
+	}
+	if b, _ := res.Bytes(buf); !bytes.Equal(b, files["dir/a"]) {
+		t.Errorf("wrong data from pin store")
+	}
+	file.Release()
+	os.Rename(chunkFolder+".away", chunkFolder)
+
+	// unpin nur für direkt angeheftete Pfade, die Chunks werden gelöscht
+	if s := fs.RemoveXAttr("dir/a", PinXAttr, nil); s != fuse.ENOATTR {
+		t.Errorf("unpin of dir/a should fail: %v", s)
+	}
+	if s := fs.RemoveXAttr("dir", PinXAttr, nil); s != fuse.OK {
+		t.Errorf("unpin failed: %v", s)
+	}
+	waitForPins(0)
+
+	// alle anderen Attribute sind schreibgeschützt
+	if s := fs.SetXAttr("c", "user.test", nil, 0, nil); s != fuse.EPERM {
+		t.Errorf("set xattr should fail with EPERM: %v", s)
+	}
+}
@@ -0,0 +1,138 @@
+package fuse
+
+import (
+	"splitfuseX/core"
+	"splitfuseX/fh"
+	"splitfuseX/logging"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// readAhead ist der Zustand des Prefetchers einer SplitFile.
+// Erkennt er sequenzielles Lesen, dann lädt er im Hintergrund voraus. Das Fenster wächst dabei mit jedem
+// weiteren sequenziellen Read() (MinReadAhead bis MaxReadAhead). Bei einem Sprung beginnt er von vorne.
+type readAhead struct {
+	nextOffset int64 // hier beginnt das nächste Read(), wenn sequenziell gelesen wird
+	window     int64 // wie weit aktuell vorausgeladen wird (0 = kein sequenzielles Lesen erkannt)
+	prefetched int64 // bis hierher wurde bereits vorausgeladen (oder es läuft gerade)
+	running    bool  // läuft gerade ein prefetch im Hintergrund?
+}
+
+// readAhead wird bei jedem Read() aufgerufen und startet gegebenenfalls den Prefetcher.
+func (f *SplitFile) readAhead(offset, length int64) {
+
+	// LOCK / UNLOCK
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	ra := &f.ra
+
+	// Sequenziell? Der Kernel liest nicht immer exakt der Reihe nach, daher gibt es etwas Toleranz.
+	tolerance := length
+	if tolerance < fh.MinReadAhead {
+		tolerance = fh.MinReadAhead
+	}
+	if offset >= ra.nextOffset-tolerance && offset <= ra.nextOffset+tolerance {
+		if ra.window == 0 {
+			ra.window = fh.MinReadAhead
+		} else if ra.window < fh.MaxReadAhead {
+			ra.window *= 2
+			if ra.window > fh.MaxReadAhead {
+				ra.window = fh.MaxReadAhead
+			}
+		}
+		if offset+length > ra.nextOffset {
+			ra.nextOffset = offset + length
+		}
+	} else {
+		// Sprung -> von vorne beginnen
+		ra.window = 0
+		ra.prefetched = 0
+		ra.nextOffset = offset + length
+	}
+
+	// Wie weit soll vorausgeladen werden?
+	if ra.window == 0 || f.released || ra.running {
+		return
+	}
+	from := ra.nextOffset
+	if ra.prefetched > from {
+		from = ra.prefetched
+	}
+	to := ra.nextOffset + ra.window
+	if to > f.dbFile.Size {
+		to = f.dbFile.Size
+	}
+
+	// erst nachladen, wenn mindestens ein Schritt fehlt
+	if to-from < fh.ReadAheadStep && to < f.dbFile.Size {
+		return
+	}
+	if from >= to {
+		return
+	}
+
+	ra.running = true
+	ra.prefetched = to
+	go f.prefetch(from, to)
+}
+
+// prefetch lädt den Bereich [from, to) der Datei im Hintergrund in die Caches der FH.
+// Endet der Bereich in einem neuen Chunk, dann wird auch dieser schon geöffnet, bevor das Read() dort ankommt.
+func (f *SplitFile) prefetch(from, to int64) {
+	defer func() {
+		f.mutex.Lock()
+		f.ra.running = false
+		f.mutex.Unlock()
+	}()
+
+	for offset := from; offset < to; {
+		chunkOffset := offset % core.CHUNKSIZE
+		chunkNr := int((offset - chunkOffset) / core.CHUNKSIZE)
+		if chunkNr >= len(f.fileIds) {
+			return
+		}
+
+		// in Schritten laden, aber nie über das Ende eines Chunks hinaus
+		step := int64(fh.ReadAheadStep)
+		if step > to-offset {
+			step = to - offset
+		}
+		if step > core.CHUNKSIZE-chunkOffset {
+			step = core.CHUNKSIZE - chunkOffset
+		}
+
+		// Wurde inzwischen gesprungen, dann wird dieser prefetch nicht mehr benötigt
+		f.mutex.Lock()
+		abort := f.released || f.ra.window == 0
+		f.mutex.Unlock()
+		if abort {
+			return
+		}
+
+		// Angeheftete Chunks liegen bereits lokal
+		if f.pins != nil && f.pins.Contains(f.chunkNames[chunkNr]) {
+			offset += core.CHUNKSIZE - chunkOffset
+			continue
+		}
+
+		// Ist der Block bereits im DiskCache, dann muss er nicht geladen werden
+		if f.diskCache != nil {
+			blockNr := chunkOffset / fh.DiskCacheBlockSize
+			if f.diskCache.Contains(f.chunkNames[chunkNr], blockNr) {
+				offset += (blockNr+1)*fh.DiskCacheBlockSize - chunkOffset
+				continue
+			}
+		}
+
+		fhForChunk, status := f.fileHandler(chunkNr, chunkOffset)
+		if status != fuse.OK {
+			return
+		}
+		if _, err := fhForChunk.Download(chunkOffset, int(step)); err != nil {
+			logging.Debug("prefetch(): stop", logging.Chunk(chunkNr), logging.F("offset", chunkOffset), logging.Err(err))
+			return
+		}
+		offset += step
+	}
+}
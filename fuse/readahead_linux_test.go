@@ -0,0 +1,56 @@
+package fuse
+
+import (
+	"sync"
+	"testing"
+
+	"splitfuseX/core"
+	"splitfuseX/fh"
+)
+
+// Prüft, ob sequenzielles Lesen erkannt wird und das Fenster wächst
+func TestReadAheadWindow(t *testing.T) {
+	// ohne fileIds kehrt der prefetch sofort zurück
+	f := &SplitFile{
+		mutex:  &sync.Mutex{},
+		dbFile: core.SfFile{Size: 1024 * 1024 * 1024},
+	}
+	const l = 131072
+
+	// sequenziell: das Fenster wächst bis MaxReadAhead
+	var offset int64
+	for i := 0; i < 20; i++ {
+		f.readAhead(offset, l)
+		offset += l
+	}
+	f.mutex.Lock()
+	if f.ra.window != fh.MaxReadAhead {
+		t.Errorf("window should be MaxReadAhead: %d", f.ra.window)
+	}
+	f.mutex.Unlock()
+
+	// leicht vertauschte Reihenfolge ist noch sequenziell
+	f.readAhead(offset+l, l)
+	f.readAhead(offset, l)
+	f.mutex.Lock()
+	if f.ra.window != fh.MaxReadAhead || f.ra.nextOffset != offset+2*l {
+		t.Errorf("reordered reads should be sequential: window=%d, nextOffset=%d", f.ra.window, f.ra.nextOffset)
+	}
+	f.mutex.Unlock()
+
+	// Sprung: von vorne beginnen
+	f.readAhead(500*1024*1024, l)
+	f.mutex.Lock()
+	if f.ra.window != 0 {
+		t.Errorf("window should be reset after a jump: %d", f.ra.window)
+	}
+	f.mutex.Unlock()
+
+	// danach wieder sequenziell
+	f.readAhead(500*1024*1024+l, l)
+	f.mutex.Lock()
+	if f.ra.window != fh.MinReadAhead {
+		t.Errorf("window should be MinReadAhead: %d", f.ra.window)
+	}
+	f.mutex.Unlock()
+}
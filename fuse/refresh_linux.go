@@ -0,0 +1,58 @@
+package fuse
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"splitfuseX/logging"
+)
+
+// refreshInterval gibt das Intervall in Sekunden zurück, in dem die DB aktualisiert wird (default 10 min).
+func (fs *SplitFs) refreshInterval() int64 {
+	if fs.interval > 0 {
+		return fs.interval
+	}
+	return 10 * 60
+}
+
+// refreshDb aktualisiert die DB im Hintergrund, bis stop geschlossen wird.
+// Damit muss kein FUSE Aufruf (zB stat oder ls) auf den Download der DB warten.
+func (fs *SplitFs) refreshDb(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(fs.refreshInterval()) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			fs.checkDbUpdate()
+		}
+	}
+}
+
+// invalidate sorgt dafür, dass der Kernel die Attribute, Ordnerinhalte und Verzeichniseinträge
+// der übergebenen Pfade (aus der DB) neu abfragt.
+func (fs *SplitFs) invalidate(paths []string) {
+	if fs.nfs == nil {
+		return
+	}
+
+	for _, p := range paths {
+		// FIX: root
+		if p == "." {
+			fs.nfs.Notify("")
+			continue
+		}
+
+		// Attribute und Inhalt (bekannte Inode) bzw. Verzeichniseintrag (unbekannte Inode)
+		status := fs.nfs.Notify(p)
+
+		// Verzeichniseintrag im Elternordner (neue oder gelöschte Elemente)
+		dir, name := path.Split(p)
+		fs.nfs.EntryNotify(strings.TrimSuffix(dir, "/"), name)
+
+		logging.Debug("invalidate()", logging.Path(p), logging.F("status", status))
+	}
+}
@@ -1,12 +1,15 @@
 package fuse
 
 import (
-	"fmt"
+	"context"
 	"io"
+	"sync"
+	"time"
 
 	"splitfuseX/backbone"
 	"splitfuseX/core"
 	"splitfuseX/fh"
+	"splitfuseX/logging"
 
 	"github.com/hanwen/go-fuse/fuse"
 	"github.com/hanwen/go-fuse/fuse/nodefs"
@@ -17,33 +20,76 @@ import (
 type SplitFile struct {
 	nodefs.File
 
-	debug     bool
-	dbFile    core.SfFile
-	chunkKeys [][]byte
-	fileIds   []string
-	apiClient backbone.Client
-	fh        map[int]*fh.FileHandler
-	errRetrys int // Wie oft darf nach einem Lesefehler den FH neu initialisiert werden? (default 0)
+	dbFile     core.SfFile
+	chunkKeys  [][]byte
+	chunkNames []string
+	fileIds    []string
+	apiClient  backbone.Client
+	diskCache  *fh.DiskCache   // Cache auf der lokalen Festplatte (nil deaktiviert diese Funktion)
+	offline    func() bool     // ist der Speicher nicht erreichbar? (nil bedeutet immer online)
+	pins       *fh.PinStore    // Chunks angehefteter Dateien (nil deaktiviert diese Funktion)
+	ctx        context.Context // Lebensdauer des Mounts (siehe SplitFs.ctx, nil bedeutet unbegrenzt)
+
+	mutex    *sync.Mutex // schützt fh, released, readAhead und lastBlock (FUSE und Prefetcher greifen gleichzeitig zu)
+	fh       map[int]*fh.FileHandler
+	released bool // Release() wurde aufgerufen
+	ra       readAhead
+
+	// der zuletzt gelesene Block aus dem diskCache (damit er nicht für jedes Read() von der Festplatte kommt)
+	lastBlock      []byte
+	lastBlockChunk int
+	lastBlockNr    int64
 }
 
 // Release wird aufgerufen, wenn .close() auf die Datei im FUSE aufgerufen wird.
 // Damit müssen auch alle offenen internen FH geschlossen werden.
 func (f *SplitFile) Release() {
+
+	// LOCK / UNLOCK
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.released {
+		openFiles.Dec()
+	}
+	f.released = true // der Prefetcher darf keine neuen FH mehr öffnen
 	if f.fh != nil {
 		for k, v := range f.fh {
-			debug(f.debug, LOGINFO, fmt.Sprintf("Release(): close fh for chunk %d", k), nil)
+			logging.Debug("Release(): close fh", logging.Chunk(k))
 			v.CloseAndClear()
 			delete(f.fh, k)
 		}
 	}
+	f.lastBlock = nil
 }
 
 // Read liest bytes und gibt sie fürs FUSE zurück.
+// Wird sequenziell gelesen, dann werden die folgenden Bytes im Hintergrund vorausgeladen.
+// Ein Download, der länger als fh.ReadTimeout dauert oder beim Aushängen noch läuft, wird abgebrochen (EIO).
+// HINWEIS: nodefs gibt den Abbruch eines einzelnen Requests nicht weiter, daher gilt die Lebensdauer des Mounts.
 func (f *SplitFile) Read(buf []byte, offset int64) (fuse.ReadResult, fuse.Status) {
+	defer observeOp("read", time.Now())
+	f.readAhead(offset, int64(len(buf)))
+
+	ctx, cancel := context.WithTimeout(f.context(), fh.ReadTimeout)
+	defer cancel()
+	return f.read(ctx, buf, offset)
+}
+
+// context gibt die Lebensdauer des Mounts zurück (ohne Mount context.Background()).
+func (f *SplitFile) context() context.Context {
+	if f.ctx == nil {
+		return context.Background()
+	}
+	return f.ctx
+}
+
+// read liest bytes und gibt sie fürs FUSE zurück (ohne Vorausladen).
+func (f *SplitFile) read(ctx context.Context, buf []byte, offset int64) (fuse.ReadResult, fuse.Status) {
 
 	// leere Dateien sofort zurückgeben
 	if f.dbFile.Size < 1 {
-		debug(f.debug, LOGINFO, "Read(): read empty file", nil)
+		logging.Debug("Read(): read empty file")
 		return fuse.ReadResultData([]byte{}), fuse.OK
 	}
 
@@ -56,7 +102,7 @@ func (f *SplitFile) Read(buf []byte, offset int64) (fuse.ReadResult, fuse.Status
 	// Dabei kann es vorkommen, dass sich die ChunkNr erhöht und es dazu keine Daten in chunkKey und chunkName gibt.
 	if chunkNr >= len(f.chunkKeys) {
 		// würde panic: runtime error: index out of range auslösen
-		debug(f.debug, LOGINFO, "Read(): EOF FIX!", nil)
+		logging.Debug("Read(): EOF FIX!")
 		return fuse.ReadResultData([]byte{}), fuse.OK
 	}
 
@@ -64,75 +110,35 @@ func (f *SplitFile) Read(buf []byte, offset int64) (fuse.ReadResult, fuse.Status
 	chunkKey := f.chunkKeys[chunkNr]
 	fileId := f.fileIds[chunkNr]
 
-	// fh map initialisieren (wenn notwendig)
-	if f.fh == nil {
-		f.fh = make(map[int]*fh.FileHandler)
+	// Daten lesen (verschlüsselt): zuerst aus dem PinStore, dann aus dem diskCache oder direkt aus dem Speicher
+	var status fuse.Status
+	if b, ok := f.readPinned(chunkNr, chunkOffset, readLength); ok {
+		buf, status = b, fuse.OK
+	} else if f.diskCache != nil {
+		buf, status = f.readBlocks(ctx, chunkNr, chunkOffset, readLength)
+	} else {
+		buf, status = f.download(ctx, chunkNr, chunkOffset, readLength)
 	}
-
-	//----------------------------------------------------------------------------------------------------------------//
-	for {
-
-		// Ich muss nun auf den chunk zugreifen und brauche dafür ein fh
-		// Da diese Operation teuer ist, speichere ich alte filehandler und verwende sie wieder!
-		var openErr error
-		fhForChunk, ok := f.fh[chunkNr]
-
-		if !ok {
-			// gibt noch keinen FH für diesen Chunk
-			debug(f.debug, LOGINFO, fmt.Sprintf("Read(): new fh for chunk %d (fileId=%s)", chunkNr, fileId), nil)
-
-			// fhForChunk mit neuem FH beschreiben
-			fhForChunk, openErr = fh.NewFileHandler(f.apiClient, fileId, chunkOffset)
-			if openErr != nil {
-				debug(f.debug, LOGERROR, fmt.Sprintf("Read(): can't open new fh for chunk %d (fileId=%s)", chunkNr, fileId), openErr)
-				return fuse.ReadResultData([]byte{}), fuse.EIO
-			}
-
-			// fh speichern !!
-			f.fh[chunkNr] = fhForChunk
-		}
-
-		// Daten lesen
-		buf, openErr = fhForChunk.Download(chunkOffset, int(readLength))
-
-		// ERROR (mit Hoffnung)
-		// Nun kommt die Stelle, warum das in einer Schleife ist!
-		// Kommt es hier zu einem Fehler, dann initialisieren wir den FH neu.
-		// Das ist natürlich kein Allheilmittel und darf nicht all zu oft passieren!
-		if openErr != nil && openErr != io.EOF && f.errRetrys > 0 {
-			debug(f.debug, LOGERROR, fmt.Sprintf("Read(): retry (%d) read bytes [chunk=%d, fileId=%s, offset=%d, len=%d]", f.errRetrys, chunkNr, fileId, chunkOffset, readLength), openErr)
-			f.Release()
-
-			f.errRetrys--
-			continue
-		}
-
-		// ERROR (alles ist aus)
-		// Es gibt weiterhin einen Lesefehler!
-		// Da dieser Punkt im Code erreicht wurde, nehme ich an, dass alles hoffnungslos ist ...
-		if openErr != nil && openErr != io.EOF {
-			debug(f.debug, LOGERROR, fmt.Sprintf("Read(): can't read bytes [chunk=%d, fileId=%s, offset=%d, len=%d]", chunkNr, fileId, chunkOffset, readLength), openErr)
-			return fuse.ReadResultData([]byte{}), fuse.EIO
-		}
-
-		// ENDE erreicht -> also gab es keine Fehler
-		break // Schleife verlassen
+	if status != fuse.OK {
+		return fuse.ReadResultData([]byte{}), status
 	}
-	//----------------------------------------------------------------------------------------------------------------//
 
 	// die gelesenen Daten entschlüsseln
-	core.CryptBytes(buf, chunkOffset, chunkKey)
+	if err := core.CryptBytes(buf, chunkOffset, chunkKey); err != nil {
+		logging.Error("Read(): can't decrypt bytes", logging.Chunk(chunkNr), logging.Err(err))
+		return fuse.ReadResultData([]byte{}), fuse.EIO
+	}
 
 	// SONDERFALL: was ist, wenn knapp über einen chunk hinaus gelesen werden soll?
 	// dann muss eine weitere abfrage abgesetzt werden!
 	nextChunkBufferSize := chunkOffset + readLength - core.CHUNKSIZE
 	if nextChunkBufferSize > 0 {
-		debug(f.debug, LOGINFO, fmt.Sprintf("SPECIAL READ [chunk=%d, fileId=%s, offset=%d, len=%d, nextChunkRead=%d]", chunkNr, fileId, chunkOffset, readLength, nextChunkBufferSize), nil)
+		logging.Debug("Read(): special read", logging.Chunk(chunkNr), logging.FileId(fileId), logging.F("offset", chunkOffset), logging.F("length", readLength), logging.F("nextChunkRead", nextChunkBufferSize))
 
 		// einen Puffer anlegen für meine eigenen Read() Funktion
 		buf2 := make([]byte, nextChunkBufferSize)
 		// ReadResult abholen
-		res2, _ := f.Read(buf2, offset+readLength-nextChunkBufferSize)
+		res2, _ := f.read(ctx, buf2, offset+readLength-nextChunkBufferSize)
 		// []byte aus dem ReadResult extrahieren
 		buf2, _ = res2.Bytes(buf2)
 		// Göße des Puffers gegebenenfalls anpassen
@@ -147,3 +153,152 @@ func (f *SplitFile) Read(buf []byte, offset int64) (fuse.ReadResult, fuse.Status
 	// NORMALFALL
 	return fuse.ReadResultData(buf), fuse.OK
 }
+
+// readPinned liest Bytes (verschlüsselt) eines angehefteten Chunks aus dem PinStore.
+// Ist der Chunk nicht im PinStore, dann ist ok false.
+func (f *SplitFile) readPinned(chunkNr int, chunkOffset, readLength int64) ([]byte, bool) {
+	if f.pins == nil {
+		return nil, false
+	}
+	return f.pins.ReadAt(f.chunkNames[chunkNr], chunkOffset, int(readLength))
+}
+
+// download liest Bytes (verschlüsselt) eines Chunks über einen FileHandler.
+// Die FileHandler werden dabei je Chunk wiederverwendet. Der FileHandler kümmert sich selbst um Sprünge und Verbindungsfehler.
+// Wird der ctx beendet, dann wird der Download abgebrochen (EIO).
+func (f *SplitFile) download(ctx context.Context, chunkNr int, chunkOffset, readLength int64) ([]byte, fuse.Status) {
+	fileId := f.fileIds[chunkNr]
+
+	// offline ohne fileId (siehe SplitFs.Open)
+	if fileId == "" {
+		logging.Warn("Read(): chunk not available offline", logging.Chunk(chunkNr))
+		return nil, errOffline
+	}
+
+	// FH für den Chunk holen (oder öffnen)
+	fhForChunk, status := f.fileHandler(chunkNr, chunkOffset)
+	if status != fuse.OK {
+		return nil, f.offlineStatus(status)
+	}
+
+	// Daten lesen
+	buf, err := fhForChunk.DownloadContext(ctx, chunkOffset, int(readLength))
+	if err != nil && err != io.EOF {
+		logging.Error("Read(): can't read bytes", logging.Chunk(chunkNr), logging.FileId(fileId), logging.F("offset", chunkOffset), logging.F("length", readLength), logging.Err(err))
+		return nil, f.offlineStatus(fuse.EIO)
+	}
+	return buf, fuse.OK
+}
+
+// offlineStatus ersetzt EIO durch errOffline, wenn der Speicher nicht erreichbar ist.
+func (f *SplitFile) offlineStatus(status fuse.Status) fuse.Status {
+	if status == fuse.EIO && f.offline != nil && f.offline() {
+		return errOffline
+	}
+	return status
+}
+
+// fileHandler gibt den FH für einen Chunk zurück. Gibt es noch keinen, dann wird er für chunkOffset angelegt.
+// Die Verbindung öffnet erst der Download (ohne f.mutex und im ctx des Aufrufers).
+func (f *SplitFile) fileHandler(chunkNr int, chunkOffset int64) (*fh.FileHandler, fuse.Status) {
+	fileId := f.fileIds[chunkNr]
+
+	// LOCK / UNLOCK
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// Datei bereits geschlossen
+	if f.released {
+		return nil, fuse.EBADF
+	}
+
+	// fh map initialisieren (wenn notwendig)
+	if f.fh == nil {
+		f.fh = make(map[int]*fh.FileHandler)
+	}
+
+	// Ich muss nun auf den chunk zugreifen und brauche dafür ein fh
+	// Da diese Operation teuer ist, speichere ich alte filehandler und verwende sie wieder!
+	fhForChunk, ok := f.fh[chunkNr]
+	if !ok {
+		// gibt noch keinen FH für diesen Chunk
+		logging.Debug("Read(): new fh", logging.Chunk(chunkNr), logging.FileId(fileId))
+
+		// fhForChunk mit neuem FH beschreiben (die Verbindung wird erst beim Download geöffnet, nicht unter f.mutex)
+		fhForChunk = fh.NewFileHandler(f.context(), f.apiClient, fileId, chunkOffset)
+
+		// fh speichern !!
+		f.fh[chunkNr] = fhForChunk
+	}
+
+	return fhForChunk, fuse.OK
+}
+
+// readBlocks liest Bytes (verschlüsselt) eines Chunks über den diskCache.
+// Es werden immer ganze Blöcke gelesen. Fehlende Blöcke werden mit download() geladen und im diskCache gespeichert.
+func (f *SplitFile) readBlocks(ctx context.Context, chunkNr int, chunkOffset, readLength int64) ([]byte, fuse.Status) {
+	chunkName := f.chunkNames[chunkNr]
+	chunkSize := core.CalcChunkSize(chunkNr, f.dbFile.Size)
+
+	// Ende des Chunks beachten
+	end := chunkOffset + readLength
+	if end > chunkSize {
+		end = chunkSize
+	}
+	if chunkOffset >= end {
+		return []byte{}, fuse.OK
+	}
+
+	ret := make([]byte, 0, end-chunkOffset)
+	for blockNr := chunkOffset / fh.DiskCacheBlockSize; blockNr*fh.DiskCacheBlockSize < end; blockNr++ {
+		blockStart := blockNr * fh.DiskCacheBlockSize
+		blockLength := chunkSize - blockStart
+		if blockLength > fh.DiskCacheBlockSize {
+			blockLength = fh.DiskCacheBlockSize
+		}
+
+		// Block suchen: zuerst der zuletzt gelesene Block, dann der diskCache
+		f.mutex.Lock()
+		var b []byte
+		if f.lastBlock != nil && f.lastBlockChunk == chunkNr && f.lastBlockNr == blockNr {
+			b = f.lastBlock
+		}
+		f.mutex.Unlock()
+		if b == nil {
+			var ok bool
+			b, ok = f.diskCache.Get(chunkName, blockNr)
+			if !ok || int64(len(b)) != blockLength {
+				// nicht im Cache -> ganzen Block laden
+				logging.Debug("readBlocks(): cache miss", logging.Chunk(chunkNr), logging.F("block", blockNr))
+				var status fuse.Status
+				b, status = f.download(ctx, chunkNr, blockStart, blockLength)
+				if status != fuse.OK {
+					return nil, status
+				}
+				if int64(len(b)) == blockLength {
+					if err := f.diskCache.Put(chunkName, blockNr, b); err != nil {
+						logging.Error("readBlocks(): can't write block to cache", logging.Chunk(chunkNr), logging.F("block", blockNr), logging.Err(err))
+					}
+				}
+			}
+			f.mutex.Lock()
+			f.lastBlock, f.lastBlockChunk, f.lastBlockNr = b, chunkNr, blockNr
+			f.mutex.Unlock()
+		}
+
+		// den angeforderten Teil des Blocks übernehmen
+		from := chunkOffset - blockStart
+		if from < 0 {
+			from = 0
+		}
+		to := end - blockStart
+		if to > int64(len(b)) {
+			to = int64(len(b))
+		}
+		if from < to {
+			ret = append(ret, b[from:to]...)
+		}
+	}
+
+	return ret, fuse.OK
+}
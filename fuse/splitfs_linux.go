@@ -1,12 +1,17 @@
 package fuse
 
 import (
-	"fmt"
+	"context"
+	"os"
+	"sort"
 	"sync"
+	"syscall"
 	"time"
 
 	"splitfuseX/backbone"
 	"splitfuseX/core"
+	"splitfuseX/fh"
+	"splitfuseX/logging"
 
 	"github.com/hanwen/go-fuse/fuse"
 	"github.com/hanwen/go-fuse/fuse/nodefs"
@@ -17,59 +22,119 @@ import (
 type SplitFs struct {
 	pathfs.FileSystem
 
-	debug      bool            // zusätzliche Meldungen einblenden
-	interval   int64           // update interval in Sekunden  (bei 0 wird der Defaultwert genommen)
-	dbFileName string          // Der Name der Datenbank im ChunkFolder wie zB 'index.db' (siehe ApiClient.InitFileList())
-	keyFile    core.KeyFile    // Keyfile mit allen Schlüsseln
-	apiClient  backbone.Client // Verbindung zu Google Drive! ACHTUNG: .InitFileList() muss bereits passiert sein!!
+	mapOwner   bool               // alle Dateien gehören dem Benutzer, der das FUSE mountet (statt uid/gid aus der DB)
+	interval   int64              // update interval in Sekunden  (bei 0 wird der Defaultwert genommen)
+	dbFileName string             // Der Name der Datenbank im ChunkFolder wie zB 'index.db' (siehe ApiClient.InitFileList())
+	keyFile    core.KeyFile       // Keyfile mit allen Schlüsseln
+	apiClient  backbone.Client    // Verbindung zu Google Drive! ACHTUNG: .InitFileList() muss bereits passiert sein!!
+	diskCache  *fh.DiskCache      // Cache für Chunks auf der lokalen Festplatte (nil deaktiviert diese Funktion)
+	nfs        *pathfs.PathNodeFs // für die Invalidierung der Kernel Caches nach einem DB Update (nil deaktiviert diese Funktion)
+	chunks     chunkIndex         // fileIds und Schlüssel der Chunks (wird mit der FileList aktualisiert)
+	offlineDb  string             // lokale Kopie der DB für den Offline-Betrieb ("" deaktiviert diese Funktion)
+	pins       *fh.PinStore       // Chunks angehefteter Pfade (nil deaktiviert diese Funktion, siehe PinXAttr)
+	ctx        context.Context    // endet mit dem Aushängen und bricht laufende Downloads ab (nil bedeutet nie)
+	cancel     context.CancelFunc // beendet ctx (nach dem Aushängen)
+
+	initialized bool // wurde InitFileList() bereits erfolgreich ausgeführt? (nur in checkDbUpdate verwendet)
+
+	mutex        *sync.Mutex // schützt alle folgenden Felder (das FUSE läuft multi-threaded)
+	db           core.SfDb   // Datenbank (wird nie verändert, sondern bei einem Update komplett ersetzt)
+	lastDbUpdate int64       // wann wurde zuletzt checkDbUpdate() ausgeführt (Unix Time)
+	lastDbMtime  int64       // die mtime des zuletzt geladenen DB files (RFC 3339 date-time: 2018-08-03T12:03:30.407Z)
+	updating     bool        // läuft gerade ein checkDbUpdate()?
+	offline      bool        // war der Speicher beim letzten Update nicht erreichbar? (siehe isOffline)
+	pinning      bool        // läuft gerade ein syncPins()?
+	pinAgain     bool        // syncPins() muss danach noch einmal laufen
+}
+
+// getDb gibt die aktuelle Datenbank zurück.
+// Die map darf nur gelesen werden, bei einem Update wird sie komplett ersetzt.
+func (fs *SplitFs) getDb() core.SfDb {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.db
+}
 
-	mutex        *sync.Mutex
-	db           core.SfDb // Datenbank
-	lastDbUpdate int64     // wann wurde zuletzt checkDbUpdate() ausgeführt (Unix Time)
-	lastDbMtime  int64     // die mtime des zuletzt geladenen DB files (RFC 3339 date-time: 2018-08-03T12:03:30.407Z)
+// context gibt den ctx des Mounts zurück (ohne Mount, zB im test, endet er nie).
+func (fs *SplitFs) context() context.Context {
+	if fs.ctx == nil {
+		return context.Background()
+	}
+	return fs.ctx
 }
 
-// Diese Funktion wird von openDir getriggert.
+// lookup sucht ein Element in der aktuellen Datenbank.
+func (fs *SplitFs) lookup(name string) (core.SfFile, bool) {
+	dbFile, ok := fs.getDb()[name]
+	return dbFile, ok
+}
+
+// Diese Funktion wird im Hintergrund regelmäßig aufgerufen (siehe refreshDb).
 // Dabei stellt sie sicher, dass sie nur alle x sekunden einen Effekt hat
+// Während ein Update läuft, wird von allen anderen Aufrufen die bisherige DB verwendet (401).
 // return:
 //     0 ... Erfolgreich
 //   401 ... Intervall noch nicht erreicht
-//   402 ... Fehler beim Aktualisieren der FileList (ApiClient)
+//   402 ... Fehler beim Aktualisieren der FileList (ApiClient), der Speicher ist offline
 //   403 ... DBfile existiert nicht
 //   404 ... DBfile unverändert (alles bleibt gleich)
 //   405 ... Fehler beim Download der DB
 //   406 ... Fehler beim Entschlüsseln der DB (MAC)
-func (fs *SplitFs) checkDbUpdate() int {
+func (fs *SplitFs) checkDbUpdate() (status int) {
+	defer func() { observeDbRefresh(status) }()
+
 	// LOCK / UNLOCK
+	// Der Lock wird nur für die Prüfung des Intervalls und zum Setzen der neuen DB gehalten,
+	// damit andere FUSE Aufrufe nicht auf den Download warten müssen.
 	fs.mutex.Lock()
-	defer fs.mutex.Unlock()
 
 	// check interval
-	var interval int64 = 10 * 60 // 10 min
-	if fs.interval > 0 {
-		interval = fs.interval
-	}
+	interval := fs.refreshInterval()
 
 	// update nur alle 5 Minuten versuchen, egal ob erfolgreich oder nicht
 	now := time.Now().Unix()
 	thenPlus := fs.lastDbUpdate + interval
-	if thenPlus > now {
-		// nur alle x Sekunden erlauben
+	if thenPlus > now || fs.updating {
+		// nur alle x Sekunden erlauben (und nie gleichzeitig)
+		fs.mutex.Unlock()
 		return 401
 	}
 	fs.lastDbUpdate = now
+	fs.updating = true
+	lastDbMtime := fs.lastDbMtime
+	fs.mutex.Unlock()
 
-	// Funktionsaufruf melden (debug=true)
-	debug(fs.debug, LOGINFO, "checkDbUpdate(): update", nil)
+	defer func() {
+		fs.mutex.Lock()
+		fs.updating = false
+		fs.mutex.Unlock()
+	}()
+
+	// Funktionsaufruf melden
+	logging.Debug("checkDbUpdate(): update")
+	start := time.Now()
 
 	// Aktualisiere die Filelist
-	// ACHTUNG: Die Initialisierung muss daher bereits vorher passieren! (siehe ApiClient.InitFileList())
-	err := fs.apiClient.UpdateFileList()
+	// Beim ersten Mal (oder solange der Speicher nicht erreichbar war) muss sie initialisiert werden
+	// Alle Zugriffe auf den Speicher enden mit dem Aushängen (fs.ctx)
+	ctx := fs.context()
+	var err error
+	if fs.initialized {
+		err = fs.apiClient.UpdateFileListContext(ctx)
+	} else {
+		err = fs.apiClient.InitFileListContext(ctx)
+	}
 	if err != nil {
-		// Wie Fehler? Das ist eigentlich sehr schlecht! Das müsste immer gehen!
-		debug(fs.debug, LOGERROR, "checkDbUpdate(): can't update FileList", err)
+		// Speicher nicht erreichbar -> offline (die bisherige DB bleibt)
+		logging.Error("checkDbUpdate(): can't update FileList", logging.Err(err))
+		fs.setOffline(true)
 		return 402
 	}
+	fs.initialized = true
+	fs.setOffline(false)
+
+	// Index der Chunks aktualisieren (für Open)
+	fs.chunks.update(fs.apiClient.FileList())
 
 	// Neue DB suchen: Hat sich die Datei verändert?
 	// Nur aktualisierte Dateien laden
@@ -87,22 +152,22 @@ func (fs *SplitFs) checkDbUpdate() int {
 	// wurde etwas gefunden?
 	if newestFile.ModifiedTime <= 0 {
 		// db file nicht da? ka. einfach abbrechen
-		debug(fs.debug, LOGERROR, fmt.Sprintf("checkDbUpdate(): no db file found: '%s'", fs.dbFileName), nil)
+		logging.Warn("checkDbUpdate(): no db file found", logging.Path(fs.dbFileName))
 		return 403
 	}
 
 	// ist das DBfile unverändert?
-	if newestFile.ModifiedTime == fs.lastDbMtime {
+	if newestFile.ModifiedTime == lastDbMtime {
 		// Datei ist noch gleich
-		debug(fs.debug, LOGINFO, fmt.Sprintf("checkDbUpdate(): file unchanged: '%d'", fs.lastDbMtime), nil)
+		logging.Debug("checkDbUpdate(): file unchanged", logging.F("mtime", lastDbMtime))
 		return 404
 	}
 
 	// download (OPEN)
-	resp, err := fs.apiClient.Read(newestFile.Id, 0, 44222111) // 44222111 (ca 44mb) ist eine willkührliche Grenze für die DB
+	resp, err := fs.apiClient.ReadContext(ctx, newestFile.Id, 0, 44222111) // 44222111 (ca 44mb) ist eine willkührliche Grenze für die DB
 	if err != nil {
 		// db konnte nicht geladen werden
-		debug(fs.debug, LOGERROR, fmt.Sprintf("checkDbUpdate(): can't open db file: '%s'", fs.dbFileName), err)
+		logging.Error("checkDbUpdate(): can't open db file", logging.Path(fs.dbFileName), logging.Err(err))
 		return 405
 	}
 	defer resp.Close() // CLOSE
@@ -112,19 +177,35 @@ func (fs *SplitFs) checkDbUpdate() int {
 	if err != nil {
 		// fehler beim Entschlüsseln der datei
 		// eventuell wird die Datei gerade erst geschrieben
-		debug(fs.debug, LOGERROR, fmt.Sprintf("checkDbUpdate(): can't decrypt db file: '%s'", fs.dbFileName), err)
+		logging.Error("checkDbUpdate(): can't decrypt db file", logging.Path(fs.dbFileName), logging.Err(err))
 		return 406
 	}
 
 	// neue DB setzen
-	fs.db = newdb
-
-	// ACHTUNG: Nachdem die DB gesetzt wurde, muss nun auch fs.lastDbMtime gespeichert werden
+	// ACHTUNG: Gemeinsam mit der DB muss nun auch fs.lastDbMtime gespeichert werden
 	// Vorher darf das nicht passieren, weil sonst die DB nicht geladen wird im Fehlerfall
+	fs.mutex.Lock()
+	oldDb := fs.db
+	fs.db = newdb
 	fs.lastDbMtime = newestFile.ModifiedTime
+	fs.mutex.Unlock()
+
+	// Schlüssel von Chunks, die nicht mehr in der DB sind, vergessen
+	fs.chunks.prune(newdb)
 
-	// log schreiben (debug=true)
-	debug(fs.debug, LOGINFO, fmt.Sprintf("checkDbUpdate(): OK: %s, %d, %s", fs.dbFileName, fs.lastDbMtime, newestFile.Id), nil)
+	// lokale Kopie für den Offline-Betrieb
+	fs.saveOfflineDb(newdb)
+
+	// Chunks angehefteter Pfade aktualisieren (zB neue Dateien in angehefteten Ordnern)
+	go fs.syncPins()
+
+	// Kernel Caches für alle geänderten Elemente invalidieren (nicht beim ersten Laden)
+	if oldDb != nil {
+		fs.invalidate(core.ChangedPaths(oldDb, newdb))
+	}
+
+	// log schreiben
+	logging.Info("checkDbUpdate(): db loaded", logging.Path(fs.dbFileName), logging.F("mtime", newestFile.ModifiedTime), logging.FileId(newestFile.Id), logging.Duration(time.Since(start)))
 
 	// bei Erfolg, 0 zurück geben
 	return 0
@@ -132,18 +213,16 @@ func (fs *SplitFs) checkDbUpdate() int {
 
 // GetAttr gibt die File-Attribute für Einträge aus der DB zurück.
 func (fs *SplitFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
-	// db update triggern
-	fs.checkDbUpdate()
-
+	defer observeOp("getattr", time.Now())
 	// FIX: root
 	if name == "" {
 		name = "."
 	}
 
 	// Element in der DB suchen
-	dbFile, ok := fs.db[name]
+	dbFile, ok := fs.lookup(name)
 	if !ok {
-		debug(fs.debug, LOGERROR, "GetAttr(): file/folder not found in DB: "+name, nil)
+		logging.Debug("GetAttr(): file/folder not found in DB", logging.Path(name))
 		return nil, fuse.ENOENT
 	}
 
@@ -155,24 +234,165 @@ func (fs *SplitFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 	ret.Mtime = dbFile.Mtime
 	ret.Ctime = dbFile.Mtime
 	ret.Atime = dbFile.Mtime
+	ret.Mtimensec = dbFile.MtimeNsec
+	ret.Ctimensec = dbFile.MtimeNsec
+	ret.Atimensec = dbFile.MtimeNsec
+	if dbFile.HasPosixAttr() {
+		ret.Ctime = dbFile.Ctime
+		ret.Ctimensec = 0
+	}
 
-	// Mode (Datei/Ordner)
-	if dbFile.IsFile {
-		ret.Mode = fuse.S_IFREG | 0644
-		ret.Nlink = 1
+	// Besitzer
+	if fs.mapOwner {
+		ret.Uid = uint32(os.Getuid())
+		ret.Gid = uint32(os.Getgid())
 	} else {
-		ret.Mode = fuse.S_IFDIR | 0755
+		ret.Uid = dbFile.Uid
+		ret.Gid = dbFile.Gid
+	}
+
+	// Mode (Datei/Ordner/Link/...)
+	ret.Mode = fileMode(dbFile.GetType())
+	switch dbFile.GetType() {
+	case core.TypeDir:
+		ret.Mode |= 0755
 		ret.Nlink = uint32(len(dbFile.FolderContent))
+	case core.TypeSymlink:
+		ret.Mode |= 0777
+		ret.Size = uint64(len(dbFile.LinkTarget))
+		ret.Nlink = 1
+	default:
+		ret.Mode |= 0644
+		ret.Nlink = 1
+		ret.Rdev = uint32(dbFile.Rdev)
+	}
+
+	// Berechtigungen aus der DB (alte DBs haben keine, dann bleiben die Standardwerte)
+	if dbFile.HasPosixAttr() && dbFile.GetType() != core.TypeSymlink {
+		ret.Mode = fileMode(dbFile.GetType()) | dbFile.Mode
+	}
+
+	// Hardlinks teilen sich eine Inode (siehe PathNodeFsOptions.ClientInodes)
+	if dbFile.LinkGroup != 0 {
+		ret.Ino = dbFile.LinkGroup
+		ret.Nlink = dbFile.Nlink
 	}
 
 	return ret, fuse.OK
 }
 
+// fileMode gibt die Bits für den Dateityp (zB S_IFREG) zurück.
+func fileMode(t core.FileType) uint32 {
+	switch t {
+	case core.TypeDir:
+		return fuse.S_IFDIR
+	case core.TypeSymlink:
+		return fuse.S_IFLNK
+	case core.TypeFifo:
+		return fuse.S_IFIFO
+	case core.TypeSocket:
+		return syscall.S_IFSOCK
+	case core.TypeCharDevice:
+		return syscall.S_IFCHR
+	case core.TypeBlockDevice:
+		return syscall.S_IFBLK
+	default:
+		return fuse.S_IFREG
+	}
+}
+
+// GetXAttr gibt den Wert eines erweiterten Attributs zurück.
+// Die Control-Attribute PinXAttr und PinListXAttr liefern den Status angehefteter Pfade.
+func (fs *SplitFs) GetXAttr(name string, attribute string, context *fuse.Context) ([]byte, fuse.Status) {
+	defer observeOp("getxattr", time.Now())
+
+	// Control-Attribute
+	if fs.pins != nil && attribute == PinXAttr {
+		status, ok := fs.pinStatus(name)
+		if !ok {
+			return nil, fuse.ENOATTR
+		}
+		return []byte(status), fuse.OK
+	}
+	if fs.pins != nil && attribute == PinListXAttr {
+		return []byte(fs.pinList()), fuse.OK
+	}
+
+	// Element in der DB suchen
+	dbFile, ok := fs.lookup(name)
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+
+	// Attribut suchen
+	value, ok := dbFile.Xattrs[attribute]
+	if !ok {
+		return nil, fuse.ENOATTR
+	}
+
+	return value, fuse.OK
+}
+
+// ListXAttr gibt die Namen aller erweiterten Attribute zurück.
+func (fs *SplitFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
+	defer observeOp("listxattr", time.Now())
+
+	// Element in der DB suchen
+	dbFile, ok := fs.lookup(name)
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+
+	// Namen sortiert zurück geben
+	ret := make([]string, 0, len(dbFile.Xattrs))
+	for k := range dbFile.Xattrs {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+
+	return ret, fuse.OK
+}
+
+// SetXAttr ist nur für das Control-Attribut PinXAttr erlaubt (pin), alles andere ist schreibgeschützt.
+func (fs *SplitFs) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	defer observeOp("setxattr", time.Now())
+	if attr != PinXAttr {
+		return fuse.EPERM
+	}
+	return fs.pin(name)
+}
+
+// RemoveXAttr ist nur für das Control-Attribut PinXAttr erlaubt (unpin), alles andere ist schreibgeschützt.
+func (fs *SplitFs) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
+	defer observeOp("removexattr", time.Now())
+	if attr != PinXAttr {
+		return fuse.EPERM
+	}
+	return fs.unpin(name)
+}
+
+// Readlink gibt das Ziel eines symbolischen Links zurück.
+func (fs *SplitFs) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
+	defer observeOp("readlink", time.Now())
+
+	// Element in der DB suchen
+	dbFile, ok := fs.lookup(name)
+	if !ok {
+		logging.Debug("Readlink(): link not found in DB", logging.Path(name))
+		return "", fuse.ENOENT
+	}
+
+	// prüfen, ob es ein Link ist
+	if dbFile.GetType() != core.TypeSymlink {
+		return "", fuse.EINVAL
+	}
+
+	return dbFile.LinkTarget, fuse.OK
+}
+
 // OpenDir listet den Ordnerinhalt auf.
 func (fs *SplitFs) OpenDir(name string, context *fuse.Context) (c []fuse.DirEntry, code fuse.Status) {
-
-	// db update triggern
-	fs.checkDbUpdate()
+	defer observeOp("opendir", time.Now())
 
 	// FIX: root
 	if name == "" {
@@ -180,9 +400,9 @@ func (fs *SplitFs) OpenDir(name string, context *fuse.Context) (c []fuse.DirEntr
 	}
 
 	// Ordner in der DB suchen
-	dbFile, ok := fs.db[name]
+	dbFile, ok := fs.lookup(name)
 	if !ok {
-		debug(fs.debug, LOGERROR, "OpenDir(): folder not found in DB: "+name, nil)
+		logging.Debug("OpenDir(): folder not found in DB", logging.Path(name))
 		return nil, fuse.ENOENT
 	}
 
@@ -198,13 +418,9 @@ func (fs *SplitFs) OpenDir(name string, context *fuse.Context) (c []fuse.DirEntr
 	for _, v := range dbFile.FolderContent {
 		// Sub-Element erzeugen
 		tmp := fuse.DirEntry{Name: v.Name}
-		// Mode setzen (Datei oder Ordner)
+		// Mode setzen (Datei, Ordner, Link, ...)
 		// Nur das höchste Bit (eg. S_IFDIR) wird ausgewertet
-		if v.IsFile {
-			tmp.Mode = fuse.S_IFREG
-		} else {
-			tmp.Mode = fuse.S_IFDIR
-		}
+		tmp.Mode = fileMode(v.GetType())
 		// zu Liste hinzufügen
 		c = append(c, tmp)
 	}
@@ -214,66 +430,68 @@ func (fs *SplitFs) OpenDir(name string, context *fuse.Context) (c []fuse.DirEntr
 
 // Öffnet eine Datei und berechnet dabei alle Informationen, um auf die Chunks zuzugreifen.
 func (fs *SplitFs) Open(name string, flags uint32, context *fuse.Context) (file nodefs.File, code fuse.Status) {
+	defer observeOp("open", time.Now())
 
 	// Datei in der DB suchen
-	dbFile, ok := fs.db[name]
+	dbFile, ok := fs.lookup(name)
 	if !ok {
-		debug(fs.debug, LOGERROR, "Open(): file not found in DB: "+name, nil)
+		logging.Debug("Open(): file not found in DB", logging.Path(name))
 		return nil, fuse.ENOENT
 	}
 
-	// prüfen, ob es e eine Datei ist
-	if !dbFile.IsFile {
+	// prüfen, ob es e eine Datei ist (Links werden vom Kernel aufgelöst, spezielle Dateien haben keinen Inhalt)
+	if !dbFile.IsRegular() {
 		return nil, fuse.ENOENT
 	}
 
-	// filelist mit den chunks erstellen
-	filelist := fs.apiClient.FileList()
-
-	// chunkkeys und fileids ermitteln
+	// chunkkeys und fileids ermitteln (über den Index, siehe chunkIndex)
 	l := len(dbFile.FileChunks)
 	chunkKeys := make([][]byte, l)
+	chunkNames := make([]string, l)
 	fileIds := make([]string, l)
 	for i, chunkHash := range dbFile.FileChunks {
 
-		// berechnungen
-		chunkKeys[i] = fs.keyFile.CalcChunkKey(chunkHash[:])
-		chunkName := fmt.Sprintf("%x", fs.keyFile.CalcChunkName(chunkHash[:]))
+		// berechnungen (nur beim ersten Mal)
+		chunkName, chunkKey := fs.chunks.derive(fs.keyFile, chunkHash)
+		chunkKeys[i] = chunkKey
+		chunkNames[i] = chunkName
 		chunkSize := core.CalcChunkSize(i, dbFile.Size)
 
 		// fileId suchen
-		for fileId, obj := range filelist {
-			if obj.Name == chunkName && obj.Size == chunkSize {
-				fileIds[i] = fileId
-				break
-			}
-		}
+		fileId, ok := fs.chunks.lookup(chunkName, chunkSize)
 
-		// keine fileId ?
-		if fileIds[i] == "" {
-			debug(fs.debug, LOGERROR, "Open(): can't find a fileId: "+name, nil)
+		// keine fileId ? (offline können die Chunks noch im diskCache liegen, siehe SplitFile.download)
+		if !ok && !fs.isOffline() && !(fs.pins != nil && fs.pins.Contains(chunkName)) {
+			logging.Error("Open(): can't find a fileId", logging.Path(name), logging.Chunk(i))
 			return nil, fuse.ENOENT
 		}
+		fileIds[i] = fileId
 	}
 
 	// Datei zurückgeben
+	openFiles.Inc()
 	return &SplitFile{
-		File:      nodefs.NewDefaultFile(),
-		debug:     fs.debug,
-		dbFile:    dbFile,
-		chunkKeys: chunkKeys,
-		fileIds:   fileIds,
-		apiClient: fs.apiClient,
-		errRetrys: 3, // max. 3x darf der FH ungestraft einen Lesefehler verursachen
+		File:       nodefs.NewDefaultFile(),
+		dbFile:     dbFile,
+		chunkKeys:  chunkKeys,
+		chunkNames: chunkNames,
+		fileIds:    fileIds,
+		apiClient:  fs.apiClient,
+		diskCache:  fs.diskCache,
+		offline:    fs.isOffline,
+		pins:       fs.pins,
+		ctx:        fs.ctx,
+		mutex:      &sync.Mutex{},
 	}, fuse.OK
 }
 
 // Informationen für 'df -h'
 func (fs *SplitFs) StatFs(name string) *fuse.StatfsOut {
+	defer observeOp("statfs", time.Now())
 
 	// Summe aller Dateien berechnen
 	var sum uint64 = 0
-	for _, v := range fs.db {
+	for _, v := range fs.getDb() {
 		sum += uint64(v.Size)
 	}
 
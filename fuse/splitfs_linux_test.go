@@ -1,15 +1,24 @@
 package fuse
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"path"
 	"sync"
 	"testing"
 	"time"
 
+	"splitfuseX/backbone"
 	"splitfuseX/backbone/local"
 	"splitfuseX/core"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
 )
 
 // Prüft ob die CheckUpdate Funktion wie geplant funktioniert
@@ -34,7 +43,6 @@ func TestCheckDbUpdate(t *testing.T) {
 
 	// test filesystem
 	fs := SplitFs{
-		debug:      false, // DEBUG: setze das auf true, wenn du mehr sehen willst (DEBUG)
 		interval:   2,
 		dbFileName: "index.db",
 		keyFile:    core.KeyFile{},
@@ -121,3 +129,348 @@ func TestCheckDbUpdate(t *testing.T) {
 		t.Errorf("update test failed #4.2: status is %d", s)
 	}
 }
+
+// Prüft, ob gleichzeitige FUSE Aufrufe (Read, GetAttr, OpenDir) mit dem local Client funktionieren
+// HINWEIS: Am besten mit 'go test -race' ausführen
+func TestConcurrentRead(t *testing.T) {
+
+	// Klartext Dateien und Chunks anlegen
+	testFolder := path.Join(os.TempDir(), "TestConcurrentRead")
+	origFolder := path.Join(testFolder, "orig")
+	chunkFolder := path.Join(testFolder, "chunks")
+	os.RemoveAll(testFolder)
+	os.MkdirAll(origFolder, 0700)
+	os.MkdirAll(chunkFolder, 0700)
+
+	files := make(map[string][]byte)
+	r := rand.New(rand.NewSource(42))
+	for i, size := range []int{0, 1, 4096, 200000, 3*1024*1024 + 17} {
+		b := make([]byte, size)
+		r.Read(b)
+		name := fmt.Sprintf("file%d", i)
+		files[name] = b
+		if err := ioutil.WriteFile(path.Join(origFolder, name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keyFile := core.KeyFile{}
+	client := local.NewDiskClient(chunkFolder)
+	writeTestChunks(t, origFolder, chunkFolder, files)
+
+	// test filesystem
+	fs := &SplitFs{
+		interval:   1,
+		dbFileName: "index.db",
+		keyFile:    keyFile,
+		apiClient:  client,
+		mutex:      &sync.Mutex{},
+	}
+	if err := client.InitFileList(); err != nil {
+		t.Fatal(err)
+	}
+	if s := fs.checkDbUpdate(); s != 0 {
+		t.Fatalf("can't load db: status is %d", s)
+	}
+
+	// gleichzeitig lesen (auch gleichzeitig aus der selben geöffneten Datei)
+	wg := &sync.WaitGroup{}
+	for name, orig := range files {
+		file, status := fs.Open(name, 0, nil)
+		if !status.Ok() {
+			t.Fatalf("can't open %s: %v", name, status)
+		}
+		defer file.Release()
+
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(file nodefs.File, name string, orig []byte, seed int64) {
+				defer wg.Done()
+				r := rand.New(rand.NewSource(seed))
+				for i := 0; i < 50; i++ {
+					offset := int64(0)
+					if len(orig) > 0 {
+						offset = r.Int63n(int64(len(orig)))
+					}
+					buf := make([]byte, 1+r.Intn(131072))
+					res, status := file.Read(buf, offset)
+					if !status.Ok() {
+						t.Errorf("read %s failed: %v", name, status)
+						return
+					}
+					b, _ := res.Bytes(buf)
+					end := offset + int64(len(buf))
+					if end > int64(len(orig)) {
+						end = int64(len(orig))
+					}
+					if !bytes.Equal(b, orig[offset:end]) {
+						t.Errorf("%s: bytes not equal: offset=%d, len=%d", name, offset, len(buf))
+						return
+					}
+				}
+			}(file, name, orig, int64(g))
+		}
+	}
+
+	// gleichzeitig die Metadaten lesen (und die DB aktualisieren)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if _, status := fs.OpenDir("", nil); !status.Ok() {
+					t.Errorf("OpenDir failed: %v", status)
+				}
+				for name, orig := range files {
+					attr, status := fs.GetAttr(name, nil)
+					if !status.Ok() || attr.Size != uint64(len(orig)) {
+						t.Errorf("GetAttr %s failed: %v", name, status)
+					}
+				}
+				fs.checkDbUpdate()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Prüft, ob Downloads nach dem Aushängen abgebrochen werden (SplitFs.ctx)
+func TestReadAfterUnmount(t *testing.T) {
+	testFolder := t.TempDir()
+	origFolder := path.Join(testFolder, "orig")
+	chunkFolder := path.Join(testFolder, "chunks")
+	os.MkdirAll(origFolder, 0700)
+	os.MkdirAll(chunkFolder, 0700)
+	orig := []byte("hallo welt")
+	if err := ioutil.WriteFile(path.Join(origFolder, "a.txt"), orig, 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeTestChunks(t, origFolder, chunkFolder, map[string][]byte{"a.txt": orig})
+
+	client := local.NewDiskClient(chunkFolder)
+	fs := &SplitFs{
+		interval:   1,
+		dbFileName: "index.db",
+		keyFile:    core.KeyFile{},
+		apiClient:  client,
+		mutex:      &sync.Mutex{},
+	}
+	fs.ctx, fs.cancel = context.WithCancel(context.Background())
+	if err := client.InitFileList(); err != nil {
+		t.Fatal(err)
+	}
+	if s := fs.checkDbUpdate(); s != 0 {
+		t.Fatalf("can't load db: status is %d", s)
+	}
+
+	// gemountet
+	file, status := fs.Open("a.txt", 0, nil)
+	if !status.Ok() {
+		t.Fatalf("can't open: %v", status)
+	}
+	defer file.Release()
+	buf := make([]byte, len(orig))
+	if res, status := file.Read(buf, 0); !status.Ok() {
+		t.Fatalf("read failed: %v", status)
+	} else if b, _ := res.Bytes(buf); !bytes.Equal(b, orig) {
+		t.Fatalf("wrong data: %q", b)
+	}
+
+	// ausgehängt
+	fs.cancel()
+	other, status := fs.Open("a.txt", 0, nil)
+	if !status.Ok() {
+		t.Fatalf("can't open: %v", status)
+	}
+	defer other.Release()
+	if _, status := other.Read(buf, 0); status != fuse.EIO {
+		t.Errorf("read after unmount should fail with EIO: %v", status)
+	}
+}
+
+// slowOpen blockiert beim Öffnen eines Chunks, bis der ctx beendet wird (zB Wiederholungen mit langem backoff).
+// Die DB wird normal gelesen.
+type slowOpen struct {
+	backbone.Client
+	dbFileName string
+}
+
+func (c *slowOpen) ReadContext(ctx context.Context, fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	if c.Client.FileList()[fileId].Name == c.dbFileName {
+		return c.Client.ReadContext(ctx, fileId, offset, fileSize)
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *slowOpen) Read(fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	return c.ReadContext(context.Background(), fileId, offset, fileSize)
+}
+
+// Prüft, ob ein hängendes Öffnen weder Release blockiert noch das Aushängen überlebt
+func TestSlowOpen(t *testing.T) {
+	testFolder := t.TempDir()
+	origFolder := path.Join(testFolder, "orig")
+	chunkFolder := path.Join(testFolder, "chunks")
+	os.MkdirAll(origFolder, 0700)
+	os.MkdirAll(chunkFolder, 0700)
+	orig := []byte("hallo welt")
+	if err := ioutil.WriteFile(path.Join(origFolder, "a.txt"), orig, 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeTestChunks(t, origFolder, chunkFolder, map[string][]byte{"a.txt": orig})
+
+	client := &slowOpen{Client: local.NewDiskClient(chunkFolder), dbFileName: "index.db"}
+	fs := &SplitFs{
+		interval:   1,
+		dbFileName: "index.db",
+		keyFile:    core.KeyFile{},
+		apiClient:  client,
+		mutex:      &sync.Mutex{},
+	}
+	fs.ctx, fs.cancel = context.WithCancel(context.Background())
+	if err := client.InitFileList(); err != nil {
+		t.Fatal(err)
+	}
+	if s := fs.checkDbUpdate(); s != 0 {
+		t.Fatalf("can't load db: status is %d", s)
+	}
+
+	file, status := fs.Open("a.txt", 0, nil)
+	if !status.Ok() {
+		t.Fatalf("can't open: %v", status)
+	}
+	done := make(chan fuse.Status)
+	go func() {
+		_, status := file.Read(make([]byte, len(orig)), 0)
+		done <- status
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Release wartet nicht auf das Öffnen
+	released := make(chan struct{})
+	go func() {
+		file.Release()
+		close(released)
+	}()
+	select {
+	case <-released:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Release blocked by a slow open")
+	}
+
+	// spätestens das Aushängen beendet das Read
+	fs.cancel()
+	select {
+	case status := <-done:
+		if status.Ok() {
+			t.Errorf("read should fail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("read not canceled by unmount")
+	}
+}
+
+// Prüft, ob die DB im Hintergrund aktualisiert wird
+func TestRefreshDb(t *testing.T) {
+
+	testFolder := path.Join(os.TempDir(), "TestRefreshDb")
+	os.RemoveAll(testFolder)
+	os.Mkdir(testFolder, 0700)
+	dbPath := path.Join(testFolder, "index.db")
+
+	// test filesystem
+	fs := &SplitFs{
+		interval:   1,
+		dbFileName: "index.db",
+		keyFile:    core.KeyFile{},
+		apiClient:  local.NewDiskClient(testFolder),
+		mutex:      &sync.Mutex{},
+	}
+	if err := core.DbToFile(dbPath, fs.keyFile.DbKey(), core.SfDb{}); err != nil {
+		t.Fatal(err)
+	}
+	if s := fs.checkDbUpdate(); s != 0 {
+		t.Fatalf("can't load db: status is %d", s)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go fs.refreshDb(stop)
+
+	// neue DB schreiben (die mtime muss sich ändern)
+	time.Sleep(1100 * time.Millisecond)
+	if err := core.DbToFile(dbPath, fs.keyFile.DbKey(), core.SfDb{".": core.SfFile{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// warten, bis die DB im Hintergrund geladen wurde
+	for i := 0; i < 50; i++ {
+		if _, ok := fs.lookup("."); ok {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("db was not refreshed in the background")
+}
+
+// writeTestChunks scannt die Klartext Dateien (files) in origFolder und speichert Chunks und DB (index.db) im chunkFolder.
+func writeTestChunks(t *testing.T, origFolder, chunkFolder string, files map[string][]byte) core.SfDb {
+	keyFile := core.KeyFile{}
+	client := local.NewDiskClient(chunkFolder)
+	db, _, _, err := core.ScanFolder(origFolder, core.SfDb{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, dbFile := range db {
+		for i, chunk := range dbFile.FileChunks {
+			chunkName := fmt.Sprintf("%x", keyFile.CalcChunkName(chunk[:]))
+			data := files[name][int64(i)*core.CHUNKSIZE:]
+			_, err := client.Save(chunkName, core.CryptReader(bytes.NewReader(data), keyFile.CalcChunkKey(chunk[:])), core.CalcChunkSize(i, dbFile.Size))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := core.DbToFile(path.Join(chunkFolder, "index.db"), keyFile.DbKey(), db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// blockingClient blockiert UpdateFileList und InitFileList, bis der ctx beendet wird.
+type blockingClient struct {
+	backbone.Client
+}
+
+func (c blockingClient) InitFileListContext(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (c blockingClient) UpdateFileListContext(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCheckDbUpdateCanceled(t *testing.T) {
+	fs := &SplitFs{
+		dbFileName: "index.db",
+		apiClient:  blockingClient{Client: local.NewDiskClient(t.TempDir())},
+		mutex:      &sync.Mutex{},
+	}
+	fs.ctx, fs.cancel = context.WithCancel(context.Background())
+
+	// das Aushängen beendet ein laufendes Update
+	time.AfterFunc(50*time.Millisecond, fs.cancel)
+	done := make(chan int)
+	go func() { done <- fs.checkDbUpdate() }()
+	select {
+	case s := <-done:
+		if s != 402 {
+			t.Fatalf("status is %d", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("update was not canceled")
+	}
+}
@@ -0,0 +1,201 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level gibt die Wichtigkeit einer Meldung an.
+type Level int
+
+const (
+	DEBUG Level = iota // Details für die Fehlersuche (zB jeder Cache-Miss)
+	INFO               // normale Meldungen (zB DB geladen)
+	WARN               // Probleme, die automatisch behandelt werden (zB Wiederholungen)
+	ERROR              // Fehler
+)
+
+// String gibt den Namen des Levels zurück.
+func (l Level) String() string {
+	switch l {
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// ParseLevel wandelt einen Namen (debug, info, warn oder error) in ein Level um.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return DEBUG, nil
+	case "info":
+		return INFO, nil
+	case "warn", "warning":
+		return WARN, nil
+	case "error":
+		return ERROR, nil
+	}
+	return INFO, fmt.Errorf("unknown log level '%s'", s)
+}
+
+// Field ist ein strukturiertes Feld einer Meldung (key=value).
+// Felder ohne Wert (nil) werden nicht ausgegeben.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F erzeugt ein beliebiges Feld.
+func F(key string, value interface{}) Field { return Field{Key: key, Value: value} }
+
+// Path ist der Pfad einer Datei oder eines Ordners (relativ zum Root).
+func Path(p string) Field { return Field{Key: "path", Value: p} }
+
+// Chunk ist die Nummer eines Chunks innerhalb einer Datei.
+func Chunk(nr int) Field { return Field{Key: "chunk", Value: nr} }
+
+// FileId ist die fileId einer Datei im Speicher.
+func FileId(id string) Field { return Field{Key: "fileId", Value: id} }
+
+// Backbone ist der Name des Speichers (zB drive oder local).
+func Backbone(name string) Field { return Field{Key: "backbone", Value: name} }
+
+// Duration ist die Dauer einer Operation.
+func Duration(d time.Duration) Field { return Field{Key: "duration", Value: d} }
+
+// Err ist ein Fehler (nil wird nicht ausgegeben).
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error"}
+	}
+	return Field{Key: "error", Value: err}
+}
+
+// Entry ist eine Meldung, die an die Sinks übergeben wird.
+type Entry struct {
+	Time   time.Time
+	Level  Level
+	Msg    string
+	Fields []Field
+}
+
+// Sink schreibt Meldungen (zB auf stderr, in eine Datei oder ins syslog).
+// Write wird nie gleichzeitig aufgerufen.
+type Sink interface {
+	Write(e *Entry) error
+}
+
+// Logger schreibt Meldungen ab einem Level an alle Sinks.
+// Mit With() erzeugte Logger teilen sich Level und Sinks mit ihrem Ursprung.
+type Logger struct {
+	core   *loggerCore
+	fields []Field // Felder, die bei jeder Meldung angehängt werden
+}
+
+// loggerCore ist der gemeinsame Teil aller Logger, die mit With() voneinander abgeleitet wurden.
+type loggerCore struct {
+	mutex *sync.Mutex // schützt level und sinks, Meldungen werden nie vermischt
+	level Level
+	sinks []Sink
+}
+
+// New erzeugt einen Logger, der alle Meldungen ab level an die sinks schreibt.
+func New(level Level, sinks ...Sink) *Logger {
+	return &Logger{core: &loggerCore{mutex: &sync.Mutex{}, level: level, sinks: sinks}}
+}
+
+// With gibt einen Logger zurück, der die Felder an jede Meldung anhängt.
+func (l *Logger) With(fields ...Field) *Logger {
+	return &Logger{core: l.core, fields: append(append([]Field(nil), l.fields...), fields...)}
+}
+
+// SetLevel setzt das minimale Level der Meldungen.
+func (l *Logger) SetLevel(level Level) {
+	l.core.mutex.Lock()
+	l.core.level = level
+	l.core.mutex.Unlock()
+}
+
+// Enabled prüft, ob Meldungen mit diesem Level ausgegeben werden.
+// Damit können teure Berechnungen für Meldungen übersprungen werden.
+func (l *Logger) Enabled(level Level) bool {
+	l.core.mutex.Lock()
+	defer l.core.mutex.Unlock()
+	return level >= l.core.level
+}
+
+// Log schreibt eine Meldung. Fehler der Sinks werden ignoriert (es gibt keinen Ort, an dem sie gemeldet werden könnten).
+func (l *Logger) Log(level Level, msg string, fields ...Field) {
+	// LOCK / UNLOCK
+	l.core.mutex.Lock()
+	defer l.core.mutex.Unlock()
+
+	if level < l.core.level {
+		return
+	}
+	e := &Entry{Time: time.Now(), Level: level, Msg: msg}
+	for _, f := range append(append([]Field(nil), l.fields...), fields...) {
+		if f.Value != nil {
+			e.Fields = append(e.Fields, f)
+		}
+	}
+	for _, s := range l.core.sinks {
+		s.Write(e)
+	}
+}
+
+// Debug schreibt eine Meldung mit dem Level DEBUG.
+func (l *Logger) Debug(msg string, fields ...Field) { l.Log(DEBUG, msg, fields...) }
+
+// Info schreibt eine Meldung mit dem Level INFO.
+func (l *Logger) Info(msg string, fields ...Field) { l.Log(INFO, msg, fields...) }
+
+// Warn schreibt eine Meldung mit dem Level WARN.
+func (l *Logger) Warn(msg string, fields ...Field) { l.Log(WARN, msg, fields...) }
+
+// Error schreibt eine Meldung mit dem Level ERROR.
+func (l *Logger) Error(msg string, fields ...Field) { l.Log(ERROR, msg, fields...) }
+
+// std ist der Logger, der von allen Paketen verwendet wird (siehe SetDefault).
+var (
+	stdMutex = &sync.Mutex{}
+	std      = New(INFO, NewWriterSink(stderr))
+)
+
+// Default gibt den Logger zurück, der von allen Paketen verwendet wird (INFO auf stderr, siehe Setup).
+func Default() *Logger {
+	stdMutex.Lock()
+	defer stdMutex.Unlock()
+	return std
+}
+
+// SetDefault ersetzt den Logger, der von allen Paketen verwendet wird.
+func SetDefault(l *Logger) {
+	stdMutex.Lock()
+	std = l
+	stdMutex.Unlock()
+}
+
+// With gibt einen vom Default Logger abgeleiteten Logger mit den Feldern zurück.
+func With(fields ...Field) *Logger { return Default().With(fields...) }
+
+// Debug schreibt eine Meldung mit dem Level DEBUG an den Default Logger.
+func Debug(msg string, fields ...Field) { Default().Log(DEBUG, msg, fields...) }
+
+// Info schreibt eine Meldung mit dem Level INFO an den Default Logger.
+func Info(msg string, fields ...Field) { Default().Log(INFO, msg, fields...) }
+
+// Warn schreibt eine Meldung mit dem Level WARN an den Default Logger.
+func Warn(msg string, fields ...Field) { Default().Log(WARN, msg, fields...) }
+
+// Error schreibt eine Meldung mit dem Level ERROR an den Default Logger.
+func Error(msg string, fields ...Field) { Default().Log(ERROR, msg, fields...) }
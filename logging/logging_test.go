@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevelFilter(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(WARN, NewJournalSink(&buf))
+
+	l.Debug("debug")
+	l.Info("info")
+	l.Warn("warn")
+	l.Error("error")
+
+	if got, want := buf.String(), "<4>warn\n<3>error\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// Level nachträglich ändern (gilt auch für abgeleitete Logger)
+	buf.Reset()
+	l.With(Path("a")).SetLevel(DEBUG)
+	if !l.Enabled(DEBUG) {
+		t.Fatal("DEBUG should be enabled")
+	}
+	l.Debug("debug")
+	if got, want := buf.String(), "<7>debug\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(DEBUG, NewJournalSink(&buf)).With(Backbone("drive"))
+
+	l.Info("read", Path("a b/c.txt"), Chunk(3), FileId("xyz"), Duration(1500*time.Millisecond), Err(nil))
+	l.Error("failed", F("empty", ""), Err(errors.New(`bad "thing"`)))
+
+	want := "<6>read backbone=drive path=\"a b/c.txt\" chunk=3 fileId=xyz duration=1.5s\n" +
+		"<3>failed backbone=drive empty=\"\" error=\"bad \\\"thing\\\"\"\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(INFO, NewWriterSink(&buf))
+	l.Warn("retry", F("n", 2))
+
+	line := buf.String()
+	if !strings.HasSuffix(line, " WARN  retry n=2\n") {
+		t.Fatalf("unexpected line %q", line)
+	}
+	if _, err := time.Parse("2006-01-02T15:04:05.000Z07:00", strings.SplitN(line, " ", 2)[0]); err != nil {
+		t.Fatalf("bad timestamp in %q: %v", line, err)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"debug": DEBUG, "INFO": INFO, "warn": WARN, "warning": WARN, "Error": ERROR} {
+		got, err := ParseLevel(s)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) should fail")
+	}
+}
+
+func TestSetup(t *testing.T) {
+	old := Default()
+	defer SetDefault(old)
+
+	if err := Setup("info", []string{"nope"}); err == nil {
+		t.Fatal("unknown sink should fail")
+	}
+	if err := Setup("error", []string{"stderr"}); err != nil {
+		t.Fatal(err)
+	}
+	if Default().Enabled(WARN) || !Default().Enabled(ERROR) {
+		t.Fatal("level not applied")
+	}
+}
@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stderr ist das Ziel des Default Loggers (eine Variable, damit Tests es ersetzen können).
+var stderr io.Writer = os.Stderr
+
+// writerSink schreibt Meldungen als Textzeilen, zB:
+// 2006-01-02T15:04:05.000+01:00 INFO  db loaded path=index.db duration=1.2s
+type writerSink struct {
+	w io.Writer
+}
+
+// NewWriterSink erzeugt einen Sink, der Meldungen als Textzeilen (mit Zeit) schreibt.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Write(e *Entry) error {
+	_, err := fmt.Fprintf(s.w, "%s %-5s %s%s\n", e.Time.Format("2006-01-02T15:04:05.000Z07:00"), e.Level, e.Msg, formatFields(e.Fields))
+	return err
+}
+
+// journalSink schreibt Meldungen mit einem Prefix für die Priorität (zB <3>), den systemd-journald
+// auf stdout/stderr erkennt. Die Zeit wird vom journald selbst gesetzt.
+type journalSink struct {
+	w io.Writer
+}
+
+// NewJournalSink erzeugt einen Sink für Dienste, deren Ausgabe von systemd-journald gelesen wird.
+func NewJournalSink(w io.Writer) Sink {
+	return &journalSink{w: w}
+}
+
+func (s *journalSink) Write(e *Entry) error {
+	_, err := fmt.Fprintf(s.w, "<%d>%s%s\n", syslogPriority(e.Level), e.Msg, formatFields(e.Fields))
+	return err
+}
+
+// syslogPriority gibt die Priorität eines Levels nach RFC 5424 zurück.
+func syslogPriority(l Level) int {
+	switch l {
+	case DEBUG:
+		return 7
+	case INFO:
+		return 6
+	case WARN:
+		return 4
+	}
+	return 3
+}
+
+// NewFileSink öffnet (oder erstellt) eine Datei, an die Meldungen als Textzeilen angehängt werden.
+func NewFileSink(path string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterSink(f), nil
+}
+
+// Open erzeugt einen Sink aus einer Beschreibung:
+//
+//	stderr         Textzeilen auf stderr
+//	file:<pfad>    Textzeilen in einer Datei
+//	syslog         lokales syslog (nur Linux)
+//	journald       stderr mit Prioritäten für systemd-journald
+func Open(spec string) (Sink, error) {
+	switch {
+	case spec == "stderr":
+		return NewWriterSink(os.Stderr), nil
+	case strings.HasPrefix(spec, "file:"):
+		return NewFileSink(strings.TrimPrefix(spec, "file:"))
+	case spec == "syslog":
+		return NewSyslogSink("splitfuseX")
+	case spec == "journald":
+		return NewJournalSink(os.Stderr), nil
+	}
+	return nil, fmt.Errorf("unknown log sink '%s'", spec)
+}
+
+// Setup ersetzt den Default Logger durch einen Logger mit dem Level und den Sinks (siehe Open).
+func Setup(level string, specs []string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	sinks := make([]Sink, 0, len(specs))
+	for _, spec := range specs {
+		s, err := Open(spec)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, s)
+	}
+	SetDefault(New(lvl, sinks...))
+	return nil
+}
+
+// formatFields gibt die Felder im Format " key=value key2=value2" aus.
+// Werte mit Leerzeichen, Anführungszeichen oder = werden in Anführungszeichen gesetzt.
+func formatFields(fields []Field) string {
+	var b strings.Builder
+	for _, f := range fields {
+		var v string
+		switch value := f.Value.(type) {
+		case string:
+			v = value
+		case error:
+			v = value.Error()
+		case time.Duration:
+			v = value.String()
+		default:
+			v = fmt.Sprint(value)
+		}
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, " %s=%s", f.Key, v)
+	}
+	return b.String()
+}
@@ -0,0 +1,33 @@
+package logging
+
+import (
+	"log/syslog"
+)
+
+// syslogSink schreibt Meldungen ins lokale syslog.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink verbindet sich mit dem lokalen syslog.
+// Ist das syslog nicht verfügbar (zB in Containern), dann wird ein Fehler zurückgegeben.
+func NewSyslogSink(tag string) (Sink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Write(e *Entry) error {
+	msg := e.Msg + formatFields(e.Fields)
+	switch e.Level {
+	case DEBUG:
+		return s.w.Debug(msg)
+	case INFO:
+		return s.w.Info(msg)
+	case WARN:
+		return s.w.Warning(msg)
+	}
+	return s.w.Err(msg)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package logging
+
+import "errors"
+
+// NewSyslogSink: Ohne Linux gibt es kein syslog.
+func NewSyslogSink(tag string) (Sink, error) {
+	return nil, errors.New("syslog is only available on linux")
+}
@@ -1,17 +1,30 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"path"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"splitfuseX/backbone"
 	"splitfuseX/backbone/drive"
 	"splitfuseX/backbone/local"
+	"splitfuseX/backbone/middleware"
+	"splitfuseX/backbone/mirror"
+	"splitfuseX/backbone/throttle"
 	"splitfuseX/core"
+	"splitfuseX/fh"
 	"splitfuseX/fuse"
+	"splitfuseX/logging"
+	"splitfuseX/metrics"
+	"splitfuseX/serve"
+	"splitfuseX/splitfuse"
+	"splitfuseX/watcher"
 
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
@@ -19,8 +32,20 @@ import (
 )
 
 var (
-	app   = kingpin.New(filepath.Base(os.Args[0]), "Ein Kommandozeilen-Tool zum Verwalten und Mounten von SplitFUSE")
-	debug = app.Flag("debug", "Aktiviert den Debug-Mode für FUSE, SCAN oder UPLOAD").Bool()
+	app      = kingpin.New(filepath.Base(os.Args[0]), "Ein Kommandozeilen-Tool zum Verwalten und Mounten von SplitFUSE")
+	debug    = app.Flag("debug", "Aktiviert den Debug-Mode für FUSE und setzt --loglevel auf debug").Bool()
+	logLevel = app.Flag("loglevel", "Minimales Level der Meldungen: debug, info, warn oder error").Default("info").Enum("debug", "info", "warn", "error")
+	logSinks = app.Flag("log", "Ziel der Meldungen: stderr, file:<pfad>, syslog oder journald (mehrfach möglich)").Default("stderr").Strings()
+
+	bwLimit = app.Flag("bwlimit", "Max. Bandbreite (Bytes/s) für Uploads und Downloads zusammen, optional je Uhrzeit (zB 10MB oder 10MB,08:00-18:00=1MB). 0 bedeutet unbegrenzt").Default("0").String()
+	bwUp    = app.Flag("bwup", "Max. Bandbreite (Bytes/s) für Uploads, Format wie --bwlimit").Default("0").String()
+	bwDown  = app.Flag("bwdown", "Max. Bandbreite (Bytes/s) für Downloads (auch im Mount), Format wie --bwlimit").Default("0").String()
+
+	retries       = app.Flag("retries", "Wie oft ein fehlgeschlagener Zugriff auf den Speicher wiederholt wird (0 bedeutet: 'drive' wiederholt jeden Request 6 mal bei Rate-Limits, 5xx und Verbindungsfehlern, sonst nie)").Default("0").Int()
+	qps           = app.Flag("qps", "Max. Zugriffe auf den Speicher pro Sekunde (0 bedeutet: 'drive' 10, sonst unbegrenzt)").Default("0").Float64()
+	fileListCache = app.Flag("filelistcache", "UpdateFileList wird übersprungen, solange die Liste jünger ist und nichts hochgeladen oder gelöscht wurde (0 deaktiviert diese Funktion)").Default("0").Duration()
+	faultRate     = app.Flag("faults", "Wahrscheinlichkeit (0 bis 1), mit der ein Zugriff auf den Speicher absichtlich fehlschlägt (nur für Tests)").Hidden().Default("0").Float64()
+	faultLatency  = app.Flag("faultlatency", "Verzögert jeden Zugriff auf den Speicher (nur für Tests)").Hidden().Default("0").Duration()
 
 	oauth       = app.Command("oauth", "Hilft bei der Erstellung aller Dateien für den Zugriff auf Google Drive")
 	oauthClient = oauth.Flag("client", "Pfad zur client_secret Datei").Default("client_secret.json").String()
@@ -35,34 +60,115 @@ var (
 	scanDB  = scan.Flag("db", "Pfad zur DB (wird überschrieben)").Default("splitfuse.db").String()
 	scanDir = scan.Flag("dir", "Pfad zum Ordner mit allen Klartext Dateien").Required().ExistingDir()
 
+	scanExclude    = scan.Flag("exclude", "Schließt Dateien und Ordner aus (gitignore Muster, mehrfach möglich)").Strings()
+	scanInclude    = scan.Flag("include", "Nimmt nur Dateien auf, die einem dieser Muster entsprechen (gitignore Muster, mehrfach möglich)").Strings()
+	scanIgnoreFile = scan.Flag("ignorefile", "Name der Ignore-Datei in den Ordnern (ein leerer String deaktiviert diese Funktion)").Default(core.IGNOREFILE).String()
+	scanMinSize    = scan.Flag("minsize", "Dateien mit weniger Bytes werden ignoriert").Int64()
+	scanMaxSize    = scan.Flag("maxsize", "Dateien mit mehr Bytes werden ignoriert (0 bedeutet keine Grenze)").Int64()
+	scanMinAge     = scan.Flag("minage", "Dateien, die jünger sind, werden ignoriert (zB 10m für laufende Downloads)").Duration()
+	scanMaxAge     = scan.Flag("maxage", "Dateien, die älter sind, werden ignoriert (0 bedeutet keine Grenze)").Duration()
+
 	upload       = app.Command("upload", "Lädt alle Chunks in den angegebenen Speicher. Die DB wird dabei aktualisiert und überschrieben!")
 	uploadKey    = upload.Flag("key", "Pfad zum Keyfile").Default("splitfuse.key").ExistingFile()
 	uploadDB     = upload.Flag("db", "Pfad zur DB").Default("splitfuse.db").ExistingFile()
 	uploadDir    = upload.Flag("dir", "Pfad zum Ordner mit allen Klartext Dateien").Required().ExistingDir()
-	uploadMod    = upload.Flag("module", "'drive' für Google Drive und 'local' für die lokale Festplatte").Required().String()
-	uploadDest   = upload.Flag("dest", "Für 'drive' muss hier eine FolderID angegeben werden (es geht auch der Alias root). Für 'local' ist hier der Pfad zum Zielordner anzugeben.").Required().String()
+	uploadMod    = upload.Flag("module", "'drive' für Google Drive, 'local' für die lokale Festplatte und 'mirror' für mehrere Speicher").Required().String()
+	uploadDest   = upload.Flag("dest", "Für 'drive' muss hier eine FolderID angegeben werden (es geht auch der Alias root). Für 'local' ist hier der Pfad zum Zielordner anzugeben. Für 'mirror' eine Liste mit module:dest (zB drive:root,local:/mnt/backup).").Required().String()
 	uploadClient = upload.Flag("client", "Pfad zur client_secret Datei (für 'drive')").Default("client_secret.json").String()
 	uploadToken  = upload.Flag("token", "Pfad zur Token Datei (für 'drive')").Default("token.json").String()
 	uploadDbName = upload.Flag("dbFileName", "Die DB wird unter dem angegebenen Namen bei den Chunks im Speicher abgelegt.").Default("index.db").String()
 	uploadForce  = upload.Flag("force", "Zwingt zu einem SCAN und UPLOAD, auch wenn sich die DB nicht verändert hat. (Die DB wird dabei immer neu hochgeladen!)").Bool()
 
+	uploadExclude    = upload.Flag("exclude", "Schließt Dateien und Ordner aus (gitignore Muster, mehrfach möglich)").Strings()
+	uploadInclude    = upload.Flag("include", "Nimmt nur Dateien auf, die einem dieser Muster entsprechen (gitignore Muster, mehrfach möglich)").Strings()
+	uploadIgnoreFile = upload.Flag("ignorefile", "Name der Ignore-Datei in den Ordnern (ein leerer String deaktiviert diese Funktion)").Default(core.IGNOREFILE).String()
+	uploadMinSize    = upload.Flag("minsize", "Dateien mit weniger Bytes werden ignoriert").Int64()
+	uploadMaxSize    = upload.Flag("maxsize", "Dateien mit mehr Bytes werden ignoriert (0 bedeutet keine Grenze)").Int64()
+	uploadMinAge     = upload.Flag("minage", "Dateien, die jünger sind, werden ignoriert (zB 10m für laufende Downloads)").Duration()
+	uploadMaxAge     = upload.Flag("maxage", "Dateien, die älter sind, werden ignoriert (0 bedeutet keine Grenze)").Duration()
+
+	watch         = app.Command("watch", "Beobachtet einen Ordner (inotify), aktualisiert die DB laufend und lädt Änderungen hoch (wie UPLOAD)")
+	watchKey      = watch.Flag("key", "Pfad zum Keyfile").Default("splitfuse.key").ExistingFile()
+	watchDB       = watch.Flag("db", "Pfad zur DB").Default("splitfuse.db").ExistingFile()
+	watchDir      = watch.Flag("dir", "Pfad zum Ordner mit allen Klartext Dateien").Required().ExistingDir()
+	watchMod      = watch.Flag("module", "'drive' für Google Drive, 'local' für die lokale Festplatte und 'mirror' für mehrere Speicher").Required().String()
+	watchDest     = watch.Flag("dest", "Für 'drive' muss hier eine FolderID angegeben werden (es geht auch der Alias root). Für 'local' ist hier der Pfad zum Zielordner anzugeben. Für 'mirror' eine Liste mit module:dest (zB drive:root,local:/mnt/backup).").Required().String()
+	watchClient   = watch.Flag("client", "Pfad zur client_secret Datei (für 'drive')").Default("client_secret.json").String()
+	watchToken    = watch.Flag("token", "Pfad zur Token Datei (für 'drive')").Default("token.json").String()
+	watchDbName   = watch.Flag("dbFileName", "Die DB wird unter dem angegebenen Namen bei den Chunks im Speicher abgelegt.").Default("index.db").String()
+	watchSettle   = watch.Flag("settle", "Eine Datei wird erst gehasht, wenn sie so lange nicht mehr verändert wurde").Default("5s").Duration()
+	watchInterval = watch.Flag("interval", "Hochgeladen wird erst, wenn es so lange keine Änderung mehr gab").Default("1m").Duration()
+
+	watchExclude    = watch.Flag("exclude", "Schließt Dateien und Ordner aus (gitignore Muster, mehrfach möglich)").Strings()
+	watchInclude    = watch.Flag("include", "Nimmt nur Dateien auf, die einem dieser Muster entsprechen (gitignore Muster, mehrfach möglich)").Strings()
+	watchIgnoreFile = watch.Flag("ignorefile", "Name der Ignore-Datei in den Ordnern (ein leerer String deaktiviert diese Funktion)").Default(core.IGNOREFILE).String()
+	watchMinSize    = watch.Flag("minsize", "Dateien mit weniger Bytes werden ignoriert").Int64()
+	watchMaxSize    = watch.Flag("maxsize", "Dateien mit mehr Bytes werden ignoriert (0 bedeutet keine Grenze)").Int64()
+	watchMinAge     = watch.Flag("minage", "Dateien, die jünger sind, werden ignoriert (zB 10m für laufende Downloads)").Duration()
+	watchMaxAge     = watch.Flag("maxage", "Dateien, die älter sind, werden ignoriert (0 bedeutet keine Grenze)").Duration()
+
 	clean       = app.Command("clean", "Löscht nicht mehr benötigte Chunks. Die DB muss vorher mit SCAN aktualisiert werden. (ACHTUNG: Datenverlust!)")
 	cleanKey    = clean.Flag("key", "Pfad zum Keyfile").Default("splitfuse.key").ExistingFile()
 	cleanDB     = clean.Flag("db", "Pfad zur DB").Default("splitfuse.db").ExistingFile()
-	cleanMod    = clean.Flag("module", "'drive' für Google Drive und 'local' für die lokale Festplatte").Required().String()
-	cleanDest   = clean.Flag("dest", "Für 'drive' muss hier eine FolderID angegeben werden (es geht auch der Alias root). Für 'local' ist hier der Pfad zum Zielordner anzugeben.").Required().String()
+	cleanMod    = clean.Flag("module", "'drive' für Google Drive, 'local' für die lokale Festplatte und 'mirror' für mehrere Speicher").Required().String()
+	cleanDest   = clean.Flag("dest", "Für 'drive' muss hier eine FolderID angegeben werden (es geht auch der Alias root). Für 'local' ist hier der Pfad zum Zielordner anzugeben. Für 'mirror' eine Liste mit module:dest (zB drive:root,local:/mnt/backup).").Required().String()
 	cleanClient = clean.Flag("client", "Pfad zur client_secret Datei (für 'drive')").Default("client_secret.json").String()
 	cleanToken  = clean.Flag("token", "Pfad zur Token Datei (für 'drive')").Default("token.json").String()
 
-	normal       = app.Command("mount", "Mountet Klartext Dateien")
-	normalMod    = normal.Flag("module", "'drive' für Google Drive und 'local' für die lokale Festplatte").Required().String()
-	normalMount  = normal.Flag("dir", "Ordner, in dem die Klartext Dateien gemountet werden sollen").Required().ExistingDir()
-	normalChunks = normal.Flag("chunks", "Die folderId des Chunk-Ordners oder sein Pfad").Default("root").String()
-	normalDbName = normal.Flag("dbfileName", "Die DB wird unter dem angegebenen Namen bei den Chunks im Speicher regelmäßig eingelesen.").Default("index.db").String()
-	normalClient = normal.Flag("client", "Pfad zur client_secret Datei (für 'drive')").Default("client_secret.json").String()
-	normalToken  = normal.Flag("token", "Pfad zur Token Datei (für 'drive')").Default("token.json").String()
-	normalKey    = normal.Flag("key", "Pfad zum Keyfile").Default("splitfuse.key").ExistingFile()
-	normalCache  = normal.Flag("cache", "Puffert die FileList in einer Datei und beschleunigt den Start des FUSE. Ein leerer String deaktiviert diese Funktion!").Default("cache.dat").String()
+	normal        = app.Command("mount", "Mountet Klartext Dateien (Exit Codes: 51 Speicher nicht erreichbar, 52 DB Download, 53 DB Entschlüsselung, 54 Mount)")
+	normalMod     = normal.Flag("module", "'drive' für Google Drive, 'local' für die lokale Festplatte und 'mirror' für mehrere Speicher").Required().String()
+	normalMount   = normal.Flag("dir", "Ordner, in dem die Klartext Dateien gemountet werden sollen").Required().ExistingDir()
+	normalChunks  = normal.Flag("chunks", "Die folderId des Chunk-Ordners oder sein Pfad (für 'mirror' eine Liste mit module:dest)").Default("root").String()
+	normalDbName  = normal.Flag("dbfileName", "Die DB wird unter dem angegebenen Namen bei den Chunks im Speicher regelmäßig eingelesen.").Default("index.db").String()
+	normalClient  = normal.Flag("client", "Pfad zur client_secret Datei (für 'drive')").Default("client_secret.json").String()
+	normalToken   = normal.Flag("token", "Pfad zur Token Datei (für 'drive')").Default("token.json").String()
+	normalKey     = normal.Flag("key", "Pfad zum Keyfile").Default("splitfuse.key").ExistingFile()
+	normalCache   = normal.Flag("cache", "Puffert die FileList in einer Datei und beschleunigt den Start des FUSE. Ein leerer String deaktiviert diese Funktion!").Default("cache.dat").String()
+	normalOwner   = normal.Flag("mapowner", "Alle Dateien gehören dem Benutzer, der mountet (statt uid/gid aus der DB)").Bool()
+	normalRefresh = normal.Flag("refresh", "In diesem Intervall wird im Hintergrund nach einer neuen DB gesucht").Default("10m").Duration()
+
+	normalChunkCache     = normal.Flag("chunkcache", "Ordner, in dem gelesene Chunks (verschlüsselt) zwischengespeichert werden. Ein leerer String deaktiviert diese Funktion!").Default("").String()
+	normalChunkCacheSize = normal.Flag("chunkcachesize", "Max. Größe des Chunk-Caches (zB 500MB oder 20GB)").Default("10GB").Bytes()
+	normalOffline        = normal.Flag("offline", "Lokale Kopie der DB (verschlüsselt), die verwendet wird, wenn der Speicher nicht erreichbar ist. Ein leerer String deaktiviert diese Funktion!").Default("").String()
+	normalPinDir         = normal.Flag("pindir", "Ordner, in dem die Chunks angehefteter Dateien (verschlüsselt) gespeichert werden (siehe PIN). Ein leerer String deaktiviert diese Funktion!").Default("").String()
+	normalPinSize        = normal.Flag("pinsize", "Max. Größe aller angehefteten Chunks (zB 500MB oder 20GB)").Default("10GB").Bytes()
+	normalMetrics        = normal.Flag("metrics", "Adresse (zB :9100), unter der Prometheus Metriken (/metrics) abgefragt werden können. Ein leerer String deaktiviert diese Funktion!").Default("").String()
+
+	pin      = app.Command("pin", "Heftet Dateien/Ordner in einem Mount an: Ihre Chunks werden lokal gespeichert (siehe MOUNT --pindir)")
+	pinPaths = pin.Arg("path", "Pfade im gemounteten Ordner").Required().Strings()
+
+	unpin      = app.Command("unpin", "Entfernt angeheftete Dateien/Ordner in einem Mount (die lokalen Chunks werden gelöscht)")
+	unpinPaths = unpin.Arg("path", "Pfade im gemounteten Ordner").Required().Strings()
+
+	pins    = app.Command("pins", "Zeigt alle angehefteten Dateien/Ordner eines Mounts mit ihrem Status")
+	pinsDir = pins.Arg("dir", "Der gemountete Ordner").Required().ExistingDir()
+
+	serveCmd      = app.Command("serve", "Stellt die Klartext Dateien über HTTP (und optional WebDAV) zur Verfügung, nur lesend (auch ohne FUSE)")
+	serveMod      = serveCmd.Flag("module", "'drive' für Google Drive, 'local' für die lokale Festplatte und 'mirror' für mehrere Speicher").Required().String()
+	serveChunks   = serveCmd.Flag("chunks", "Die folderId des Chunk-Ordners oder sein Pfad (für 'mirror' eine Liste mit module:dest)").Default("root").String()
+	serveDbName   = serveCmd.Flag("dbfileName", "Die DB wird unter dem angegebenen Namen bei den Chunks im Speicher regelmäßig eingelesen.").Default("index.db").String()
+	serveClient   = serveCmd.Flag("client", "Pfad zur client_secret Datei (für 'drive')").Default("client_secret.json").String()
+	serveToken    = serveCmd.Flag("token", "Pfad zur Token Datei (für 'drive')").Default("token.json").String()
+	serveKey      = serveCmd.Flag("key", "Pfad zum Keyfile").Default("splitfuse.key").ExistingFile()
+	serveCache    = serveCmd.Flag("cache", "Puffert die FileList in einer Datei und beschleunigt den Start. Ein leerer String deaktiviert diese Funktion!").Default("cache.dat").String()
+	serveRefresh  = serveCmd.Flag("refresh", "In diesem Intervall wird im Hintergrund nach einer neuen DB gesucht").Default("10m").Duration()
+	serveAddr     = serveCmd.Flag("addr", "Adresse, unter der der Server erreichbar ist (zB :8080 oder 127.0.0.1:8080)").Default(":8080").String()
+	serveWebDAV   = serveCmd.Flag("webdav", "Erlaubt zusätzlich den Zugriff über WebDAV (nur lesend)").Bool()
+	serveUser     = serveCmd.Flag("user", "Benutzer für Basic Authentication. Ein leerer String deaktiviert diese Funktion!").Default("").String()
+	servePassword = serveCmd.Flag("password", "Passwort für Basic Authentication").Envar("SPLITFUSE_PASSWORD").String()
+	serveCert     = serveCmd.Flag("cert", "Zertifikat für HTTPS. Ein leerer String deaktiviert diese Funktion!").Default("").String()
+	serveCertKey  = serveCmd.Flag("certkey", "Privater Schlüssel zum Zertifikat (für --cert)").Default("").String()
+
+	syncCmd      = app.Command("sync", "Kopiert fehlende Chunks (Vergleich über Name und Größe) und zuletzt die DB von einem Speicher in einen anderen, zB für eine lokale Kopie")
+	syncFromMod  = syncCmd.Flag("frommodule", "Quelle: 'drive', 'local' oder 'mirror' (wie --module)").Required().String()
+	syncFrom     = syncCmd.Flag("from", "Quelle: FolderID oder Pfad (wie --dest)").Required().String()
+	syncToMod    = syncCmd.Flag("tomodule", "Ziel: 'drive', 'local' oder 'mirror' (wie --module)").Required().String()
+	syncTo       = syncCmd.Flag("to", "Ziel: FolderID oder Pfad (wie --dest)").Required().String()
+	syncClient   = syncCmd.Flag("client", "Pfad zur client_secret Datei (für 'drive')").Default("client_secret.json").String()
+	syncToken    = syncCmd.Flag("token", "Pfad zur Token Datei (für 'drive')").Default("token.json").String()
+	syncDbName   = syncCmd.Flag("dbFileName", "Die DB mit diesem Namen wird im Ziel ersetzt statt ergänzt (ein leerer String deaktiviert diese Funktion)").Default("index.db").String()
+	syncParallel = syncCmd.Flag("parallel", "So viele Chunks werden gleichzeitig kopiert").Default("4").Int()
+	syncDryRun   = syncCmd.Flag("dryrun", "Zeigt nur an, was kopiert würde").Bool()
 )
 
 func main() {
@@ -70,22 +176,40 @@ func main() {
 	app.UsageTemplate(kingpin.LongHelpTemplate)
 	command := kingpin.MustParse(app.Parse(os.Args[1:]))
 
+	// logging einrichten
+	if *debug {
+		*logLevel = "debug"
+	}
+	if err := logging.Setup(*logLevel, *logSinks); err != nil {
+		panic(err)
+	}
+
 	switch command {
 	case oauth.FullCommand(): //________________________________________________________________________________________
 		// neuen token schreiben (Google Drive API)
-		drive.CreateTokenFile(*oauthClient, *oauthToken, *oauthWrite)
+		exitOnError(drive.CreateTokenFile(*oauthClient, *oauthToken, *oauthWrite))
 
 	case gen.FullCommand(): //__________________________________________________________________________________________
 		// neues keyfile schreiben (SplitFuse Verschlüsselung)
-		core.NewRandomKeyfile(*genKey)
+		exitOnError(core.NewRandomKeyfile(*genKey))
 
 	case scan.FullCommand(): //_________________________________________________________________________________________
 		// db aktualisieren
-		scanFunc(*scanKey, *scanDB, *scanDir, *debug)
+		filter := &core.Filter{Exclude: *scanExclude, Include: *scanInclude, IgnoreFile: *scanIgnoreFile,
+			MinSize: *scanMinSize, MaxSize: *scanMaxSize, MinAge: *scanMinAge, MaxAge: *scanMaxAge}
+		scanFunc(*scanKey, *scanDB, *scanDir, filter)
 
 	case upload.FullCommand(): //_______________________________________________________________________________________
 		// db aktualisieren und alles hochladen
-		uploadFunc(*uploadKey, *uploadDB, *uploadDir, *uploadMod, *uploadDest, *uploadClient, *uploadToken, *debug, *uploadDbName)
+		filter := &core.Filter{Exclude: *uploadExclude, Include: *uploadInclude, IgnoreFile: *uploadIgnoreFile,
+			MinSize: *uploadMinSize, MaxSize: *uploadMaxSize, MinAge: *uploadMinAge, MaxAge: *uploadMaxAge}
+		uploadFunc(*uploadKey, *uploadDB, *uploadDir, filter, *uploadMod, *uploadDest, *uploadClient, *uploadToken, *uploadDbName)
+
+	case watch.FullCommand(): //________________________________________________________________________________________
+		// db laufend aktualisieren und hochladen
+		filter := &core.Filter{Exclude: *watchExclude, Include: *watchInclude, IgnoreFile: *watchIgnoreFile,
+			MinSize: *watchMinSize, MaxSize: *watchMaxSize, MinAge: *watchMinAge, MaxAge: *watchMaxAge}
+		watchFunc(*watchKey, *watchDB, *watchDir, filter, *watchMod, *watchDest, *watchClient, *watchToken, *watchDbName, *watchSettle, *watchInterval)
 
 	case clean.FullCommand(): //________________________________________________________________________________________
 		// alte chunks im Speicher löschen
@@ -94,18 +218,65 @@ func main() {
 	case normal.FullCommand(): //_______________________________________________________________________________________
 		// FUSE MOUNT (Linux only)
 		client := clientModule(*normalMod, *normalChunks, *normalClient, *normalToken, *normalCache)
-		fuse.MountNormal(client, *normalDbName, *normalKey, *normalMount, *debug, false)
+		var diskCache *fh.DiskCache
+		if *normalChunkCache != "" {
+			var err error
+			diskCache, err = fh.NewDiskCache(*normalChunkCache, int64(*normalChunkCacheSize))
+			if err != nil {
+				panic(err)
+			}
+		}
+		var pinStore *fh.PinStore
+		if *normalPinDir != "" {
+			var err error
+			pinStore, err = fh.NewPinStore(*normalPinDir, int64(*normalPinSize))
+			if err != nil {
+				panic(err)
+			}
+		}
+		if *normalMetrics != "" {
+			if err := metrics.Serve(*normalMetrics); err != nil {
+				panic(err)
+			}
+		}
+		_, err := fuse.MountNormal(client, *normalDbName, *normalKey, *normalMount, *normalOwner, diskCache, pinStore, *normalOffline, *normalRefresh, *debug, false)
+		exitOnError(err)
+
+	case pin.FullCommand(): //__________________________________________________________________________________________
+		// Dateien/Ordner anheften (Linux only)
+		pinFunc(*pinPaths, true)
+
+	case unpin.FullCommand(): //________________________________________________________________________________________
+		// angeheftete Dateien/Ordner entfernen (Linux only)
+		pinFunc(*unpinPaths, false)
+
+	case pins.FullCommand(): //_________________________________________________________________________________________
+		// angeheftete Dateien/Ordner auflisten (Linux only)
+		status, err := fuse.PinStatus(*pinsDir, true)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Print(status)
+
+	case serveCmd.FullCommand(): //_____________________________________________________________________________________
+		// HTTP/WebDAV Server (auch ohne FUSE)
+		serveFunc()
+
+	case syncCmd.FullCommand(): //______________________________________________________________________________________
+		// fehlende Chunks und die DB in einen anderen Speicher kopieren
+		syncFunc()
 	}
 }
 
 //____________________________________________________________________________________________________________________//
 
 // scanFunc liest einen Ordner ein und aktualisiert gegebenenfalls die DB
+// Vom Filter ausgeschlossene Dateien werden weder gehasht noch in die DB aufgenommen.
 // Es wird true zurück gegeben, sollte es zu einer Änderung gekommen sein!
-func scanFunc(keyFile, dbFile, dir string, debug bool) bool {
+func scanFunc(keyFile, dbFile, dir string, filter *core.Filter) bool {
 
 	// keyFile laden
-	k := core.LoadKeyfile(keyFile)
+	k := loadKeyfile(keyFile)
 
 	// alte DB laden
 	oldDB, err := core.DbFromFile(dbFile, k.DbKey())
@@ -114,15 +285,14 @@ func scanFunc(keyFile, dbFile, dir string, debug bool) bool {
 	}
 
 	// Ordner scannen
-	newDB, changed, summary, err := core.ScanFolder(dir, oldDB, debug)
+	newDB, changed, summary, err := core.ScanFolder(dir, oldDB, filter)
 	if err != nil {
 		panic(err)
 	}
 
 	// gibt es änderungen? -> DB überschreiben
 	if changed {
-		print("update DB: ")
-		println(summary)
+		logging.Info("update db", logging.Path(dbFile), logging.F("summary", summary))
 		err = core.DbToFile(dbFile, k.DbKey(), newDB)
 		if err != nil {
 			panic(err)
@@ -134,32 +304,143 @@ func scanFunc(keyFile, dbFile, dir string, debug bool) bool {
 }
 
 // clientModule ist eine Hilfsfunktion die je nach 'module' eine andere Client Implementierung zurück gibt.
+// Der Client wird mit den Middlewares aus den globalen Flags umhüllt (siehe clientMiddlewares).
+// Für 'mirror' ist destination eine Liste mit module:dest (zB drive:root,local:/mnt/backup), siehe mirror.Client.
 func clientModule(module, destination, apiClient, apiToken, cacheFile string) backbone.Client {
+	var client backbone.Client
+	if module == "mirror" {
+		var targets []mirror.Target
+		for _, entry := range strings.Split(destination, ",") {
+			targetModule, targetDest, ok := strings.Cut(strings.TrimSpace(entry), ":")
+			if !ok || targetModule == "mirror" {
+				exitOnError(fmt.Errorf("invalid mirror target %q: use drive:<folderId> or local:<path>", entry))
+			}
+			target := baseClient(targetModule, targetDest, apiClient, apiToken, cacheFile)
+			targets = append(targets, mirror.Target{Name: targetModule + ":" + targetDest, Client: middleware.Chain(target, storageMiddlewares(targetModule)...)})
+			if targetModule == "drive" {
+				cacheFile = "" // der Cache gilt nur für einen Ordner
+			}
+		}
+		mirrorClient, err := mirror.New(targets...)
+		exitOnError(err)
+		client = mirrorClient
+	} else {
+		client = baseClient(module, destination, apiClient, apiToken, cacheFile)
+	}
+	return middleware.Chain(client, clientMiddlewares(module)...)
+}
+
+// baseClient gibt den Client für 'drive' oder 'local' zurück (ohne Middlewares).
+func baseClient(module, destination, apiClient, apiToken, cacheFile string) backbone.Client {
 	switch module {
 	case "drive":
-		return drive.NewApiClient(apiClient, apiToken, cacheFile, destination)
+		client, err := drive.NewApiClient(apiClient, apiToken, cacheFile, destination)
+		exitOnError(err)
+		client.(*drive.ApiClient).SetRetry(*retries, *qps)
+		return client
 
 	case "local":
 		return local.NewDiskClient(destination)
 
 	default:
-		panic("unsupported module: use 'drive' or 'local'")
+		panic("unsupported module: use 'drive', 'local' or 'mirror'")
+	}
+}
+
+// clientMiddlewares gibt die Middlewares aus den globalen Flags zurück (die erste ist die äußerste).
+// Metrics sieht jeden Aufruf so, wie ihn der Aufrufer erlebt. Bei 'mirror' liegen Retry, RateLimit und Faults
+// in jedem Ziel (siehe storageMiddlewares), damit jeder Speicher seine eigenen Regeln bekommt.
+func clientMiddlewares(module string) []middleware.Middleware {
+	limits := sharedLimits()
+	ret := []middleware.Middleware{
+		middleware.Metrics(module),
+		middleware.FileListCache(*fileListCache),
+		func(client backbone.Client) backbone.Client { return throttle.NewClient(client, limits) },
+	}
+	if module != "mirror" {
+		ret = append(ret, storageMiddlewares(module)...)
+	}
+	return ret
+}
+
+// storageMiddlewares gibt Retry, RateLimit und Faults für einen Speicher ('drive' oder 'local') zurück.
+// RateLimit und Faults liegen innerhalb von Retry, damit auch jede Wiederholung zählt bzw. fehlschlagen kann.
+// 'drive' wiederholt und begrenzt jeden Request selbst (siehe baseClient und drive.ApiClient.SetRetry),
+// daher bekommt es hier nur Faults.
+func storageMiddlewares(module string) []middleware.Middleware {
+	var ret []middleware.Middleware
+	if module != "drive" {
+		ret = append(ret,
+			middleware.Retry(middleware.RetryOptions{MaxRetries: *retries}),
+			middleware.RateLimit(*qps),
+		)
+	}
+	if *faultRate > 0 || *faultLatency > 0 {
+		logging.Warn("fault injection enabled", logging.Backbone(module), logging.F("rate", *faultRate), logging.F("latency", faultLatency.String()))
+		ret = append(ret, middleware.NewFaults(*faultRate, *faultLatency).Middleware())
+	}
+	return ret
+}
+
+// limitsOnce und limits gehören zu sharedLimits.
+var (
+	limitsOnce sync.Once
+	limits     throttle.Limits
+)
+
+// sharedLimits gibt die Limiter aus bandwidthLimits zurück. Sie werden nur einmal erzeugt und von allen Clients
+// geteilt (zB von beiden Seiten bei 'sync'), damit die Grenzen für das ganze Programm gelten.
+func sharedLimits() throttle.Limits {
+	limitsOnce.Do(func() {
+		limits = bandwidthLimits()
+	})
+	return limits
+}
+
+// bandwidthLimits erzeugt die Limiter aus --bwlimit, --bwup und --bwdown.
+// Ein ungültiger Zeitplan beendet das Programm.
+func bandwidthLimits() throttle.Limits {
+	limiter := func(flag, value string) *throttle.Limiter {
+		schedule, err := throttle.ParseSchedule(value)
+		if err != nil {
+			exitOnError(fmt.Errorf("--%s: %v", flag, err))
+		}
+		l := throttle.NewLimiter(schedule)
+		if l != nil {
+			logging.Info("bandwidth limit", logging.F("flag", flag), logging.F("schedule", schedule.String()))
+		}
+		return l
+	}
+	return throttle.Limits{
+		Total:    limiter("bwlimit", *bwLimit),
+		Upload:   limiter("bwup", *bwUp),
+		Download: limiter("bwdown", *bwDown),
 	}
 }
 
 // uploadFunc aktualisiert die DB mit scanFunc() und lädt dann neue Chunks in den Speicher.
-// Die DB wird ebenfalls aktualisiert. Dabei werden zuerst alle DBs mit dem angegebenen Namen gelöscht und dann die neue DB gespeichert.
-func uploadFunc(keyFile, dbFile, dir, module, destination, apiClient, apiToken string, debug bool, dbFileNameOnStorage string) {
-	uploadCount := 0
+// Die DB wird ebenfalls aktualisiert. Dabei wird zuerst die neue DB gespeichert und dann werden die alten DBs mit dem angegebenen Namen gelöscht.
+// Da nur Chunks aus der DB hochgeladen werden, gilt der Filter auch für den Upload.
+func uploadFunc(keyFile, dbFile, dir string, filter *core.Filter, module, destination, apiClient, apiToken string, dbFileNameOnStorage string) {
 
 	// DB AKTUALISIEREN
-	changed := scanFunc(keyFile, dbFile, dir, debug)
+	changed := scanFunc(keyFile, dbFile, dir, filter)
 	if !changed && !*uploadForce {
 		return // NICHTS ANDERS, NICHTS ÄNDERN, NICHTS HOCHLADEN
 	}
 
+	// CHUNKS UND DB HOCHLADEN (Ctrl-C bricht sauber ab, die alte DB bleibt im Speicher)
+	ctx, stop := signalContext()
+	defer stop()
+	uploadChunks(ctx, keyFile, dbFile, dir, module, destination, apiClient, apiToken, dbFileNameOnStorage)
+}
+
+// uploadChunks lädt alle Chunks der DB, die noch nicht im Speicher sind, hoch und ersetzt danach die DB im Speicher.
+// Die DB wird dabei NICHT aktualisiert (siehe uploadFunc und watchFunc). Wird der ctx beendet, dann wird das Programm beendet.
+func uploadChunks(ctx context.Context, keyFile, dbFile, dir, module, destination, apiClient, apiToken string, dbFileNameOnStorage string) {
+
 	// keyFile laden
-	k := core.LoadKeyfile(keyFile)
+	k := loadKeyfile(keyFile)
 
 	// DB laden
 	db, err := core.DbFromFile(dbFile, k.DbKey())
@@ -170,105 +451,157 @@ func uploadFunc(keyFile, dbFile, dir, module, destination, apiClient, apiToken s
 	// client erstellen (drive oder local)
 	client := clientModule(module, destination, apiClient, apiToken, "")
 
-	// fileList initialisieren
-	if debug {
-		fmt.Printf("DEBUG: init FileList\n")
-	}
-
-	err = client.InitFileList()
+	// Chunks und DB hochladen
+	repo := splitfuse.New(client, k, dbFileNameOnStorage, db)
+	uploadCount, err := repo.Upload(ctx, dir)
+	exitOnCancel(ctx, "upload")
 	if err != nil {
 		panic(err)
 	}
-	clientFileList := client.FileList()
-
-	// search new stuff (welche chunks sind noch nicht am Speicher (drive oder local)
-	if debug {
-		fmt.Printf("DEBUG: search new stuff\n")
-	}
 
-	for origFilePath, dbFileObj := range db {
+	// report
+	logging.Info("upload files", logging.Backbone(module), logging.F("chunks", uploadCount))
+}
 
-		// alle Dateien in der DB ...
-		for chunkIndex, chunk := range dbFileObj.FileChunks {
+// watchFunc führt zuerst uploadFunc() aus und beobachtet dann den Ordner.
+// Geänderte Elemente werden gehasht, sobald sie für die Dauer von settle nicht mehr verändert wurden. Die DB wird dabei sofort geschrieben.
+// Hochgeladen wird, wenn es für die Dauer von interval keine weitere Änderung gab. Schlägt der Upload fehl, dann wird er später wiederholt.
+// Mit --minage ausgeschlossene Dateien werden erneut geprüft, sobald sie alt genug sind (auch ohne weiteres Event).
+func watchFunc(keyFile, dbFile, dir string, filter *core.Filter, module, destination, apiClient, apiToken string, dbFileNameOnStorage string, settle, interval time.Duration) {
 
-			// ... die wiederum aus mehreren Chunks bestehen
-			chunkFileName := fmt.Sprintf("%x", k.CalcChunkName(chunk[:]))
-			chunkFileKey := k.CalcChunkKey(chunk[:])
-			chunkFileSize := core.CalcChunkSize(chunkIndex, dbFileObj.Size)
+	// alles auf den aktuellen Stand bringen
+	start := time.Now()
+	uploadFunc(keyFile, dbFile, dir, filter, module, destination, apiClient, apiToken, dbFileNameOnStorage)
 
-			// in der FileList des Speichers suchen
-			found := false
-			for _, clientFileObj := range clientFileList {
-				if clientFileObj.Size == chunkFileSize && clientFileObj.Name == chunkFileName {
-					found = true
-					break
-				}
-			}
+	// keyFile laden
+	k := loadKeyfile(keyFile)
 
-			// ACTION: Chunk ist noch NICHT am Speicher (drive/local) -> HOCHLADEN
-			if !found {
-				// original Datei öffnen
-				fh, err := os.Open(path.Join(dir, origFilePath))
-				if err != nil {
-					panic(err)
-				}
-				// zum chunk Anfang springen
-				_, err = fh.Seek(int64(chunkIndex)*core.CHUNKSIZE, 0)
-				if err != nil {
-					panic(err)
-				}
-				// DEBUG
-				if debug {
-					fmt.Printf("DEBUG: upload %s ... ", chunkFileName)
-				}
-				// chunk (verschlüsselt) hochladen
-				cryptReader := core.CryptReader(fh, chunkFileKey)
-				_, err = client.Save(chunkFileName, cryptReader, chunkFileSize)
-				if err != nil {
-					panic(err)
-				}
-				uploadCount++
-				// DEBUG
-				if debug {
-					fmt.Printf("OK (%d bytes)\n", chunkFileSize)
-				}
-				// fh schließen  (gäbe es eine panic, wäre das Programm sowieso beendet)
-				fh.Close()
-			}
-		}
+	// DB laden
+	db, err := core.DbFromFile(dbFile, k.DbKey())
+	if err != nil {
+		panic(err)
 	}
 
-	// report
-	println(fmt.Sprintf("upload files: %d chunks", uploadCount)) // Dein Ernst? Ja, mein Ernst?
+	// Ctrl-C beendet das Beobachten (und einen laufenden Upload)
+	ctx, stop := signalContext()
+	defer stop()
 
-	// index.db hochladen (ganz am Ende)
-
-	// fileList aktualisieren
-	err = client.UpdateFileList()
+	// Ordner beobachten
+	w, err := watcher.NewWatcher(dir, settle, filter)
 	if err != nil {
 		panic(err)
 	}
-	// alle alten index.db dateien löschen
-	for _, fileObj := range client.FileList() {
-		if fileObj.Name == dbFileNameOnStorage {
-			err := client.Trash(fileObj.Id)
+	defer w.Close()
+	logging.Info("watching", logging.Path(dir))
+
+	pending := false         // gibt es Änderungen, die noch nicht hochgeladen wurden?
+	lastChange := time.Now() // Zeitpunkt der letzten Änderung
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	// Elemente, die wegen --minage erneut geprüft werden müssen (mit dem Zeitpunkt)
+	// Der erste Scan kann zu junge Dateien überall übersprungen haben -> nach MinAge alles prüfen
+	recheck := make(map[string]time.Time)
+	if filter != nil && filter.MinAge > 0 {
+		recheck["."] = start.Add(filter.MinAge)
+	}
+
+	// update aktualisiert die DB für die geänderten Elemente.
+	// Bei einem Event (events) werden auch Ordner nach MinAge erneut geprüft, bei einer erneuten Prüfung nicht mehr.
+	update := func(paths []string, events bool) {
+		changed, summary, err := core.UpdatePaths(dir, db, paths, filter)
+		if err != nil {
+			// die DB ist jetzt vielleicht unvollständig -> alles neu scannen
+			logging.Warn("watch: update failed, scan folder", logging.F("summary", summary), logging.Err(err))
+			newDB, _, summary, err := core.ScanFolder(dir, db, filter)
+			if err != nil {
+				logging.Error("watch: scan failed", logging.F("summary", summary), logging.Err(err))
+				return
+			}
+			db = newDB
+			changed = true
+		}
+		if changed {
+			logging.Info("update db", logging.Path(dbFile), logging.F("summary", summary))
+			err = core.DbToFile(dbFile, k.DbKey(), db)
 			if err != nil {
 				panic(err)
 			}
+			pending = true
+			lastChange = time.Now()
+		}
+
+		// zu junge Dateien (und Ordner, die welche enthalten können) später erneut prüfen
+		if filter == nil || filter.MinAge <= 0 {
+			return
+		}
+		for _, p := range paths {
+			info, err := os.Lstat(filepath.Join(dir, p))
+			if err != nil {
+				continue
+			}
+			left := filter.MinAgeLeft(info)
+			if info.IsDir() && events {
+				left = filter.MinAge
+			}
+			if at := time.Now().Add(left); left > 0 && at.After(recheck[p]) {
+				recheck[p] = at
+			}
 		}
 	}
-	// neuen index hochladen
-	fh, err := os.Open(dbFile)
-	if err != nil {
-		panic(err)
-	}
-	defer fh.Close()
-	_, err = client.Save(dbFileNameOnStorage, fh, 0)
-	if err != nil {
-		panic(err)
+
+	for {
+		select {
+		case paths := <-w.Changes():
+			// DB aktualisieren
+			logging.Debug("watch: changes", logging.F("paths", paths))
+			update(paths, true)
+
+		case err := <-w.Errors():
+			logging.Error("watch error", logging.Path(dir), logging.Err(err))
+
+		case <-ctx.Done():
+			if pending {
+				logging.Warn("watch: stopped with changes that are not uploaded yet", logging.Path(dir))
+			}
+			return
+
+		case now := <-ticker.C:
+			// Dateien, die jetzt alt genug sind, erneut prüfen
+			due := make([]string, 0)
+			for p, at := range recheck {
+				if !now.Before(at) {
+					due = append(due, p)
+					delete(recheck, p)
+				}
+			}
+			if len(due) > 0 {
+				logging.Debug("watch: recheck minage", logging.F("paths", due))
+				update(due, false)
+			}
+
+			// hochladen, wenn sich nichts mehr tut
+			if pending && time.Since(lastChange) >= interval {
+				pending = !tryUploadChunks(ctx, keyFile, dbFile, dir, module, destination, apiClient, apiToken, dbFileNameOnStorage)
+				lastChange = time.Now()
+			}
+		}
 	}
 }
 
+// tryUploadChunks ruft uploadChunks() auf und fängt dabei eine panic ab (zB wenn der Speicher nicht erreichbar ist).
+// Es wird true zurück gegeben, wenn der Upload erfolgreich war.
+func tryUploadChunks(ctx context.Context, keyFile, dbFile, dir, module, destination, apiClient, apiToken string, dbFileNameOnStorage string) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.Error("upload failed", logging.Backbone(module), logging.F("error", r))
+			ok = false
+		}
+	}()
+	uploadChunks(ctx, keyFile, dbFile, dir, module, destination, apiClient, apiToken, dbFileNameOnStorage)
+	return true
+}
+
 // cleanFunc löscht alte chunks aus dem Speicher. Dabei muss die DB zuerst mit scanFunc() aktualisiert werden.
 // Gelöscht werden nur Dateien die anhand des Dateinamens ein chunk sein können.
 func cleanFunc(keyFile, dbFile, module, destination, apiClient, apiToken string) {
@@ -279,7 +612,7 @@ func cleanFunc(keyFile, dbFile, module, destination, apiClient, apiToken string)
 	fmt.Printf("\n\n")
 
 	// keyFile laden
-	k := core.LoadKeyfile(keyFile)
+	k := loadKeyfile(keyFile)
 
 	// DB laden
 	db, err := core.DbFromFile(dbFile, k.DbKey())
@@ -290,41 +623,21 @@ func cleanFunc(keyFile, dbFile, module, destination, apiClient, apiToken string)
 	// client erstellen (drive oder local)
 	client := clientModule(module, destination, apiClient, apiToken, "")
 
-	// fileList initialisieren
-	err = client.InitFileList()
+	// alle chunks im Speicher durchgehen um nach alten chunks zu suchen
+	repo := splitfuse.New(client, k, "", db)
+	removeList, err := repo.Orphans(context.Background())
 	if err != nil {
 		panic(err)
 	}
-
-	// reverse DB baun
-	reverseDB := make(map[string]int64)
-	for _, dbFileObj := range db {
-		for chunkIndex, chunk := range dbFileObj.FileChunks {
-			chunkFileName := fmt.Sprintf("%x", k.CalcChunkName(chunk[:]))
-			chunkFileSize := core.CalcChunkSize(chunkIndex, dbFileObj.Size)
-			reverseDB[chunkFileName] = chunkFileSize
-		}
+	var removeBytes int64 = 0
+	for _, fileObj := range removeList {
+		removeBytes += fileObj.Size
+		fmt.Printf("OLD CHUNK: %s (%d bytes)\n", fileObj.Name, fileObj.Size)
 	}
-
-	// alle chunks im Speicher durchgehen um nach alten chunks zu suchen
 	clientFileList := client.FileList()
-	removeList := make([]string, 0) // speichert alle zu löschenden fileIds
-	var removeBytes int64 = 0
 	var totalBytes int64 = 0
-	for fileId, fileObj := range clientFileList {
+	for _, fileObj := range clientFileList {
 		totalBytes += fileObj.Size
-
-		// alle Einträge in der DB duch gehen und nach dem aktuell betrachteten chunk im Speicher suchen
-		chunkFileSize, ok := reverseDB[fileObj.Name]
-		if len(fileObj.Name) == 128 && (!ok || fileObj.Size != chunkFileSize) {
-			// HUCH, der chunk ist NICHT in der Datenbank
-			// oder die Größe passt nicht.
-			// dann schreibe seine fileId auf die Löschliste
-			removeList = append(removeList, fileId)
-			// debug
-			removeBytes += fileObj.Size
-			fmt.Printf("OLD CHUNK: %s (%d bytes)\n", fileObj.Name, fileObj.Size)
-		}
 	}
 
 	// Bericht und freigabe
@@ -336,15 +649,126 @@ func cleanFunc(keyFile, dbFile, module, destination, apiClient, apiToken string)
 	fmt.Printf("remaining %d chunks with %s Byte\n", len(clientFileList)-len(removeList), p.Sprintf("%d", totalBytes-removeBytes))
 	ask4confirm()
 
-	// LÖSCHEN
-	for _, fileId := range removeList {
-		err := client.Trash(fileId)
+	// LÖSCHEN (Ctrl-C bricht nach dem aktuellen Chunk ab)
+	ctx, stop := signalContext()
+	defer stop()
+	for _, fileObj := range removeList {
+		err := client.TrashContext(ctx, fileObj.Id)
+		exitOnCancel(ctx, "clean")
 		if err != nil {
 			panic(err)
 		}
 	}
 }
 
+// pinFunc heftet Dateien/Ordner in einem Mount an (pin=true) oder entfernt sie (pin=false).
+// Die Chunks werden vom Mount im Hintergrund heruntergeladen, der Status wird mit PINS angezeigt.
+func pinFunc(paths []string, pin bool) {
+	for _, p := range paths {
+		if pin {
+			if err := fuse.Pin(p); err != nil {
+				panic(fmt.Errorf("can't pin '%s': %v", p, err))
+			}
+			status, _ := fuse.PinStatus(p, false)
+			fmt.Printf("%s: %s\n", p, status)
+		} else {
+			if err := fuse.Unpin(p); err != nil {
+				panic(fmt.Errorf("can't unpin '%s': %v", p, err))
+			}
+			fmt.Printf("%s: unpinned\n", p)
+		}
+	}
+}
+
+// serveFunc lädt die DB aus dem Speicher und stellt die Klartext Dateien über HTTP zur Verfügung, bis das Programm
+// beendet wird (SIGINT oder SIGTERM). Gibt es noch keine DB, dann wird mit einer leeren DB gestartet.
+func serveFunc() {
+	if *serveCert != "" && *serveCertKey == "" {
+		exitOnError(fmt.Errorf("--certkey is required for --cert"))
+	}
+	if *serveUser != "" && *servePassword == "" {
+		exitOnError(fmt.Errorf("--password is required for --user"))
+	}
+
+	k := loadKeyfile(*serveKey)
+	client := clientModule(*serveMod, *serveChunks, *serveClient, *serveToken, *serveCache)
+
+	ctx, stop := signalContext()
+	defer stop()
+	repo, err := splitfuse.Open(ctx, client, k, *serveDbName)
+	if err == splitfuse.ErrNoDb {
+		logging.Warn("serve: no db found, starting with an empty db", logging.F("name", *serveDbName))
+		repo = splitfuse.New(client, k, *serveDbName, nil)
+	} else {
+		exitOnError(err)
+	}
+
+	opts := serve.Options{WebDAV: *serveWebDAV, User: *serveUser, Password: *servePassword, Refresh: *serveRefresh,
+		CertFile: *serveCert, KeyFile: *serveCertKey}
+	exitOnError(serve.Serve(ctx, *serveAddr, repo, opts))
+}
+
+// syncFunc kopiert fehlende Chunks und zuletzt die DB von --from nach --to (siehe mirror.Sync).
+// Chunks, die nur im Ziel vorhanden sind, bleiben erhalten (siehe CLEAN).
+// Beide Clients teilen sich die Limiter (siehe sharedLimits): --bwlimit gilt für Lesen und Schreiben zusammen.
+func syncFunc() {
+	from := clientModule(*syncFromMod, *syncFrom, *syncClient, *syncToken, "")
+	to := clientModule(*syncToMod, *syncTo, *syncClient, *syncToken, "")
+
+	ctx, stop := signalContext()
+	defer stop()
+	exitOnError(from.InitFileListContext(ctx))
+	exitOnError(to.InitFileListContext(ctx))
+
+	opts := mirror.SyncOptions{Parallel: *syncParallel, DryRun: *syncDryRun}
+	if *syncDbName != "" {
+		opts.Replace = []string{*syncDbName}
+	}
+	start := time.Now()
+	stats, err := mirror.Sync(ctx, from, to, opts)
+
+	p := message.NewPrinter(language.German)
+	if *syncDryRun {
+		fmt.Printf("DRY RUN: nothing was copied\n")
+	}
+	fmt.Printf("--------------------------------------\n")
+	fmt.Printf("present %d chunks\n", stats.Present)
+	fmt.Printf("copied %d chunks with %s Byte\n", stats.Copied, p.Sprintf("%d", stats.CopiedBytes))
+	fmt.Printf("replaced %d db files\n", stats.Replaced)
+	fmt.Printf("failed %d chunks\n", stats.Failed)
+	fmt.Printf("duration %v\n", time.Since(start).Round(time.Second))
+	exitOnCancel(ctx, "sync")
+	exitOnError(err)
+}
+
+// signalContext gibt einen ctx zurück, der mit SIGINT (Ctrl-C) oder SIGTERM beendet wird.
+// Solange der ctx aktiv ist, beenden diese Signale das Programm nicht mehr sofort (siehe exitOnCancel).
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// exitOnCancel beendet das Programm mit Exit Code 130, wenn der ctx beendet wurde (siehe signalContext).
+func exitOnCancel(ctx context.Context, operation string) {
+	if ctx.Err() != nil {
+		exitOnError(&core.ExitError{Code: 130, Err: fmt.Errorf("%s canceled: %v", operation, ctx.Err())})
+	}
+}
+
+// exitOnError beendet das Programm bei einem Fehler mit dem Exit Code des Fehlers (siehe core.ExitError).
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(core.ExitCode(err))
+	}
+}
+
+// loadKeyfile lädt das Keyfile und beendet das Programm im Fehlerfall.
+func loadKeyfile(keyFile string) core.KeyFile {
+	k, err := core.LoadKeyfile(keyFile)
+	exitOnError(err)
+	return k
+}
+
 // ask4confirm ist eine Hilfsfunktion die von Anwender ein y oder n erwartet.
 // Bei n wird das Programm mit os.Exit() beendet
 func ask4confirm() {
@@ -152,7 +152,7 @@ func TestScanAndUpload(t *testing.T) {
 	os.Mkdir(testFolderChunks, 0700)
 
 	// upload (da ist scan mit dabei)
-	uploadFunc(testKeyFile, testDbFile, testFolderOrig, "local", testFolderChunks, "", "", false, "indexius.dbius")
+	uploadFunc(testKeyFile, testDbFile, testFolderOrig, nil, "local", testFolderChunks, "", "", "indexius.dbius")
 
 	// chunks prüfen
 	checkChunk(testFolderChunks, "52807d542214c74747d241d072f1a07d", "0e5654f5dad72e4a930782da5ed941d6a54c678d7e6008d38c839ab01227bf83d58fb6a168cd3d5b64965375f9dc6fce565eaefc8e955f5f12a6b140a8345afa")
@@ -0,0 +1,289 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default ist die Registry, in der alle Pakete ihre Metriken anlegen.
+var Default = NewRegistry()
+
+// Registry sammelt Metriken (Counter, Gauges und Histogramme) und gibt sie im Textformat von Prometheus aus.
+// Die Ausgabe kann über HTTP abgefragt werden (siehe Serve).
+type Registry struct {
+	mutex   *sync.Mutex
+	metrics []*metric // in der Reihenfolge der Registrierung
+}
+
+// metric ist eine Metrik mit all ihren Zeitreihen (eine je Kombination der Label-Werte).
+type metric struct {
+	name    string
+	help    string
+	kind    string    // counter, gauge oder histogram
+	labels  []string  // Namen der Labels
+	buckets []float64 // obere Grenzen der Buckets (nur histogram)
+
+	mutex  *sync.Mutex
+	series map[string]*series // key sind die Label-Werte (verbunden mit \xff)
+}
+
+// series ist eine Zeitreihe einer Metrik.
+type series struct {
+	labelValues []string
+	value       float64  // counter und gauge
+	counts      []uint64 // histogram: Anzahl je Bucket (nicht kumuliert)
+	sum         float64  // histogram: Summe aller Werte
+	count       uint64   // histogram: Anzahl aller Werte
+}
+
+// DefBuckets sind die Standard-Buckets für Dauern in Sekunden.
+var DefBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewRegistry erzeugt eine leere Registry.
+func NewRegistry() *Registry {
+	return &Registry{mutex: &sync.Mutex{}}
+}
+
+// register legt eine neue Metrik an.
+func (r *Registry) register(name, help, kind string, buckets []float64, labels []string) *metric {
+	m := &metric{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		mutex:   &sync.Mutex{},
+		series:  make(map[string]*series),
+	}
+
+	// LOCK / UNLOCK
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, old := range r.metrics {
+		if old.name == name {
+			panic(fmt.Errorf("metric %s already registered", name))
+		}
+	}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// get gibt die Zeitreihe für die Label-Werte zurück (und legt sie gegebenenfalls an).
+// ACHTUNG: Der mutex der Metrik muss bereits gesperrt sein!
+func (m *metric) get(labelValues []string) *series {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Errorf("metric %s: %d label values for %d labels", m.name, len(labelValues), len(m.labels)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if m.kind == "histogram" {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Counter ist ein Zähler, der nur größer werden kann.
+type Counter struct{ m *metric }
+
+// NewCounter legt einen Counter mit den angegebenen Labels an.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, "counter", nil, labels)}
+}
+
+// Add erhöht den Counter um v (v darf nicht negativ sein).
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Errorf("counter %s: negative value %v", c.m.name, v))
+	}
+	c.m.mutex.Lock()
+	c.m.get(labelValues).value += v
+	c.m.mutex.Unlock()
+}
+
+// Inc erhöht den Counter um 1.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Gauge ist ein Wert, der beliebig gesetzt werden kann.
+type Gauge struct{ m *metric }
+
+// NewGauge legt eine Gauge mit den angegebenen Labels an.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, "gauge", nil, labels)}
+}
+
+// Set setzt den Wert.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.m.mutex.Lock()
+	g.m.get(labelValues).value = v
+	g.m.mutex.Unlock()
+}
+
+// Add verändert den Wert um v.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.m.mutex.Lock()
+	g.m.get(labelValues).value += v
+	g.m.mutex.Unlock()
+}
+
+// Inc erhöht den Wert um 1.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec verringert den Wert um 1.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Histogram zählt Werte (zB Dauern) in Buckets.
+type Histogram struct{ m *metric }
+
+// NewHistogram legt ein Histogramm mit den angegebenen (aufsteigend sortierten) Buckets und Labels an.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r.register(name, help, "histogram", buckets, labels)}
+}
+
+// Observe zählt einen Wert.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.m.mutex.Lock()
+	defer h.m.mutex.Unlock()
+
+	s := h.m.get(labelValues)
+	for i, upper := range h.m.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// WriteTo schreibt alle Metriken im Textformat von Prometheus.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	metrics := append([]*metric(nil), r.metrics...)
+	r.mutex.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, m := range metrics {
+		m.write(cw)
+	}
+	if cw.err == nil {
+		cw.err = cw.w.(*bufio.Writer).Flush()
+	}
+	return cw.n, cw.err
+}
+
+// write schreibt eine Metrik mit allen Zeitreihen (sortiert nach den Label-Werten).
+func (m *metric) write(w *countingWriter) {
+	// LOCK / UNLOCK
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	w.printf("# HELP %s %s\n", m.name, strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(m.help))
+	w.printf("# TYPE %s %s\n", m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := m.series[k]
+		if m.kind != "histogram" {
+			w.printf("%s%s %s\n", m.name, formatLabels(m.labels, s.labelValues, "", ""), formatValue(s.value))
+			continue
+		}
+
+		// Buckets werden kumuliert ausgegeben
+		var cumulative uint64
+		for i, upper := range m.buckets {
+			cumulative += s.counts[i]
+			w.printf("%s_bucket%s %d\n", m.name, formatLabels(m.labels, s.labelValues, "le", formatValue(upper)), cumulative)
+		}
+		w.printf("%s_bucket%s %d\n", m.name, formatLabels(m.labels, s.labelValues, "le", "+Inf"), s.count)
+		w.printf("%s_sum%s %s\n", m.name, formatLabels(m.labels, s.labelValues, "", ""), formatValue(s.sum))
+		w.printf("%s_count%s %d\n", m.name, formatLabels(m.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+// formatLabels gibt die Labels im Format {a="1",b="2"} aus. Mit extraName wird ein weiteres Label angehängt (zB le).
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	escape := strings.NewReplacer("\\", `\\`, "\"", `\"`, "\n", `\n`)
+	parts := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", name, escape.Replace(values[i])))
+	}
+	if extraName != "" {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", extraName, extraValue))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// formatValue gibt einen Wert so aus, wie ihn Prometheus erwartet.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter zählt die geschriebenen Bytes und merkt sich den ersten Fehler.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) printf(format string, a ...interface{}) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, format, a...)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+// ServeHTTP gibt alle Metriken aus (für den Prometheus Scraper).
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// Serve stellt die Metriken der Default Registry unter http://addr/metrics zur Verfügung.
+// Der Port wird sofort geöffnet (Fehler werden zurückgegeben), die Anfragen werden im Hintergrund beantwortet.
+func Serve(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Default)
+	go http.Serve(l, mux)
+	return nil
+}
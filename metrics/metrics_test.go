@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Prüft die Ausgabe im Textformat von Prometheus
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_total", "Ein Counter", "op")
+	g := r.NewGauge("test_open", "Eine Gauge")
+	h := r.NewHistogram("test_seconds", "Ein Histogramm", []float64{0.1, 1}, "op")
+
+	c.Inc("read")
+	c.Add(2, "read")
+	c.Inc("open \"x\"")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	h.Observe(0.05, "read")
+	h.Observe(0.5, "read")
+	h.Observe(5, "read")
+
+	buf := &bytes.Buffer{}
+	if _, err := r.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP test_total Ein Counter
+# TYPE test_total counter
+test_total{op="open \"x\""} 1
+test_total{op="read"} 3
+# HELP test_open Eine Gauge
+# TYPE test_open gauge
+test_open 1
+# HELP test_seconds Ein Histogramm
+# TYPE test_seconds histogram
+test_seconds_bucket{op="read",le="0.1"} 1
+test_seconds_bucket{op="read",le="1"} 2
+test_seconds_bucket{op="read",le="+Inf"} 3
+test_seconds_sum{op="read"} 5.55
+test_seconds_count{op="read"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("wrong output:\n%s", buf.String())
+	}
+
+	// doppelte Namen und falsche Anzahl an Labels
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("duplicate metric should panic")
+			}
+		}()
+		r.NewGauge("test_open", "doppelt")
+	}()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("missing label value should panic")
+			}
+		}()
+		c.Inc()
+	}()
+}
+
+// Prüft den HTTP Endpunkt
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_http_total", "Ein Counter").Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), "test_http_total 1\n") {
+		t.Errorf("wrong body: %s", rec.Body.String())
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("wrong content type: %s", rec.Header().Get("Content-Type"))
+	}
+
+	// ungültige Adresse
+	if err := Serve("256.0.0.1:1"); err == nil {
+		t.Error("invalid address should fail")
+	}
+}
@@ -0,0 +1,193 @@
+// Package serve stellt die Klartext Dateien eines Repository über HTTP (mit Range-Requests) und optional
+// über WebDAV (nur lesend) zur Verfügung. Damit können auch Geräte ohne FUSE (zB TVs, Handys oder windows)
+// auf die Dateien zugreifen.
+package serve
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"splitfuseX/logging"
+	"splitfuseX/splitfuse"
+
+	"golang.org/x/net/webdav"
+)
+
+// realm wird bei der Basic Authentication an den Browser geschickt.
+const realm = "splitfuseX"
+
+// Options sind die Einstellungen für Handler und Serve.
+type Options struct {
+	WebDAV   bool          // zusätzlich WebDAV (PROPFIND) erlauben, sonst nur GET und HEAD
+	User     string        // Benutzer für Basic Authentication ("" deaktiviert diese Funktion)
+	Password string        // Passwort für Basic Authentication
+	Refresh  time.Duration // in diesem Intervall wird nach einer neuen DB gesucht (0 deaktiviert diese Funktion, nur Serve)
+	CertFile string        // Zertifikat für TLS ("" deaktiviert TLS, nur Serve)
+	KeyFile  string        // privater Schlüssel zum Zertifikat
+}
+
+// Handler gibt einen http.Handler für das Repository zurück.
+// GET und HEAD werden von http.FileServer beantwortet (Range-Requests und Ordnerinhalte aus FolderContent),
+// mit opts.WebDAV zusätzlich OPTIONS und PROPFIND. Alle anderen Methoden sind nicht erlaubt (nur lesend).
+func Handler(repo *splitfuse.Repository, opts Options) http.Handler {
+	var dav http.Handler
+	if opts.WebDAV {
+		dav = &webdav.Handler{
+			FileSystem: &davFS{repo: repo},
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(r *http.Request, err error) {
+				if err != nil {
+					logging.Debug("serve: webdav", logging.Path(r.URL.Path), logging.F("method", r.Method), logging.Err(err))
+				}
+			},
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, opts) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		logging.Debug("serve: request", logging.Path(r.URL.Path), logging.F("method", r.Method))
+
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			// die Dateien werden nur so lange gelesen, wie der Request läuft
+			http.FileServer(repo.HTTPFileSystem(r.Context())).ServeHTTP(w, r)
+		case dav != nil && (r.Method == http.MethodOptions || r.Method == "PROPFIND"):
+			dav.ServeHTTP(w, r)
+		default:
+			if dav != nil {
+				w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+			} else {
+				w.Header().Set("Allow", "GET, HEAD")
+			}
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// authorized prüft Benutzer und Passwort (Basic Authentication) in konstanter Zeit.
+func authorized(r *http.Request, opts Options) bool {
+	if opts.User == "" {
+		return true
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	userOk := subtle.ConstantTimeCompare([]byte(user), []byte(opts.User)) == 1
+	passwordOk := subtle.ConstantTimeCompare([]byte(password), []byte(opts.Password)) == 1
+	return userOk && passwordOk
+}
+
+// Serve startet einen HTTP Server (mit TLS, wenn opts.CertFile gesetzt ist) und blockiert, bis der ctx beendet wird.
+// Im Hintergrund wird im Intervall opts.Refresh nach einer neuen DB gesucht (siehe splitfuse.Repository.Refresh).
+// Die DB muss bereits geladen sein (siehe splitfuse.Open).
+func Serve(ctx context.Context, addr string, repo *splitfuse.Repository, opts Options) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           Handler(repo, opts),
+		ReadHeaderTimeout: 30 * time.Second,
+		BaseContext:       func(_ net.Listener) context.Context { return ctx },
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if opts.Refresh > 0 {
+		go refreshDb(ctx, repo, opts.Refresh)
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	logging.Info("serve: listening", logging.F("addr", addr), logging.F("tls", opts.CertFile != ""), logging.F("webdav", opts.WebDAV))
+	var err error
+	if opts.CertFile != "" {
+		err = srv.ListenAndServeTLS(opts.CertFile, opts.KeyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// refreshDb sucht im Hintergrund nach einer neuen DB, bis der ctx beendet wird.
+// Fehler werden nur protokolliert, es wird weiter die bisherige DB verwendet.
+func refreshDb(ctx context.Context, repo *splitfuse.Repository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			changed, err := repo.Refresh(ctx)
+			if err != nil {
+				logging.Warn("serve: db refresh failed", logging.Err(err))
+				continue
+			}
+			if changed {
+				logging.Info("serve: db updated", logging.Duration(time.Since(start)))
+			}
+		}
+	}
+}
+
+// davFS ist ein webdav.FileSystem, das nur lesen kann. Symbolischen Links wird gefolgt.
+type davFS struct {
+	repo *splitfuse.Repository
+}
+
+func (d *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrPermission}
+}
+
+func (d *davFS) RemoveAll(ctx context.Context, name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: os.ErrPermission}
+}
+
+func (d *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	return &os.PathError{Op: "rename", Path: oldName, Err: os.ErrPermission}
+}
+
+func (d *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	f, err := d.repo.HTTPFileSystem(ctx).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return davFile{f}, nil
+}
+
+// Stat folgt (im Gegensatz zu splitfuse.FS.Stat) symbolischen Links, da WebDAV keine Links kennt.
+func (d *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	f, err := d.repo.HTTPFileSystem(ctx).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// davFile ist eine geöffnete Datei von davFS.
+type davFile struct {
+	http.File
+}
+
+func (f davFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
@@ -0,0 +1,158 @@
+package serve
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"splitfuseX/backbone/local"
+	"splitfuseX/core"
+	"splitfuseX/splitfuse"
+)
+
+// testServer lädt einige Dateien in einen lokalen Speicher hoch und startet einen Server mit dem Handler.
+func testServer(t *testing.T, opts Options) *httptest.Server {
+	root := t.TempDir()
+	dir := filepath.Join(root, "orig")
+	chunkDir := filepath.Join(root, "chunks")
+	for _, d := range []string{chunkDir, filepath.Join(dir, "sub")} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello splitfuse"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("0123456789"), 0600)
+	os.Symlink("sub/b.txt", filepath.Join(dir, "link"))
+
+	keyPath := filepath.Join(root, "key")
+	if err := core.NewRandomKeyfile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	k, err := core.LoadKeyfile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	repo := splitfuse.New(local.NewDiskClient(chunkDir), k, "index.db", nil)
+	if _, _, err := repo.Scan(ctx, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Upload(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(Handler(repo, opts))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// do führt einen Request aus und gibt Status und Body zurück.
+func do(t *testing.T, method, url string, header map[string]string) (int, string) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func TestHTTP(t *testing.T) {
+	srv := testServer(t, Options{})
+
+	if status, body := do(t, "GET", srv.URL+"/a.txt", nil); status != 200 || body != "hello splitfuse" {
+		t.Fatalf("get: %d %q", status, body)
+	}
+	if status, body := do(t, "GET", srv.URL+"/link", map[string]string{"Range": "bytes=2-4"}); status != 206 || body != "234" {
+		t.Fatalf("range: %d %q", status, body)
+	}
+	if status, body := do(t, "GET", srv.URL+"/", nil); status != 200 || !strings.Contains(body, `href="sub/"`) || !strings.Contains(body, `href="a.txt"`) {
+		t.Fatalf("listing: %d %q", status, body)
+	}
+	if status, _ := do(t, "GET", srv.URL+"/nope", nil); status != 404 {
+		t.Fatalf("missing: %d", status)
+	}
+	for _, method := range []string{"PUT", "DELETE", "PROPFIND"} {
+		if status, _ := do(t, method, srv.URL+"/a.txt", nil); status != 405 {
+			t.Fatalf("%s: %d", method, status)
+		}
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	srv := testServer(t, Options{User: "alice", Password: "secret"})
+
+	if status, _ := do(t, "GET", srv.URL+"/a.txt", nil); status != 401 {
+		t.Fatalf("without auth: %d", status)
+	}
+	req, _ := http.NewRequest("GET", srv.URL+"/a.txt", nil)
+	req.SetBasicAuth("alice", "wrong")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != 401 {
+		t.Fatalf("wrong password: %v, %v", resp, err)
+	}
+	req.SetBasicAuth("alice", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("with auth: %d", resp.StatusCode)
+	}
+}
+
+func TestWebDAV(t *testing.T) {
+	srv := testServer(t, Options{WebDAV: true})
+
+	status, body := do(t, "PROPFIND", srv.URL+"/", map[string]string{"Depth": "1"})
+	if status != 207 {
+		t.Fatalf("propfind: %d %q", status, body)
+	}
+	for _, want := range []string{"/a.txt", "/sub/", "/link", "<D:getcontentlength>15</D:getcontentlength>"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("propfind: %q missing in %q", want, body)
+		}
+	}
+
+	// nur lesend
+	for _, method := range []string{"PUT", "DELETE", "MKCOL", "MOVE", "LOCK"} {
+		if status, _ := do(t, method, srv.URL+"/a.txt", nil); status != 405 {
+			t.Fatalf("%s: %d", method, status)
+		}
+	}
+	if _, err := (&davFS{}).OpenFile(context.Background(), "/a.txt", os.O_RDWR, 0); !os.IsPermission(err) {
+		t.Fatalf("open for writing: %v", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, "127.0.0.1:0", splitfuse.New(nil, core.KeyFile{}, "index.db", nil), Options{Refresh: time.Hour})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not stop")
+	}
+}
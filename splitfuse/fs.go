@@ -0,0 +1,259 @@
+package splitfuse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"time"
+
+	"splitfuseX/core"
+)
+
+// maxSymlinks begrenzt die Anzahl der symbolischen Links, denen Open folgt (wie ELOOP unter Linux).
+const maxSymlinks = 40
+
+// FS stellt die Dateien eines Repository als io/fs.FS zur Verfügung (ohne FUSE, auch unter windows).
+// Es werden die Chunk-Auflösung und Entschlüsselung von ReadFile verwendet. Symbolische Links innerhalb des
+// Repository werden von Open verfolgt, Stat und ReadDir geben den Link selbst zurück.
+type FS struct {
+	repo *Repository
+	ctx  context.Context
+}
+
+// FS gibt das Repository als io/fs.FS (mit fs.StatFS und fs.ReadDirFS) zurück.
+// Nach dem Ende des ctx schlagen alle Lesezugriffe auf geöffnete Dateien fehl.
+func (r *Repository) FS(ctx context.Context) *FS {
+	return &FS{repo: r, ctx: ctx}
+}
+
+// HTTPFileSystem gibt das Repository als http.FileSystem zurück (zB für http.FileServer).
+func (r *Repository) HTTPFileSystem(ctx context.Context) http.FileSystem {
+	return http.FS(r.FS(ctx))
+}
+
+// Open öffnet eine Datei oder einen Ordner (siehe fs.FS).
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	p, dbFile, err := fsys.resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info := newFileInfo(name, dbFile) // wie bei os.Open der Name des Links, nicht des Ziels
+
+	switch dbFile.GetType() {
+	case core.TypeDir:
+		return &dirFile{fsys: fsys, path: p, info: info}, nil
+	case core.TypeRegular, core.TypeUnknown:
+		r, err := fsys.repo.ReadFile(fsys.ctx, p)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &regularFile{ReadSeekCloser: r, info: info}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("not a regular file or directory")}
+}
+
+// resolve sucht ein Element und folgt dabei symbolischen Links (auch in Elternordnern).
+func (fsys *FS) resolve(name string) (string, core.SfFile, error) {
+	db := fsys.repo.DB()
+	links := 0
+
+	// Element für Element auflösen, damit auch Links in Elternordnern verfolgt werden
+	todo := splitPath(name)
+	current := "."
+	for len(todo) > 0 {
+		next := path.Join(current, todo[0])
+		todo = todo[1:]
+
+		dbFile, ok := db[next]
+		if !ok {
+			return "", core.SfFile{}, fs.ErrNotExist
+		}
+		if dbFile.GetType() != core.TypeSymlink {
+			current = next
+			continue
+		}
+
+		// Link: Ziel vor den restlichen Elementen einfügen (absolute Ziele liegen außerhalb des Repository)
+		links++
+		if links > maxSymlinks || path.IsAbs(dbFile.LinkTarget) {
+			return "", core.SfFile{}, fs.ErrNotExist
+		}
+		target := path.Join(current, dbFile.LinkTarget)
+		if target == ".." || len(target) > 2 && target[:3] == "../" {
+			return "", core.SfFile{}, fs.ErrNotExist
+		}
+		todo = append(splitPath(target), todo...)
+		current = "."
+	}
+
+	dbFile, ok := db[current]
+	if !ok {
+		return "", core.SfFile{}, fs.ErrNotExist
+	}
+	return current, dbFile, nil
+}
+
+// splitPath zerlegt einen Pfad in seine Elemente ("." ergibt eine leere Liste).
+func splitPath(p string) []string {
+	ret := make([]string, 0)
+	for p != "." && p != "" {
+		dir, file := path.Split(p)
+		ret = append([]string{file}, ret...)
+		p = path.Clean(dir)
+		if p == "/" {
+			break
+		}
+	}
+	return ret
+}
+
+// Stat gibt die Attribute eines Elements zurück, ohne symbolischen Links zu folgen (siehe fs.StatFS).
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	dbFile, err := fsys.repo.Stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return newFileInfo(name, dbFile), nil
+}
+
+// ReadDir gibt den Inhalt eines Ordners sortiert zurück (siehe fs.ReadDirFS).
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	p, dbFile, err := fsys.resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if dbFile.GetType() != core.TypeDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return fsys.dirEntries(p, dbFile), nil
+}
+
+// dirEntries gibt die Elemente eines Ordners sortiert zurück. Elemente, die nicht in der DB sind, werden übersprungen.
+func (fsys *FS) dirEntries(dir string, dbFile core.SfFile) []fs.DirEntry {
+	db := fsys.repo.DB()
+	ret := make([]fs.DirEntry, 0, len(dbFile.FolderContent))
+	for _, c := range dbFile.FolderContent {
+		child, ok := db[path.Join(dir, c.Name)]
+		if !ok {
+			continue
+		}
+		ret = append(ret, fs.FileInfoToDirEntry(newFileInfo(c.Name, child)))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name() < ret[j].Name() })
+	return ret
+}
+
+// fileInfo implementiert fs.FileInfo für ein Element der DB. Sys() gibt das core.SfFile zurück.
+type fileInfo struct {
+	name   string
+	dbFile core.SfFile
+}
+
+func newFileInfo(p string, dbFile core.SfFile) *fileInfo {
+	return &fileInfo{name: path.Base(p), dbFile: dbFile}
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) ModTime() time.Time { return i.dbFile.ModTime() }
+func (i *fileInfo) IsDir() bool        { return i.dbFile.GetType() == core.TypeDir }
+func (i *fileInfo) Sys() interface{}   { return i.dbFile }
+
+func (i *fileInfo) Size() int64 {
+	if i.dbFile.GetType() == core.TypeSymlink {
+		return int64(len(i.dbFile.LinkTarget))
+	}
+	return i.dbFile.Size
+}
+
+// Mode verwendet die gleichen Standardwerte wie der Mount (0755 für Ordner, 0777 für Links, sonst 0644).
+func (i *fileInfo) Mode() fs.FileMode {
+	var mode fs.FileMode
+	switch i.dbFile.GetType() {
+	case core.TypeDir:
+		mode = fs.ModeDir | 0755
+	case core.TypeSymlink:
+		return fs.ModeSymlink | 0777
+	case core.TypeFifo:
+		mode = fs.ModeNamedPipe | 0644
+	case core.TypeSocket:
+		mode = fs.ModeSocket | 0644
+	case core.TypeCharDevice:
+		mode = fs.ModeDevice | fs.ModeCharDevice | 0644
+	case core.TypeBlockDevice:
+		mode = fs.ModeDevice | 0644
+	default:
+		mode = 0644
+	}
+
+	// Berechtigungen aus der DB (alte DBs haben keine)
+	if i.dbFile.HasPosixAttr() {
+		mode = mode&fs.ModeType | fs.FileMode(i.dbFile.Mode&0777)
+		if i.dbFile.Mode&04000 != 0 {
+			mode |= fs.ModeSetuid
+		}
+		if i.dbFile.Mode&02000 != 0 {
+			mode |= fs.ModeSetgid
+		}
+		if i.dbFile.Mode&01000 != 0 {
+			mode |= fs.ModeSticky
+		}
+	}
+	return mode
+}
+
+// regularFile ist eine geöffnete Datei (siehe ReadFile).
+type regularFile struct {
+	io.ReadSeekCloser
+	info *fileInfo
+}
+
+func (f *regularFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// dirFile ist ein geöffneter Ordner (fs.ReadDirFile).
+type dirFile struct {
+	fsys    *FS
+	path    string
+	info    *fileInfo
+	entries []fs.DirEntry // wird beim ersten ReadDir gelesen
+	offset  int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error               { return nil }
+
+func (d *dirFile) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errors.New("is a directory")}
+}
+
+// ReadDir gibt die nächsten n Elemente zurück (n <= 0: alle restlichen, siehe fs.ReadDirFile).
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		d.entries = d.fsys.dirEntries(d.path, d.info.dbFile)
+	}
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
@@ -0,0 +1,97 @@
+package splitfuse
+
+import (
+	"context"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// testFS lädt die Dateien von testRepo hoch und gibt das FS zurück.
+func testFS(t *testing.T, symlinks bool) (*FS, string) {
+	dir, _, k, client := testRepo(t)
+	if symlinks {
+		os.Symlink("sub/big.bin", filepath.Join(dir, "link"))
+		os.Symlink("../sub", filepath.Join(dir, "sub", "self"))
+		os.Symlink("/etc/passwd", filepath.Join(dir, "abs"))
+	}
+
+	repo := New(client, k, "index.db", nil)
+	if _, _, err := repo.Scan(context.Background(), dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Upload(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	return repo.FS(context.Background()), dir
+}
+
+func TestFS(t *testing.T) {
+	fsys, _ := testFS(t, false)
+	if err := fstest.TestFS(fsys, "a.txt", "empty", "sub/big.bin", "sub/copy"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSSymlinks(t *testing.T) {
+	fsys, dir := testFS(t, true)
+	want, _ := ioutil.ReadFile(filepath.Join(dir, "sub/big.bin"))
+
+	// Open folgt Links (auch in Elternordnern)
+	for _, name := range []string{"link", "sub/self/big.bin", "sub/self/self/copy"} {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if name != "sub/self/self/copy" && string(b) != string(want) {
+			t.Fatalf("%s: wrong content", name)
+		}
+	}
+	if _, err := fsys.Open("abs"); !os.IsNotExist(err) {
+		t.Fatalf("absolute link must not be followed: %v", err)
+	}
+
+	// Stat gibt den Link selbst zurück
+	info, err := fsys.Stat("link")
+	if err != nil || info.Mode()&fs.ModeSymlink == 0 || info.Size() != int64(len("sub/big.bin")) {
+		t.Fatalf("stat link: %v, %v", info, err)
+	}
+	entries, err := fs.ReadDir(fsys, "sub/self")
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("readdir through link: %v, %v", entries, err)
+	}
+}
+
+func TestHTTPFileSystem(t *testing.T) {
+	fsys, dir := testFS(t, false)
+	srv := httptest.NewServer(http.FileServer(fsys.repo.HTTPFileSystem(context.Background())))
+	defer srv.Close()
+
+	// Range-Request (http.ServeContent verwendet Seek)
+	req, _ := http.NewRequest("GET", srv.URL+"/sub/big.bin", nil)
+	req.Header.Set("Range", "bytes=1000-1099")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	want, _ := ioutil.ReadFile(filepath.Join(dir, "sub/big.bin"))
+	if resp.StatusCode != http.StatusPartialContent || string(b) != string(want[1000:1100]) {
+		t.Fatalf("range request: status %d, %d bytes", resp.StatusCode, len(b))
+	}
+
+	resp, err = http.Get(srv.URL + "/nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing file: status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,150 @@
+package splitfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"splitfuseX/core"
+)
+
+// ReadFile öffnet eine Datei der DB zum Lesen. Die Chunks werden beim Lesen aus dem Speicher geladen und entschlüsselt.
+// Nach dem Ende des ctx geben alle Aufrufe von Read den Fehler des ctx zurück.
+// ACHTUNG: Am Ende .Close() nicht vergessen!
+func (r *Repository) ReadFile(ctx context.Context, name string) (io.ReadSeekCloser, error) {
+	dbFile, err := r.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !dbFile.IsRegular() {
+		return nil, &os.PathError{Op: "open", Path: cleanPath(name), Err: errors.New("not a regular file")}
+	}
+
+	// Ohne FileList können die Chunks nicht gefunden werden
+	if len(r.client.FileList()) == 0 {
+		if err := r.client.InitFileListContext(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return &fileReader{ctx: ctx, repo: r, name: cleanPath(name), file: dbFile, stored: r.storedChunks()}, nil
+}
+
+// fileReader liest eine Datei Chunk für Chunk. Solange sequentiell gelesen wird, bleibt die Verbindung zum Speicher offen.
+type fileReader struct {
+	ctx    context.Context
+	repo   *Repository
+	name   string
+	file   core.SfFile
+	stored map[chunkKey]string // Chunks im Speicher -> fileId
+	offset int64               // aktuelle Position in der Datei
+
+	// offene Verbindung zu einem Chunk
+	resp       io.ReadCloser
+	respChunk  int    // Nummer des Chunks
+	respOffset int64  // Position im Chunk (nächstes Byte von resp)
+	respKey    []byte // Schlüssel des Chunks
+}
+
+// Read liest ab der aktuellen Position, aber nie über das Ende eines Chunks hinaus.
+func (f *fileReader) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if f.offset >= f.file.Size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// Chunk und Position im Chunk berechnen
+	chunkNr := int(f.offset / core.CHUNKSIZE)
+	chunkOffset := f.offset % core.CHUNKSIZE
+	chunkSize := core.CalcChunkSize(chunkNr, f.file.Size)
+	if remaining := chunkSize - chunkOffset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	// Verbindung (neu) öffnen
+	if f.resp == nil || f.respChunk != chunkNr || f.respOffset != chunkOffset {
+		if err := f.open(chunkNr, chunkOffset, chunkSize); err != nil {
+			return 0, err
+		}
+	}
+
+	// lesen und entschlüsseln
+	n, err := f.resp.Read(p)
+	if n > 0 {
+		if cryptErr := core.CryptBytes(p[:n], chunkOffset, f.respKey); cryptErr != nil {
+			return 0, cryptErr
+		}
+		f.offset += int64(n)
+		f.respOffset += int64(n)
+	}
+	if err == io.EOF {
+		// Der Chunk ist zu kurz
+		if f.respOffset < chunkSize {
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// open öffnet eine Verbindung zu einem Chunk ab dem offset.
+func (f *fileReader) open(chunkNr int, chunkOffset, chunkSize int64) error {
+	f.closeResp()
+
+	hash := f.file.FileChunks[chunkNr]
+	name := fmt.Sprintf("%x", f.repo.keyFile.CalcChunkName(hash[:]))
+	fileId, ok := f.stored[chunkKey{name, chunkSize}]
+	if !ok {
+		return fmt.Errorf("chunk %d of '%s' not found in storage", chunkNr, f.name)
+	}
+
+	// das dritte Argument ist das letzte Byte (inklusive), nicht die Länge (siehe drive.ApiClient.Read)
+	resp, err := f.repo.client.ReadContext(f.ctx, fileId, chunkOffset, chunkSize-1)
+	if err != nil {
+		return err
+	}
+	f.resp = resp
+	f.respChunk = chunkNr
+	f.respOffset = chunkOffset
+	f.respKey = f.repo.keyFile.CalcChunkKey(hash[:])
+	return nil
+}
+
+// Seek setzt die Position für das nächste Read (siehe io.Seeker).
+func (f *fileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.file.Size
+	default:
+		return f.offset, errors.New("seek: invalid whence")
+	}
+	if offset < 0 {
+		return f.offset, errors.New("seek: negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close schließt die offene Verbindung zum Speicher.
+func (f *fileReader) Close() error {
+	return f.closeResp()
+}
+
+func (f *fileReader) closeResp() error {
+	if f.resp == nil {
+		return nil
+	}
+	err := f.resp.Close()
+	f.resp = nil
+	return err
+}
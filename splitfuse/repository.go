@@ -0,0 +1,330 @@
+// Package splitfuse bündelt Keyfile, Speicher (backbone.Client) und DB zu einem Repository.
+// Damit können andere Programme Backups erstellen, prüfen und lesen, ohne die Kommandozeile aufzurufen.
+package splitfuse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"splitfuseX/backbone"
+	"splitfuseX/core"
+	"splitfuseX/logging"
+)
+
+// ErrNoDb wird von Open zurück gegeben, wenn im Speicher (noch) keine DB liegt (siehe New).
+var ErrNoDb = errors.New("no db file found")
+
+// Repository ist ein Speicher mit Chunks und der dazugehörigen DB.
+// Alle Methoden können gleichzeitig aufgerufen werden. Lange Operationen brechen ab, sobald der ctx beendet wird.
+type Repository struct {
+	mutex       *sync.Mutex // schützt db, dbMtime und initialized
+	client      backbone.Client
+	keyFile     core.KeyFile
+	dbFileName  string // Name der DB im Speicher (zB index.db)
+	db          core.SfDb
+	dbMtime     int64 // ModifiedTime der geladenen DB im Speicher (0 = nicht aus dem Speicher geladen)
+	initialized bool  // FileList wurde von Refresh initialisiert
+}
+
+// New erzeugt ein Repository mit einer vorhandenen DB (zB von core.DbFromFile). nil ist eine leere DB.
+// Der Speicher wird dabei nicht gelesen, die FileList wird erst bei Bedarf initialisiert.
+func New(client backbone.Client, keyFile core.KeyFile, dbFileName string, db core.SfDb) *Repository {
+	if db == nil {
+		db = core.SfDb{}
+	}
+	return &Repository{
+		mutex:      &sync.Mutex{},
+		client:     client,
+		keyFile:    keyFile,
+		dbFileName: dbFileName,
+		db:         db,
+	}
+}
+
+// Open lädt die neueste DB mit dem Namen dbFileName aus dem Speicher.
+// Gibt es noch keine DB, dann wird ErrNoDb zurück gegeben.
+func Open(ctx context.Context, client backbone.Client, keyFile core.KeyFile, dbFileName string) (*Repository, error) {
+	r := New(client, keyFile, dbFileName, nil)
+	if _, err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Refresh aktualisiert die FileList und lädt die neueste DB aus dem Speicher, wenn sie sich verändert hat
+// (wie das regelmäßige Update des Mounts). Im Fehlerfall bleibt die bisherige DB erhalten.
+// Gibt es keine DB im Speicher, dann wird ErrNoDb zurück gegeben.
+func (r *Repository) Refresh(ctx context.Context) (changed bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	// Beim ersten Mal muss die FileList initialisiert werden
+	r.mutex.Lock()
+	initialized, lastDbMtime := r.initialized, r.dbMtime
+	r.mutex.Unlock()
+	if initialized {
+		err = r.client.UpdateFileListContext(ctx)
+	} else {
+		err = r.client.InitFileListContext(ctx)
+	}
+	if err != nil {
+		return false, err
+	}
+	r.mutex.Lock()
+	r.initialized = true
+	r.mutex.Unlock()
+
+	// neueste DB suchen
+	newestFile := &backbone.FileObject{}
+	for _, file := range r.client.FileList() {
+		if file.Name == r.dbFileName && newestFile.ModifiedTime < file.ModifiedTime {
+			newestFile = file
+		}
+	}
+	if newestFile.ModifiedTime <= 0 {
+		return false, ErrNoDb
+	}
+	if newestFile.ModifiedTime == lastDbMtime {
+		return false, nil
+	}
+
+	// download und entschlüsseln
+	resp, err := r.client.ReadContext(ctx, newestFile.Id, 0, newestFile.Size)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Close()
+	db, err := core.DbFromReader(resp, r.keyFile.DbKey())
+	if err != nil {
+		return false, fmt.Errorf("can't decrypt db file: %v", err)
+	}
+
+	r.mutex.Lock()
+	r.db = db
+	r.dbMtime = newestFile.ModifiedTime
+	r.mutex.Unlock()
+	return true, nil
+}
+
+// DB gibt die aktuelle DB zurück.
+// ACHTUNG: Die DB darf nicht verändert werden (Scan ersetzt sie durch eine neue).
+func (r *Repository) DB() core.SfDb {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.db
+}
+
+// Scan liest den Ordner dir ein und ersetzt die DB (siehe core.ScanFolder). Die DB im Speicher bleibt unverändert (siehe Upload).
+// HINWEIS: Der ctx wird vor und nach dem Scan geprüft, ein laufender Scan wird nicht unterbrochen.
+func (r *Repository) Scan(ctx context.Context, dir string, filter *core.Filter) (changed bool, summary string, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, "", err
+	}
+	newDB, changed, summary, err := core.ScanFolder(dir, r.DB(), filter)
+	if err != nil {
+		return false, summary, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, summary, err
+	}
+
+	r.mutex.Lock()
+	r.db = newDB
+	r.mutex.Unlock()
+	return changed, summary, nil
+}
+
+// chunk ist ein Chunk einer Datei der DB.
+type chunk struct {
+	path  string // Pfad der Datei in der DB
+	nr    int    // Nummer des Chunks in der Datei
+	hash  core.ChunkHash
+	name  string // Dateiname im Speicher
+	size  int64
+	start int64 // offset des Chunks in der Datei
+}
+
+// chunks gibt alle Chunks der DB zurück.
+func (r *Repository) chunks(db core.SfDb) []chunk {
+	ret := make([]chunk, 0)
+	for p, dbFile := range db {
+		for i, hash := range dbFile.FileChunks {
+			ret = append(ret, chunk{
+				path:  p,
+				nr:    i,
+				hash:  hash,
+				name:  fmt.Sprintf("%x", r.keyFile.CalcChunkName(hash[:])),
+				size:  core.CalcChunkSize(i, dbFile.Size),
+				start: int64(i) * core.CHUNKSIZE,
+			})
+		}
+	}
+	return ret
+}
+
+// chunkKey identifiziert einen Chunk im Speicher (Name und Größe).
+type chunkKey struct {
+	name string
+	size int64
+}
+
+// storedChunks gibt alle Dateien im Speicher zurück (Name und Größe -> fileId).
+// Die FileList muss bereits initialisiert sein.
+func (r *Repository) storedChunks() map[chunkKey]string {
+	ret := make(map[chunkKey]string)
+	for fileId, file := range r.client.FileList() {
+		ret[chunkKey{file.Name, file.Size}] = fileId
+	}
+	return ret
+}
+
+// Upload lädt alle Chunks der DB, die noch nicht im Speicher sind, aus dem Ordner dir hoch (verschlüsselt).
+// Danach wird die aktuelle DB gespeichert und erst dann werden alle alten DBs im Speicher gelöscht.
+// Wird der ctx vorher beendet, dann bleibt die alte DB im Speicher (bereits hochgeladene Chunks bleiben erhalten).
+func (r *Repository) Upload(ctx context.Context, dir string) (uploaded int, err error) {
+	db := r.DB()
+	if err := r.client.InitFileListContext(ctx); err != nil {
+		return 0, err
+	}
+	stored := r.storedChunks()
+
+	for _, c := range r.chunks(db) {
+		if _, ok := stored[chunkKey{c.name, c.size}]; ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return uploaded, err
+		}
+		if err := r.uploadChunk(ctx, dir, c); err != nil {
+			return uploaded, fmt.Errorf("can't upload chunk %d of '%s': %v", c.nr, c.path, err)
+		}
+		stored[chunkKey{c.name, c.size}] = ""
+		uploaded++
+		logging.Debug("upload: chunk", logging.Path(c.path), logging.Chunk(c.nr), logging.F("size", c.size))
+	}
+	if err := ctx.Err(); err != nil {
+		return uploaded, err
+	}
+
+	// DB hochladen (ganz am Ende): zuerst die neue DB speichern, danach die alten löschen.
+	// So bleibt immer eine DB im Speicher, auch wenn der ctx dazwischen beendet wird.
+	var buf bytes.Buffer
+	if err := core.DbToWriter(&buf, r.keyFile.DbKey(), db); err != nil {
+		return uploaded, err
+	}
+	// bytes.Reader ist ein io.Seeker, damit der Upload bei vorübergehenden Fehlern wiederholt werden kann
+	newId, err := r.client.SaveContext(ctx, r.dbFileName, bytes.NewReader(buf.Bytes()), 0)
+	if err != nil {
+		return uploaded, err
+	}
+
+	// Das Löschen wird nicht mehr abgebrochen, sonst bleiben unnötig alte DBs liegen.
+	// Gelöscht wird jede andere DB. Manche Speicher überschreiben eine gleichnamige Datei unter derselben fileId
+	// (zB local), die neue DB wird daher nur über ihre fileId erkannt.
+	ctx = context.WithoutCancel(ctx)
+	if err := r.client.UpdateFileListContext(ctx); err != nil {
+		return uploaded, err
+	}
+	for fileId, file := range r.client.FileList() {
+		if file.Name == r.dbFileName && fileId != newId {
+			if err := r.client.TrashContext(ctx, fileId); err != nil {
+				return uploaded, err
+			}
+		}
+	}
+	return uploaded, nil
+}
+
+// uploadChunk liest einen Chunk aus der Klartextdatei und speichert ihn verschlüsselt.
+func (r *Repository) uploadChunk(ctx context.Context, dir string, c chunk) error {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(c.path)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// io.SectionReader kann zurückgespult werden, damit der Upload bei vorübergehenden Fehlern wiederholt werden kann
+	section := io.NewSectionReader(f, c.start, c.size)
+	_, err = r.client.SaveContext(ctx, c.name, core.CryptReader(section, r.keyFile.CalcChunkKey(c.hash[:])), c.size)
+	return err
+}
+
+// Orphans gibt alle Chunks im Speicher zurück, die nicht (mehr) in der DB sind oder deren Größe nicht passt.
+// Es werden nur Dateien berücksichtigt, die anhand des Namens ein Chunk sein können (128 Zeichen).
+func (r *Repository) Orphans(ctx context.Context) ([]*backbone.FileObject, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.client.InitFileListContext(ctx); err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[chunkKey]bool)
+	for _, c := range r.chunks(r.DB()) {
+		wanted[chunkKey{c.name, c.size}] = true
+	}
+
+	ret := make([]*backbone.FileObject, 0)
+	for _, file := range r.client.FileList() {
+		if len(file.Name) == 128 && !wanted[chunkKey{file.Name, file.Size}] {
+			ret = append(ret, file)
+		}
+	}
+	return ret, nil
+}
+
+// Clean löscht alle Chunks, die nicht mehr in der DB sind (siehe Orphans), und gibt sie zurück.
+// ACHTUNG: Die DB muss vorher mit Scan aktualisiert (oder mit Open geladen) werden, sonst gehen Daten verloren!
+func (r *Repository) Clean(ctx context.Context) (removed []*backbone.FileObject, err error) {
+	orphans, err := r.Orphans(ctx)
+	if err != nil {
+		return nil, err
+	}
+	removed = make([]*backbone.FileObject, 0, len(orphans))
+	for _, file := range orphans {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		if err := r.client.TrashContext(ctx, file.Id); err != nil {
+			return removed, err
+		}
+		removed = append(removed, file)
+	}
+	return removed, nil
+}
+
+// Stat gibt das Element der DB zurück. Der Pfad ist relativ zum Root ("." oder "" ist der Root).
+// Gibt es das Element nicht, dann wird ein *os.PathError mit os.ErrNotExist zurück gegeben.
+func (r *Repository) Stat(name string) (core.SfFile, error) {
+	name = cleanPath(name)
+	dbFile, ok := r.DB()[name]
+	if !ok {
+		return core.SfFile{}, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return dbFile, nil
+}
+
+// ReadDir gibt den Inhalt eines Ordners zurück.
+func (r *Repository) ReadDir(name string) ([]core.FolderContent, error) {
+	dbFile, err := r.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if dbFile.GetType() != core.TypeDir {
+		return nil, &os.PathError{Op: "readdir", Path: cleanPath(name), Err: errors.New("not a directory")}
+	}
+	return dbFile.FolderContent, nil
+}
+
+// cleanPath wandelt einen Pfad in den Key der DB um (ohne führenden Slash, der Root ist ".").
+func cleanPath(name string) string {
+	return path.Clean(strings.TrimPrefix(path.Clean("/"+name), "/"))
+}
@@ -0,0 +1,404 @@
+package splitfuse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"splitfuseX/backbone"
+	"splitfuseX/backbone/local"
+	"splitfuseX/core"
+)
+
+// testRepo erstellt einen Ordner mit Klartext Dateien, ein Keyfile und einen lokalen Speicher.
+func testRepo(t *testing.T) (dir string, chunkDir string, k core.KeyFile, client backbone.Client) {
+	root := t.TempDir()
+	dir = filepath.Join(root, "orig")
+	chunkDir = filepath.Join(root, "chunks")
+	for _, d := range []string{dir, chunkDir, filepath.Join(dir, "sub")} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	big := make([]byte, 300000)
+	rand.New(rand.NewSource(42)).Read(big)
+	files := map[string][]byte{
+		"a.txt":       []byte("hello splitfuse"),
+		"empty":       {},
+		"sub/big.bin": big,
+		"sub/copy":    []byte("hello splitfuse"),
+	}
+	for name, b := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keyPath := filepath.Join(root, "key")
+	if err := core.NewRandomKeyfile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	k, err := core.LoadKeyfile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, chunkDir, k, local.NewDiskClient(chunkDir)
+}
+
+func TestUploadAndOpen(t *testing.T) {
+	dir, chunkDir, k, client := testRepo(t)
+	ctx := context.Background()
+
+	if _, err := Open(ctx, client, k, "index.db"); err != ErrNoDb {
+		t.Fatalf("expected ErrNoDb, got %v", err)
+	}
+
+	// scan und upload (gleiche Chunks nur einmal)
+	repo := New(client, k, "index.db", nil)
+	changed, _, err := repo.Scan(ctx, dir, nil)
+	if err != nil || !changed {
+		t.Fatalf("scan: changed=%v, err=%v", changed, err)
+	}
+	uploaded, err := repo.Upload(ctx, dir)
+	if err != nil || uploaded != 2 {
+		t.Fatalf("upload: %d chunks, err=%v", uploaded, err)
+	}
+	if uploaded, err := repo.Upload(ctx, dir); err != nil || uploaded != 0 {
+		t.Fatalf("second upload: %d chunks, err=%v", uploaded, err)
+	}
+
+	// DB aus dem Speicher laden
+	repo, err = Open(ctx, local.NewDiskClient(chunkDir), k, "index.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, err := repo.Stat("/sub/big.bin"); err != nil || f.Size != 300000 {
+		t.Fatalf("stat: %+v, %v", f, err)
+	}
+	if _, err := repo.Stat("nope"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stat nope: %v", err)
+	}
+	content, err := repo.ReadDir("sub")
+	if err != nil || len(content) != 2 {
+		t.Fatalf("readdir: %v, %v", content, err)
+	}
+	if _, err := repo.ReadDir("a.txt"); err == nil {
+		t.Fatal("readdir of a file should fail")
+	}
+
+	// Dateien lesen
+	for _, name := range []string{"a.txt", "empty", "sub/big.bin"} {
+		want, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		f, err := repo.ReadFile(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("%s: read %d bytes (want %d), err=%v", name, len(got), len(want), err)
+		}
+	}
+
+	// Seek
+	want, _ := ioutil.ReadFile(filepath.Join(dir, "sub/big.bin"))
+	f, err := repo.ReadFile(ctx, "sub/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, off := range []int64{123457, 17, 299990} {
+		if _, err := f.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 100)
+		n, err := io.ReadFull(f, b)
+		if end := off + int64(n); !bytes.Equal(b[:n], want[off:end]) || (err != nil && end != 300000) {
+			t.Fatalf("offset %d: %d bytes, err=%v", off, n, err)
+		}
+	}
+	if pos, _ := f.Seek(-10, io.SeekEnd); pos != 299990 {
+		t.Fatalf("seek end: %d", pos)
+	}
+}
+
+// rangeClient liest wie drive nur bis zum angegebenen letzten Byte (inklusive).
+type rangeClient struct {
+	backbone.Client
+}
+
+func (c *rangeClient) ReadContext(ctx context.Context, fileId string, offset int64, fileSize int64) (io.ReadCloser, error) {
+	if fileSize < offset {
+		return nil, fmt.Errorf("invalid range: bytes=%d-%d", offset, fileSize)
+	}
+	r, err := c.Client.ReadContext(ctx, fileId, offset, fileSize)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(r, fileSize-offset+1), r}, nil
+}
+
+func TestReadRange(t *testing.T) {
+	dir, chunkDir, k, client := testRepo(t)
+	ctx := context.Background()
+	repo := New(client, k, "index.db", nil)
+	if _, _, err := repo.Scan(ctx, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Upload(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// mitten in einem Chunk beginnen
+	repo, err := Open(ctx, &rangeClient{local.NewDiskClient(chunkDir)}, k, "index.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := ioutil.ReadFile(filepath.Join(dir, "sub/big.bin"))
+	f, err := repo.ReadFile(ctx, "sub/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, off := range []int64{200000, 150001, 1} {
+		if _, err := f.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(f)
+		if err != nil || !bytes.Equal(got, want[off:]) {
+			t.Fatalf("offset %d: read %d bytes (want %d), err=%v", off, len(got), len(want)-int(off), err)
+		}
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	dir, chunkDir, k, client := testRepo(t)
+	ctx := context.Background()
+
+	repo := New(client, k, "index.db", nil)
+	if _, _, err := repo.Scan(ctx, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Upload(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := Open(ctx, local.NewDiskClient(chunkDir), k, "index.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := reader.Refresh(ctx); err != nil || changed {
+		t.Fatalf("unchanged db: changed=%v, err=%v", changed, err)
+	}
+
+	// neue Datei hochladen (mtime der DB verändern, da der lokale Speicher nur Sekunden kennt)
+	ioutil.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0600)
+	if _, _, err := repo.Scan(ctx, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Upload(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(chunkDir, "index.db"), future, future)
+	if changed, err := reader.Refresh(ctx); err != nil || !changed {
+		t.Fatalf("new db: changed=%v, err=%v", changed, err)
+	}
+	if _, err := reader.Stat("new.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// ohne DB bleibt die bisherige erhalten
+	os.Remove(filepath.Join(chunkDir, "index.db"))
+	if _, err := reader.Refresh(ctx); err != ErrNoDb {
+		t.Fatalf("expected ErrNoDb, got %v", err)
+	}
+	if _, err := reader.Stat("new.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyAndClean(t *testing.T) {
+	dir, chunkDir, k, client := testRepo(t)
+	ctx := context.Background()
+
+	repo := New(client, k, "index.db", nil)
+	if _, _, err := repo.Scan(ctx, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Upload(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := repo.Verify(ctx, true); err != nil || len(problems) != 0 {
+		t.Fatalf("verify: %v, %v", problems, err)
+	}
+
+	// alter Chunk (128 Zeichen) wird gelöscht, andere Dateien nicht
+	orphan := strings.Repeat("ab", 64)
+	ioutil.WriteFile(filepath.Join(chunkDir, orphan), []byte("old"), 0600)
+	ioutil.WriteFile(filepath.Join(chunkDir, "notes.txt"), []byte("keep"), 0600)
+	removed, err := repo.Clean(ctx)
+	if err != nil || len(removed) != 1 || removed[0].Name != orphan {
+		t.Fatalf("clean: %v, %v", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(chunkDir, "notes.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Chunk beschädigen (gleiche Größe)
+	big, _ := repo.Stat("sub/big.bin")
+	bigName := filepath.Join(chunkDir, hexName(k, big.FileChunks[0]))
+	b, _ := ioutil.ReadFile(bigName)
+	b[1000] ^= 0xff
+	ioutil.WriteFile(bigName, b, 0600)
+	if problems, _ := repo.Verify(ctx, false); len(problems) != 0 {
+		t.Fatalf("verify without deep: %v", problems)
+	}
+	problems, err := repo.Verify(ctx, true)
+	if err != nil || len(problems) != 1 || problems[0].Path != "sub/big.bin" || problems[0].Err != ErrChunkCorrupt {
+		t.Fatalf("verify corrupt: %v, %v", problems, err)
+	}
+
+	// Chunk löschen (betrifft beide Dateien mit gleichem Inhalt)
+	a, _ := repo.Stat("a.txt")
+	os.Remove(filepath.Join(chunkDir, hexName(k, a.FileChunks[0])))
+	problems, err = repo.Verify(ctx, false)
+	if err != nil || len(problems) != 2 || problems[0].Path != "a.txt" || problems[1].Path != "sub/copy" || problems[0].Err != ErrChunkMissing {
+		t.Fatalf("verify missing: %v, %v", problems, err)
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	dir, _, k, client := testRepo(t)
+
+	repo := New(client, k, "index.db", nil)
+	if _, _, err := repo.Scan(context.Background(), dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := repo.Upload(ctx, dir); err != context.Canceled {
+		t.Fatalf("upload: %v", err)
+	}
+	if _, err := Open(context.Background(), client, k, "index.db"); err != ErrNoDb {
+		t.Fatalf("canceled upload must not write the db: %v", err)
+	}
+
+	if _, err := repo.Upload(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	f, err := repo.ReadFile(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Read(make([]byte, 10)); err != context.Canceled {
+		t.Fatalf("read: %v", err)
+	}
+}
+
+// cancelOnSave beendet den ctx, sobald die DB gespeichert werden soll (wie Ctrl-C zwischen Chunks und DB).
+type cancelOnSave struct {
+	backbone.Client
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnSave) SaveContext(ctx context.Context, fileName string, file io.Reader, maxRead int64) (string, error) {
+	if fileName == "index.db" {
+		c.cancel()
+	}
+	return c.Client.SaveContext(ctx, fileName, file, maxRead)
+}
+
+func TestCanceledKeepsDb(t *testing.T) {
+	dir, _, k, client := testRepo(t)
+	ctx := context.Background()
+	repo := New(client, k, "index.db", nil)
+	repo.Scan(ctx, dir, nil)
+	if _, err := repo.Upload(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// neue DB, deren Upload abgebrochen wird
+	ioutil.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0600)
+	if _, _, err := repo.Scan(ctx, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	cancelCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	canceled := New(&cancelOnSave{Client: client, cancel: cancel}, k, "index.db", repo.DB())
+	if _, err := canceled.Upload(cancelCtx, dir); err != context.Canceled {
+		t.Fatalf("upload: %v", err)
+	}
+
+	// die alte DB ist noch da
+	old, err := Open(ctx, client, k, "index.db")
+	if err != nil {
+		t.Fatalf("old db lost: %v", err)
+	}
+	if _, err := old.Stat("new.txt"); err == nil {
+		t.Fatal("expected the old db")
+	}
+}
+
+func hexName(k core.KeyFile, hash core.ChunkHash) string {
+	return fmt.Sprintf("%x", k.CalcChunkName(hash[:]))
+}
+
+// otherDb fügt der Dateiliste eine weitere DB hinzu, die in derselben Sekunde wie der Upload geändert wurde.
+type otherDb struct {
+	backbone.Client
+	trashed bool
+}
+
+func (c *otherDb) FileList() map[string]*backbone.FileObject {
+	ret := make(map[string]*backbone.FileObject)
+	for id, file := range c.Client.FileList() {
+		ret[id] = file
+	}
+	if !c.trashed {
+		ret["other-db"] = &backbone.FileObject{Id: "other-db", Name: "index.db", ModifiedTime: time.Now().Unix()}
+	}
+	return ret
+}
+
+func (c *otherDb) TrashContext(ctx context.Context, fileId string) error {
+	if fileId == "other-db" {
+		c.trashed = true
+		return nil
+	}
+	return c.Client.TrashContext(ctx, fileId)
+}
+
+func TestUploadTrashesOtherDbs(t *testing.T) {
+	dir, _, k, client := testRepo(t)
+	ctx := context.Background()
+	other := &otherDb{Client: client}
+	repo := New(other, k, "index.db", nil)
+	repo.Scan(ctx, dir, nil)
+	if _, err := repo.Upload(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+	if !other.trashed {
+		t.Fatal("other db was not trashed")
+	}
+
+	// die neue DB bleibt erhalten
+	if _, err := Open(ctx, client, k, "index.db"); err != nil {
+		t.Fatalf("new db lost: %v", err)
+	}
+}
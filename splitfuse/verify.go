@@ -0,0 +1,100 @@
+package splitfuse
+
+import (
+	"context"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"splitfuseX/core"
+)
+
+var (
+	// ErrChunkMissing bedeutet, dass ein Chunk der DB nicht im Speicher ist.
+	ErrChunkMissing = errors.New("chunk missing")
+
+	// ErrChunkCorrupt bedeutet, dass der Inhalt eines Chunks nicht zum hash in der DB passt.
+	ErrChunkCorrupt = errors.New("chunk corrupt")
+)
+
+// Problem ist ein Fehler, den Verify bei einem Chunk gefunden hat.
+type Problem struct {
+	Path  string // Pfad der Datei in der DB
+	Chunk int    // Nummer des Chunks in der Datei
+	Err   error  // ErrChunkMissing, ErrChunkCorrupt oder ein Fehler beim Lesen
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s (chunk %d): %v", p.Path, p.Chunk, p.Err)
+}
+
+// Verify prüft, ob alle Chunks der DB im Speicher sind (Name und Größe).
+// Mit deep wird jeder Chunk zusätzlich heruntergeladen, entschlüsselt und mit dem hash der DB verglichen (langsam!).
+// Die gefundenen Probleme werden sortiert zurück gegeben, err ist nur bei einem Abbruch gesetzt (zB durch den ctx).
+func (r *Repository) Verify(ctx context.Context, deep bool) ([]Problem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.client.InitFileListContext(ctx); err != nil {
+		return nil, err
+	}
+	stored := r.storedChunks()
+
+	problems := make([]Problem, 0)
+	verified := make(map[chunkKey]error) // gleiche Chunks (zB Hardlinks oder Kopien) nur einmal laden
+	for _, c := range r.chunks(r.DB()) {
+		if err := ctx.Err(); err != nil {
+			return problems, err
+		}
+
+		key := chunkKey{c.name, c.size}
+		fileId, ok := stored[key]
+		if !ok {
+			problems = append(problems, Problem{Path: c.path, Chunk: c.nr, Err: ErrChunkMissing})
+			continue
+		}
+		if !deep {
+			continue
+		}
+
+		err, done := verified[key]
+		if !done {
+			err = r.verifyChunk(ctx, fileId, c)
+			verified[key] = err
+		}
+		if err != nil {
+			problems = append(problems, Problem{Path: c.path, Chunk: c.nr, Err: err})
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Path != problems[j].Path {
+			return problems[i].Path < problems[j].Path
+		}
+		return problems[i].Chunk < problems[j].Chunk
+	})
+	return problems, nil
+}
+
+// verifyChunk lädt einen Chunk herunter und vergleicht den hash des Klartexts.
+func (r *Repository) verifyChunk(ctx context.Context, fileId string, c chunk) error {
+	resp, err := r.client.ReadContext(ctx, fileId, 0, c.size)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	h := sha512.New()
+	n, err := io.Copy(h, core.CryptReader(io.LimitReader(resp, c.size), r.keyFile.CalcChunkKey(c.hash[:])))
+	if err != nil {
+		return err
+	}
+	var sum core.ChunkHash
+	copy(sum[:], h.Sum(nil))
+	if n != c.size || sum != c.hash {
+		return ErrChunkCorrupt
+	}
+	return nil
+}
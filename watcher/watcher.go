@@ -0,0 +1,205 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"splitfuseX/core"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher beobachtet einen Ordner rekursiv (inotify) und meldet geänderte Elemente als relative Pfade.
+// Ein Element wird erst gemeldet, wenn es für die Dauer von settle nicht mehr verändert wurde.
+// Damit werden zB Dateien, die gerade kopiert werden, nicht mehrfach gehasht.
+type Watcher struct {
+	root   string
+	settle time.Duration
+	filter *core.Filter // nur die Einstellungen, jede Suche nach Ordnern verwendet eine eigene Kopie
+	fsw    *fsnotify.Watcher
+
+	mutex   *sync.Mutex
+	pending map[string]time.Time // relativer Pfad -> letztes Event
+
+	changes chan []string
+	errors  chan error
+	done    chan bool
+}
+
+// NewWatcher beobachtet den Ordner root mit allen Unterordnern.
+// Symbolische Links werden nicht verfolgt. Ordner, die der filter ausschließt, werden nicht beobachtet (nil beobachtet alle).
+func NewWatcher(root string, settle time.Duration, filter *core.Filter) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		root:    root,
+		settle:  settle,
+		filter:  filter.Clone(),
+		fsw:     fsw,
+		mutex:   &sync.Mutex{},
+		pending: make(map[string]time.Time),
+		changes: make(chan []string, 1),
+		errors:  make(chan error, 10),
+		done:    make(chan bool),
+	}
+
+	// alle Ordner hinzufügen
+	if err := w.addRecursive(root); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	go w.loop()
+	return w, nil
+}
+
+// Changes liefert Listen mit relativen Pfaden, die sich geändert haben (neu, geändert oder gelöscht).
+// Der Pfad '.' bedeutet, dass der ganze Ordner neu gescannt werden muss (zB bei einem Überlauf der Events).
+func (w *Watcher) Changes() <-chan []string {
+	return w.changes
+}
+
+// Errors liefert Fehler, die beim Beobachten auftreten. Der Watcher läuft dabei weiter.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Close beendet das Beobachten.
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.fsw.Close()
+}
+
+// addRecursive fügt den Ordner und alle Unterordner zum inotify Watcher hinzu.
+// Ausgeschlossene Ordner werden mit ihrem Inhalt übersprungen. Der Filter wird dabei jedes Mal neu aufgebaut,
+// damit geänderte Ignore-Dateien berücksichtigt werden.
+func (w *Watcher) addRecursive(dir string) error {
+	filter := w.filter.Clone()
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // schon wieder gelöscht
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(w.root, path)
+		if err != nil {
+			return err
+		}
+		skip, err := filter.SkipPath(w.root, rel, info)
+		if err != nil {
+			return err
+		}
+		if skip {
+			return filepath.SkipDir
+		}
+		return w.fsw.Add(path)
+	})
+}
+
+// loop verarbeitet die inotify Events und meldet beruhigte Elemente.
+func (w *Watcher) loop() {
+	tick := w.settle / 4
+	if tick < 100*time.Millisecond {
+		tick = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			if err == fsnotify.ErrEventOverflow {
+				// Events sind verloren gegangen -> alles neu scannen
+				w.mark(".")
+			}
+			w.sendError(err)
+
+		case <-ticker.C:
+			w.flush()
+		}
+	}
+}
+
+// handleEvent merkt sich das betroffene Element. Neue Ordner werden ebenfalls beobachtet.
+func (w *Watcher) handleEvent(event fsnotify.Event) {
+	rel, err := filepath.Rel(w.root, event.Name)
+	if err != nil {
+		w.sendError(err)
+		return
+	}
+	w.mark(rel)
+
+	// neuer Ordner: beobachten (der Inhalt wird mit dem Ordner selbst gescannt)
+	if event.Op&fsnotify.Create != 0 {
+		if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+			if err := w.addRecursive(event.Name); err != nil {
+				w.sendError(err)
+			}
+		}
+	}
+}
+
+// mark merkt sich ein Element mit dem Zeitpunkt des letzten Events.
+func (w *Watcher) mark(rel string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.pending[rel] = time.Now()
+}
+
+// flush meldet alle Elemente, deren letztes Event länger als settle zurück liegt.
+// Ist der Empfänger noch beschäftigt, dann werden sie beim nächsten Mal gemeldet.
+func (w *Watcher) flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	now := time.Now()
+	list := make([]string, 0)
+	for rel, last := range w.pending {
+		if now.Sub(last) >= w.settle {
+			list = append(list, rel)
+		}
+	}
+	if len(list) == 0 {
+		return
+	}
+	sort.Strings(list)
+
+	select {
+	case w.changes <- list:
+		for _, rel := range list {
+			delete(w.pending, rel)
+		}
+	default:
+		// Empfänger ist noch beschäftigt
+	}
+}
+
+// sendError gibt einen Fehler weiter, ohne zu blockieren.
+func (w *Watcher) sendError(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
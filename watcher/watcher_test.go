@@ -0,0 +1,105 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"splitfuseX/core"
+)
+
+func TestWatcher(t *testing.T) {
+	// Testordner anlegen
+	root := filepath.Join(os.TempDir(), "watcher_test")
+	os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "a"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(root, 200*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// Datei in einem Unterordner und in einem neuen Ordner anlegen
+	if err := ioutil.WriteFile(filepath.Join(root, "a/x.txt"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "b"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond) // der neue Ordner wird asynchron hinzugefügt
+	if err := ioutil.WriteFile(filepath.Join(root, "b/y.txt"), []byte("y"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// alle Änderungen sammeln
+	got := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for !got["a/x.txt"] || !got["b"] || !got["b/y.txt"] {
+		select {
+		case paths := <-w.Changes():
+			for _, p := range paths {
+				got[p] = true
+			}
+		case <-timeout:
+			t.Fatalf("missing changes: %v", got)
+		}
+	}
+	if !reflect.DeepEqual(got, map[string]bool{"a/x.txt": true, "b": true, "b/y.txt": true}) {
+		t.Errorf("unexpected changes: %v", got)
+	}
+}
+
+func TestWatcherFilter(t *testing.T) {
+	// Testordner anlegen: 'cache' ist über Exclude, 'tmp' über die Ignore-Datei ausgeschlossen
+	root := t.TempDir()
+	for _, dir := range []string{"cache", "tmp", "a"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, core.IGNOREFILE), []byte("tmp/\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(root, 100*time.Millisecond, core.NewFilter([]string{"cache/"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// ein neuer ausgeschlossener Ordner wird ebenfalls nicht beobachtet
+	if err := os.MkdirAll(filepath.Join(root, "a/cache"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond) // der neue Ordner wird asynchron hinzugefügt
+	for _, p := range []string{"cache/x.txt", "tmp/x.txt", "a/cache/x.txt", "a/y.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(root, p), []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// alle Änderungen sammeln
+	got := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for !got["a/y.txt"] {
+		select {
+		case paths := <-w.Changes():
+			for _, p := range paths {
+				got[p] = true
+			}
+		case <-timeout:
+			t.Fatalf("missing changes: %v", got)
+		}
+	}
+	for _, p := range []string{"cache/x.txt", "tmp/x.txt", "a/cache/x.txt"} {
+		if got[p] {
+			t.Errorf("excluded directory was watched: %v", got)
+		}
+	}
+}